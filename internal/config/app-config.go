@@ -31,6 +31,14 @@ type AppConfig struct {
 	IP            string `json:"ip"`
 	// MQTT配置
 	MQTTBroker string `json:"mqttBroker"` // MQTT服务器地址
+	// 证书到期前多少天开始自动续期，CA 支持 ARI 时优先使用 CA 建议的时间
+	RenewBeforeDays int `json:"renewBeforeDays"`
+	// 所有用户都必须启用两步验证
+	Require2FA bool `json:"require2FA"`
+	// 登录会话空闲多少分钟后失效
+	SessionIdleMinutes int `json:"sessionIdleMinutes"`
+	// 登录会话最长有效小时数，到期后必须重新登录
+	SessionMaxHours int `json:"sessionMaxHours"`
 }
 
 var (
@@ -135,6 +143,13 @@ func InitAppConfig() {
 			"installPath":   pwd,
 			"controlCenter": "https://uranus-control.vercel.app",
 			"ip":            getIP(),
+			// 到期前 30 天开始自动续期
+			"renewBeforeDays": 30,
+			// 两步验证默认可选，用户自己在账户页面启用
+			"require2FA": false,
+			// 会话空闲 2 小时或登录 24 小时后需要重新登录
+			"sessionIdleMinutes": 120,
+			"sessionMaxHours":    24,
 			// 默认MQTT配置
 			"mqttBroker": "mqtt://mqtt.qfdk.me:1883",
 			//"mqttUsername": "",
@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+	"uranus/internal/models"
+	"uranus/internal/services"
+)
+
+// sessionUser 当前登录的用户，由 auth 中间件设置
+func sessionUser(ctx *gin.Context) models.User {
+	if user, ok := ctx.Get("user"); ok {
+		return user.(models.User)
+	}
+	return models.User{}
+}
+
+// requireSite 检查当前用户是否可以管理该站点，没有权限时返回 403
+func requireSite(ctx *gin.Context, name string) bool {
+	user := sessionUser(ctx)
+	if user.CanAccessSite(name) {
+		return true
+	}
+	ctx.JSON(http.StatusForbidden, gin.H{"message": "没有权限访问该站点"})
+	return false
+}
+
+// requireAllSites 服务器池、站点模板、共享证书、DNS 凭据和 CA 被多个站点共用，
+// 只分配了部分站点的用户不能修改
+func requireAllSites(ctx *gin.Context) bool {
+	user := sessionUser(ctx)
+	if user.AllSites() {
+		return true
+	}
+	ctx.JSON(http.StatusForbidden, gin.H{"message": "只分配了部分站点的用户不能修改多个站点共用的配置"})
+	return false
+}
+
+// requireCert 站点证书按站点分配检查，共享证书被多个站点使用，按共用的配置处理
+func requireCert(ctx *gin.Context, name string, shared bool) bool {
+	if shared {
+		return requireAllSites(ctx)
+	}
+	return requireSite(ctx, name)
+}
+
+// roleLabels 页面上显示的角色名称
+var roleLabels = map[string]string{
+	models.RoleViewer:       "查看者",
+	models.RoleSiteOperator: "站点操作员",
+	models.RoleCertManager:  "证书管理员",
+	models.RoleAdmin:        "管理员",
+}
+
+// Account 账户页面，修改自己的密码，管理员可以管理其他用户
+func Account(ctx *gin.Context) {
+	user := sessionUser(ctx)
+	var users []models.User
+	var sessions []sessionView
+	var sessionKeysAt time.Time
+	if user.Can(models.PermissionUsers) {
+		users = models.GetUsers()
+		sessions = activeSessions(ctx)
+		sessionKeysAt = services.SessionKeysCreatedAt()
+	}
+	ctx.HTML(http.StatusOK, "account.html", gin.H{
+		"activePage":  "account",
+		"user":        user,
+		"manageUsers": user.Can(models.PermissionUsers),
+		"users":       users,
+		"roles":       models.Roles(),
+		"roleLabels":  roleLabels,
+		// 两步验证
+		"twoFactorRequired": services.TwoFactorRequired(),
+		"recoveryCodesLeft": models.CountUnusedRecoveryCodes(user.ID),
+		"trustedDevices":    models.GetTrustedDevices(user.ID),
+		// 会话管理
+		"sessions":       sessions,
+		"sessionKeysAt":  sessionKeysAt,
+		"sessionIdle":    int(services.SessionIdleTimeout().Minutes()),
+		"sessionMaxHour": int(services.SessionMaxAge().Hours()),
+	})
+}
+
+// Users 以 JSON 返回所有用户，不包含密码哈希
+func Users(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"users": models.GetUsers()})
+}
+
+// ChangePassword 修改当前用户的密码
+func ChangePassword(ctx *gin.Context) {
+	var request struct {
+		Current  string `json:"current"`
+		Password string `json:"password"`
+	}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	user := sessionUser(ctx)
+	if err := services.ChangePassword(user.ID, request.Current, request.Password); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	// 其他设备上的会话需要用新密码重新登录
+	if err := services.RevokeUserSessions(user.ID, ctx.GetString("sessionToken")); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "密码已修改"})
+}
+
+// userRequest 新建或修改用户，修改时不使用用户名和密码
+type userRequest struct {
+	ID             uint   `json:"id"`
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	Role           string `json:"role"`
+	TerminalAccess bool   `json:"terminalAccess"`
+	ConfigAccess   bool   `json:"configAccess"`
+	Sites          string `json:"sites"`
+}
+
+// SaveUser 新建用户或修改用户的角色和授权，新用户的初始密码由管理员设置，首次登录时修改
+func SaveUser(ctx *gin.Context) {
+	var request userRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	access := models.User{
+		Username:       request.Username,
+		Role:           request.Role,
+		TerminalAccess: request.TerminalAccess,
+		ConfigAccess:   request.ConfigAccess,
+		Sites:          request.Sites,
+	}
+	if request.ID != 0 {
+		if err := services.UpdateUserAccess(request.ID, sessionUser(ctx).ID, access); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "OK", "id": request.ID})
+		return
+	}
+	user, err := services.CreateUser(access, request.Password)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK", "id": user.ID})
+}
+
+// ResetUserPassword 重置其他用户的密码
+func ResetUserPassword(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "无效的 ID"})
+		return
+	}
+	var request struct {
+		Password string `json:"password"`
+	}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err := services.ResetUserPassword(uint(id), request.Password); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+// DeleteUser 删除用户
+func DeleteUser(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "无效的 ID"})
+		return
+	}
+	if err := services.DeleteUser(uint(id), sessionUser(ctx).ID); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+// passwordRequest 需要再次输入密码确认的操作
+type passwordRequest struct {
+	Password string `json:"password"`
+}
+
+// SetupTOTP 生成两步验证密钥，页面显示二维码，输入验证码后才启用
+func SetupTOTP(ctx *gin.Context) {
+	secret, uri, err := services.BeginTOTPEnrollment(sessionUser(ctx).ID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"secret": secret, "uri": uri})
+}
+
+// EnableTOTP 确认验证码并启用两步验证，返回只显示一次的恢复码
+func EnableTOTP(ctx *gin.Context) {
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	codes, err := services.EnableTOTP(sessionUser(ctx).ID, request.Code)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "两步验证已启用", "recoveryCodes": codes})
+}
+
+// DisableTOTP 停用自己的两步验证
+func DisableTOTP(ctx *gin.Context) {
+	var request passwordRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err := services.DisableTOTP(sessionUser(ctx).ID, request.Password); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "两步验证已停用"})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，之前的恢复码失效
+func RegenerateRecoveryCodes(ctx *gin.Context) {
+	var request passwordRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	codes, err := services.RegenerateRecoveryCodes(sessionUser(ctx).ID, request.Password)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK", "recoveryCodes": codes})
+}
+
+// ForgetTrustedDevices 忘记所有记住的设备
+func ForgetTrustedDevices(ctx *gin.Context) {
+	if err := services.ForgetTrustedDevices(sessionUser(ctx).ID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+// ResetUserTOTP 管理员关闭其他用户的两步验证，用于丢失手机的情况
+func ResetUserTOTP(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "无效的 ID"})
+		return
+	}
+	if err := services.ResetUserTOTP(uint(id)); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+// sessionView 会话列表中的一行，标记当前浏览器的会话
+type sessionView struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+func activeSessions(ctx *gin.Context) []sessionView {
+	token := ctx.GetString("sessionToken")
+	var views []sessionView
+	for _, session := range services.GetActiveSessions() {
+		views = append(views, sessionView{Session: session, Current: services.IsCurrentSession(session, token)})
+	}
+	return views
+}
+
+// Sessions 以 JSON 返回所有有效的登录会话
+func Sessions(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"sessions": activeSessions(ctx)})
+}
+
+// RevokeSession 吊销会话，对应的用户需要重新登录
+func RevokeSession(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "无效的 ID"})
+		return
+	}
+	if err := services.RevokeSession(uint(id)); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+// RotateSessionKeys 更换会话 Cookie 的密钥，已经登录的用户不受影响
+func RotateSessionKeys(ctx *gin.Context) {
+	if err := services.RotateSessionKeys(); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "会话密钥已轮换"})
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+	"uranus/internal/models"
+	"uranus/internal/services"
+)
+
+// acmeServerView 页面上展示和提交的 ACME 服务器，EAB HMAC 只返回是否已设置
+type acmeServerView struct {
+	ID           uint   `json:"id"`
+	Name         string `json:"name"`
+	DirectoryURL string `json:"directoryUrl"`
+	EABKeyID     string `json:"eabKeyId"`
+	EABHMACKey   string `json:"eabHmacKey"`
+	HasEAB       bool   `json:"hasEab"`
+	RootCA       string `json:"rootCa"`
+	KeyType      string `json:"keyType"`
+	IsDefault    bool   `json:"isDefault"`
+	Certs        int    `json:"certs"`
+}
+
+func acmeServerViews() []acmeServerView {
+	views := []acmeServerView{}
+	for _, server := range models.GetACMEServers() {
+		views = append(views, acmeServerView{
+			ID:           server.ID,
+			Name:         server.Name,
+			DirectoryURL: server.DirectoryURL,
+			EABKeyID:     server.EABKeyID,
+			HasEAB:       server.EABHMACKey != "",
+			RootCA:       server.RootCA,
+			KeyType:      server.KeyType,
+			IsDefault:    server.IsDefault,
+			Certs:        len(models.GetCertsUsingACMEServer(server.ID)),
+		})
+	}
+	return views
+}
+
+// SaveACMEServer 新建或修改 ACME 服务器
+func SaveACMEServer(ctx *gin.Context) {
+	if !requireAllSites(ctx) {
+		return
+	}
+	var request acmeServerView
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	server := models.ACMEServer{
+		Name:         request.Name,
+		DirectoryURL: request.DirectoryURL,
+		EABKeyID:     request.EABKeyID,
+		RootCA:       request.RootCA,
+		KeyType:      request.KeyType,
+		IsDefault:    request.IsDefault,
+	}
+	server.ID = request.ID
+	if err := services.SaveACMEServer(&server, request.EABHMACKey); err != nil {
+		log.Printf("保存 ACME 服务器出错: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK", "id": server.ID})
+}
+
+// DeleteACMEServer 删除 ACME 服务器
+func DeleteACMEServer(ctx *gin.Context) {
+	if !requireAllSites(ctx) {
+		return
+	}
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "无效的 ID"})
+		return
+	}
+	if err := services.DeleteACMEServer(uint(id)); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+// internalCAIssuer CA 选择框中表示内部 CA 的值
+const internalCAIssuer = "internal"
+
+// parseCertIssuer 解析 CA 选择框的值，返回 ACME 服务器 ID 和是否使用内部 CA
+func parseCertIssuer(value string) (uint, bool) {
+	if value == internalCAIssuer {
+		return 0, true
+	}
+	id, _ := strconv.ParseUint(value, 10, 64)
+	return uint(id), false
+}
+
+// certIssuerValue 证书在 CA 选择框中的值
+func certIssuerValue(cert *models.Cert) string {
+	if cert.InternalCA {
+		return internalCAIssuer
+	}
+	return strconv.FormatUint(uint64(cert.ACMEServerID), 10)
+}
+
+// SetCertIssuer 设置证书的 CA 和私钥类型，acmeServer 为 0 时使用默认 CA，为 internal 时使用内部 CA
+func SetCertIssuer(ctx *gin.Context) {
+	configName := ctx.PostForm("configName")
+	shared, _ := strconv.ParseBool(ctx.PostForm("shared"))
+	if !requireCert(ctx, configName, shared) {
+		return
+	}
+	id, internalCA := parseCertIssuer(ctx.PostForm("acmeServer"))
+	if err := services.SetCertIssuer(configName, shared, id, internalCA, ctx.PostForm("keyType")); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+// CreateInternalCA 生成内部 CA 根证书
+func CreateInternalCA(ctx *gin.Context) {
+	if !requireAllSites(ctx) {
+		return
+	}
+	if err := services.CreateInternalCA(ctx.PostForm("commonName")); err != nil {
+		log.Printf("生成内部 CA 出错: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+// DownloadInternalCARoot 下载内部 CA 根证书，安装到客户端的信任列表中
+func DownloadInternalCARoot(ctx *gin.Context) {
+	if !services.GetInternalCA().Exists {
+		ctx.String(http.StatusNotFound, "内部 CA 还没有生成")
+		return
+	}
+	ctx.FileAttachment(services.InternalCARootFile(), "uranus-root-ca.crt")
+}
@@ -9,6 +9,7 @@ import (
 	"path"
 	"time"
 	"uranus/internal/config"
+	"uranus/internal/services"
 	"uranus/internal/tools"
 )
 
@@ -83,6 +84,8 @@ func SaveConfig(ctx *gin.Context) {
 	// 直接强制重新加载应用配置缓存
 	log.Printf("Configuration file updated successfully, reloading app config cache")
 	config.ReloadConfig()
+	// 配置文件中写入的明文密码迁移到用户表
+	services.MigrateUsers()
 
 	log.Printf("Configuration successfully updated and reloaded")
 	ctx.JSON(http.StatusOK, gin.H{"message": "Configuration updated successfully"})
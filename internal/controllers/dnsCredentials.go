@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+	"uranus/internal/models"
+	"uranus/internal/services"
+)
+
+// dnsCredentialView 页面上展示和提交的 DNS 凭据，密钥只返回是否已设置
+type dnsCredentialView struct {
+	ID        uint              `json:"id"`
+	Name      string            `json:"name"`
+	Provider  string            `json:"provider"`
+	Resolvers string            `json:"resolvers"`
+	Values    map[string]string `json:"values"`
+	Secrets   []string          `json:"secrets"` // 已保存的密钥项
+	Certs     int               `json:"certs"`
+}
+
+func dnsCredentialViews() []dnsCredentialView {
+	views := []dnsCredentialView{}
+	for _, credential := range models.GetDNSCredentials() {
+		view := dnsCredentialView{
+			ID:        credential.ID,
+			Name:      credential.Name,
+			Provider:  credential.Provider,
+			Resolvers: credential.Resolvers,
+			Values:    map[string]string{},
+			Secrets:   []string{},
+			Certs:     len(models.GetCertsUsingDNSCredential(credential.ID)),
+		}
+		provider, _ := services.GetDNSProvider(credential.Provider)
+		values, err := services.DNSCredentialValues(&credential)
+		if err != nil {
+			log.Println(err)
+		}
+		for _, field := range provider.Fields {
+			if values[field.Env] == "" {
+				continue
+			}
+			if field.Secret {
+				view.Secrets = append(view.Secrets, field.Env)
+			} else {
+				view.Values[field.Env] = values[field.Env]
+			}
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
+// SaveDNSCredential 新建或修改 DNS 凭据
+func SaveDNSCredential(ctx *gin.Context) {
+	if !requireAllSites(ctx) {
+		return
+	}
+	var request dnsCredentialView
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	// 外部脚本以 root 身份运行，证书管理员不能借此绕过终端授权
+	user := sessionUser(ctx)
+	existing := models.GetDNSCredentialByID(request.ID)
+	if (services.IsPrivilegedDNSProvider(request.Provider) || services.IsPrivilegedDNSProvider(existing.Provider)) &&
+		!user.Can(models.PermissionTerminal) {
+		ctx.JSON(http.StatusForbidden, gin.H{"message": "外部脚本和自定义接口需要终端权限"})
+		return
+	}
+	credential := models.DNSCredential{
+		Name:      request.Name,
+		Provider:  request.Provider,
+		Resolvers: request.Resolvers,
+	}
+	credential.ID = request.ID
+	if err := services.SaveDNSCredential(&credential, request.Values); err != nil {
+		log.Printf("保存 DNS 凭据出错: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK", "id": credential.ID})
+}
+
+// DeleteDNSCredential 删除 DNS 凭据
+func DeleteDNSCredential(ctx *gin.Context) {
+	if !requireAllSites(ctx) {
+		return
+	}
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "无效的 ID"})
+		return
+	}
+	if err := services.DeleteDNSCredential(uint(id)); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+// SetCertChallenge 设置证书的验证方式，dnsCredential 为 0 时使用 HTTP-01
+func SetCertChallenge(ctx *gin.Context) {
+	configName := ctx.PostForm("configName")
+	shared, _ := strconv.ParseBool(ctx.PostForm("shared"))
+	if !requireCert(ctx, configName, shared) {
+		return
+	}
+	id, _ := strconv.ParseUint(ctx.PostForm("dnsCredential"), 10, 64)
+	if err := services.SetCertDNSCredential(configName, shared, uint(id)); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
@@ -3,13 +3,16 @@ package controllers
 import (
 	"encoding/base64"
 	"github.com/dustin/go-humanize"
+	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/host"
 	"github.com/shirou/gopsutil/v3/mem"
 	"log"
 	"net/http"
+	"strings"
 	config2 "uranus/internal/config"
+	"uranus/internal/models"
 	"uranus/internal/services"
 )
 
@@ -47,3 +50,19 @@ func Index(ctx *gin.Context) {
 			"commitID":           config2.CommitID,
 		})
 }
+
+// currentUser 返回当前登录的用户名
+func currentUser(ctx *gin.Context) string {
+	if username, ok := sessions.Default(ctx).Get("username").(string); ok && username != "" {
+		return username
+	}
+	return config2.GetAppConfig().Username
+}
+
+// requestSource 根据请求路径判断变更来源，/admin/api 下的请求视为 API 调用
+func requestSource(ctx *gin.Context) string {
+	if strings.HasPrefix(ctx.FullPath(), "/admin/api/") {
+		return models.RevisionSourceAPI
+	}
+	return models.RevisionSourceWeb
+}
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"uranus/internal/models"
+	"uranus/internal/services"
+)
+
+// maintenanceFor 读取站点的维护模式设置，没有记录时返回默认值
+func maintenanceFor(filename string) models.Maintenance {
+	configName := strings.TrimSuffix(filename, ".conf")
+	maintenance := models.GetMaintenanceByFilename(configName)
+	maintenance.FileName = configName
+	if maintenance.HTML == "" {
+		maintenance.HTML = services.DefaultMaintenanceHTML
+	}
+	return maintenance
+}
+
+// MaintenancePage 站点维护模式设置页面
+func MaintenancePage(ctx *gin.Context) {
+	ctx.HTML(http.StatusOK, "maintenance.html", gin.H{
+		"activePage":  "sites",
+		"maintenance": maintenanceFor(ctx.Param("filename")),
+	})
+}
+
+// GetMaintenance 返回站点的维护模式设置
+func GetMaintenance(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, maintenanceFor(ctx.Param("filename")))
+}
+
+// SaveMaintenance 保存维护模式设置 (开关、页面、白名单、计划时间)
+func SaveMaintenance(ctx *gin.Context) {
+	var maintenance models.Maintenance
+	if err := ctx.ShouldBindJSON(&maintenance); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	maintenance.FileName = ctx.Param("filename")
+
+	result, err := services.SaveMaintenance(&maintenance, currentUser(ctx), requestSource(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": result.Message(), "issues": result.Issues, "maintenance": maintenance})
+}
+
+// EnableMaintenance 立即开启维护模式
+func EnableMaintenance(ctx *gin.Context) {
+	setMaintenanceEnabled(ctx, true)
+}
+
+// DisableMaintenance 关闭维护模式
+func DisableMaintenance(ctx *gin.Context) {
+	setMaintenanceEnabled(ctx, false)
+}
+
+func setMaintenanceEnabled(ctx *gin.Context, enabled bool) {
+	result, err := services.SetMaintenanceEnabled(ctx.Param("filename"), enabled, currentUser(ctx), requestSource(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": result.Message(), "issues": result.Issues})
+}
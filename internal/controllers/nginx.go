@@ -76,6 +76,7 @@ func GetNginxConf(ctx *gin.Context) {
 		"configFileName":     "nginx",
 		"content":            content,
 		"isNginxDefaultConf": true,
+		"filePath":           services.NginxConfFile(),
 	})
 }
 
@@ -87,8 +88,16 @@ func SaveNginxConf(ctx *gin.Context) {
 	nginxConfCache = ""
 	nginxConfCacheLock.Unlock()
 
-	result := services.SaveNginxConf(content)
-	ctx.JSON(http.StatusOK, gin.H{"message": result})
+	result, err := services.SaveNginxConf(content, currentUser(ctx), requestSource(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusOK, gin.H{"message": "Error saving configuration: " + err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": result.Message(),
+		"file":    services.NginxConfFile(),
+		"issues":  result.Issues,
+	})
 }
 
 func GetNginxCompileInfo(ctx *gin.Context) {
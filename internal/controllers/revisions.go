@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"uranus/internal/models"
+	"uranus/internal/services"
+	"uranus/internal/tools"
+)
+
+// canAccessRevisionFile 恢复 nginx.conf 需要 nginx 权限，站点文件按分配给用户的站点检查
+func canAccessRevisionFile(user models.User, path string, write bool) bool {
+	if filepath.Clean(path) == filepath.Clean(services.NginxConfFile()) {
+		return !write || user.Can(models.PermissionNginx)
+	}
+	// 站点模板被多个站点共用
+	if services.IsCustomTemplateFile(path) {
+		return !write || user.AllSites()
+	}
+	return user.CanAccessSite(filepath.Base(path))
+}
+
+// revisionFiles 当前用户可以查看的有历史版本的文件
+func revisionFiles(user models.User) []string {
+	var files []string
+	for _, file := range models.GetRevisionFiles() {
+		if canAccessRevisionFile(user, file, false) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// Revisions 历史版本页面，未指定文件时列出所有有历史的文件
+func Revisions(ctx *gin.Context) {
+	user := sessionUser(ctx)
+	file := ctx.Query("file")
+	var revisions []models.Revision
+	if file != "" && canAccessRevisionFile(user, file, false) {
+		revisions = models.GetRevisions(file)
+	}
+	ctx.HTML(http.StatusOK, "revisions.html", gin.H{
+		"activePage": "sites",
+		"file":       file,
+		"files":      revisionFiles(user),
+		"revisions":  revisions,
+	})
+}
+
+// RevisionsAPI 以JSON返回某个文件的历史版本 (不含内容)
+func RevisionsAPI(ctx *gin.Context) {
+	user := sessionUser(ctx)
+	file := ctx.Query("file")
+	if file == "" {
+		ctx.JSON(http.StatusOK, gin.H{"files": revisionFiles(user)})
+		return
+	}
+	if !canAccessRevisionFile(user, file, false) {
+		ctx.JSON(http.StatusForbidden, gin.H{"message": "没有权限访问该文件"})
+		return
+	}
+
+	var results []gin.H
+	for _, revision := range models.GetRevisions(file) {
+		results = append(results, gin.H{
+			"id":        revision.ID,
+			"author":    revision.Author,
+			"source":    revision.Source,
+			"createdAt": revision.CreatedAt,
+		})
+	}
+	ctx.JSON(http.StatusOK, gin.H{"file": file, "revisions": results})
+}
+
+// GetRevision 返回某个历史版本的内容和相对上一版本的diff
+func GetRevision(ctx *gin.Context) {
+	revision := models.GetRevisionByID(parseRevisionID(ctx.Param("id")))
+	if revision.ID == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": "历史版本不存在"})
+		return
+	}
+	if !canAccessRevisionFile(sessionUser(ctx), revision.FilePath, false) {
+		ctx.JSON(http.StatusForbidden, gin.H{"message": "没有权限访问该文件"})
+		return
+	}
+	ctx.JSON(http.StatusOK, revision)
+}
+
+// CompareRevisions 比较任意两个历史版本，from 为 0 时与空文件比较
+func CompareRevisions(ctx *gin.Context) {
+	from := models.GetRevisionByID(parseRevisionID(ctx.Query("from")))
+	to := models.GetRevisionByID(parseRevisionID(ctx.Query("to")))
+	if to.ID == 0 {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": "历史版本不存在"})
+		return
+	}
+	if from.ID != 0 && from.FilePath != to.FilePath {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "只能比较同一个文件的历史版本"})
+		return
+	}
+	if !canAccessRevisionFile(sessionUser(ctx), to.FilePath, false) {
+		ctx.JSON(http.StatusForbidden, gin.H{"message": "没有权限访问该文件"})
+		return
+	}
+
+	fromName := "/dev/null"
+	if from.ID != 0 {
+		fromName = to.FilePath + "@" + strconv.Itoa(int(from.ID))
+	}
+	toName := to.FilePath + "@" + strconv.Itoa(int(to.ID))
+	ctx.JSON(http.StatusOK, gin.H{
+		"diff": tools.UnifiedDiff(fromName, toName, from.Content, to.Content),
+	})
+}
+
+// RestoreRevision 恢复到某个历史版本，与普通保存一样经过检测和重载
+func RestoreRevision(ctx *gin.Context) {
+	id := parseRevisionID(ctx.Param("id"))
+	if revision := models.GetRevisionByID(id); revision.ID != 0 && !canAccessRevisionFile(sessionUser(ctx), revision.FilePath, true) {
+		ctx.JSON(http.StatusForbidden, gin.H{"message": "没有权限恢复该文件"})
+		return
+	}
+	result, err := services.RestoreRevision(id, currentUser(ctx), requestSource(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	// nginx.conf 或自定义模板可能被恢复，清除缓存
+	nginxConfCacheLock.Lock()
+	nginxConfCache = ""
+	nginxConfCacheLock.Unlock()
+	clearTemplateCache()
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": result.Message(),
+		"issues":  result.Issues,
+	})
+}
+
+func parseRevisionID(value string) uint {
+	id, _ := strconv.ParseUint(value, 10, 64)
+	return uint(id)
+}
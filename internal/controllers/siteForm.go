@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	. "uranus/internal/config"
+	"uranus/internal/models"
+	"uranus/internal/services"
+)
+
+// siteFormRequest 表单编辑器提交的数据
+type siteFormRequest struct {
+	FileName string          `json:"fileName"`
+	Spec     models.SiteSpec `json:"spec"`
+	// 站点证书的签发方式，internal 为保存时使用内部 CA 签发
+	CertSource string `json:"certSource"`
+}
+
+// upstreamPoolNames 表单中可选的服务器池
+func upstreamPoolNames() []string {
+	names := []string{}
+	for _, pool := range models.GetUpstreamPools() {
+		names = append(names, pool.Name)
+	}
+	return names
+}
+
+// sharedCertOptions 表单中可选的共享证书及其文件路径
+func sharedCertOptions() []gin.H {
+	options := []gin.H{}
+	for _, cert := range models.GetSharedCerts() {
+		dir := services.CertDir(&cert)
+		options = append(options, gin.H{
+			"name":        cert.FileName,
+			"domains":     cert.Domains,
+			"certificate": filepath.Join(dir, "fullchain.cer"),
+			"key":         filepath.Join(dir, "private.key"),
+		})
+	}
+	return options
+}
+
+// SiteForm 表单模式编辑站点，没有文件名时为新建站点
+func SiteForm(ctx *gin.Context) {
+	configName := strings.TrimSuffix(ctx.Param("filename"), ".conf")
+	if configName == "" {
+		ctx.HTML(http.StatusOK, "siteForm.html", gin.H{
+			"activePage":  "sites",
+			"isNewSite":   true,
+			"pools":       upstreamPoolNames(),
+			"sharedCerts": sharedCertOptions(),
+			"spec": models.SiteSpec{
+				Locations: []models.SiteLocation{{Path: "/", Upstreams: []string{"http://localhost:3000"}}},
+			},
+		})
+		return
+	}
+
+	filePath := filepath.Join(GetAppConfig().VhostPath, configName+".conf")
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		log.Printf("读取配置文件出错: %v", err)
+		ctx.String(http.StatusNotFound, "未找到配置文件")
+		return
+	}
+
+	// 表单模式的站点使用保存的定义，其他站点尝试从配置文件识别
+	site := models.GetSiteByFilename(configName)
+	var spec *models.SiteSpec
+	var importError string
+	if site.Mode == models.SiteModeForm {
+		spec, err = site.GetSiteSpec()
+	} else {
+		spec, err = services.SpecFromConf(configName, content)
+	}
+	if err != nil {
+		importError = err.Error()
+		spec = &models.SiteSpec{}
+	}
+
+	ctx.HTML(http.StatusOK, "siteForm.html", gin.H{
+		"activePage":     "sites",
+		"configFileName": configName,
+		"mode":           site.Mode,
+		"spec":           spec,
+		"importError":    importError,
+		"filePath":       filePath,
+		"pools":          upstreamPoolNames(),
+		"sharedCerts":    sharedCertOptions(),
+		"internalCA":     models.GetCertByFilename(configName).InternalCA,
+	})
+}
+
+// PreviewSiteForm 根据表单生成配置文件内容，不保存
+func PreviewSiteForm(ctx *gin.Context) {
+	var request siteFormRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	content, err := services.RenderSite(request.FileName, &request.Spec)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"content": content})
+}
+
+// SaveSiteForm 保存表单模式的站点，生成配置文件并通过 nginx -t 检测
+func SaveSiteForm(ctx *gin.Context) {
+	var request siteFormRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	fileName := strings.TrimSuffix(strings.TrimSpace(request.FileName), ".conf")
+	if fileName == "" || fileName == "default" || strings.ContainsAny(fileName, `/\`) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "文件名不合法"})
+		return
+	}
+	if !requireSite(ctx, fileName) {
+		return
+	}
+
+	// 使用内部 CA 时先签发站点证书，配置文件引用的证书存在才能通过 nginx -t
+	spec := &request.Spec
+	if spec.SSL && spec.SSLCertificate == "" && request.CertSource == internalCAIssuer {
+		if err := services.EnsureInternalCert(fileName, cleanDomains(spec.Domains)); err != nil {
+			log.Printf("内部 CA 签发证书出错: %v", err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": "内部 CA 签发证书失败: " + err.Error()})
+			return
+		}
+	}
+
+	result, content, err := services.SaveSiteSpec(fileName, spec, currentUser(ctx), requestSource(ctx))
+	if err != nil {
+		log.Printf("保存站点出错: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !result.OK {
+		ctx.JSON(http.StatusOK, gin.H{
+			"message": result.Message(),
+			"content": content,
+			"issues":  result.Issues,
+		})
+		return
+	}
+
+	// 清除所有缓存以确保数据刷新
+	clearTemplateCache()
+
+	ctx.JSON(http.StatusOK, gin.H{"message": result.Message(), "content": content})
+}
+
+// SetSiteMode 切换站点的编辑模式 (form/raw)，切换到表单模式要求配置文件能被完整识别
+func SetSiteMode(ctx *gin.Context) {
+	configName := strings.TrimSuffix(ctx.Param("filename"), ".conf")
+	content, err := os.ReadFile(filepath.Join(GetAppConfig().VhostPath, configName+".conf"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": "未找到配置文件"})
+		return
+	}
+
+	spec, err := services.SetSiteMode(configName, ctx.PostForm("mode"), content)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK", "spec": spec})
+}
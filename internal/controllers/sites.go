@@ -1,7 +1,7 @@
 package controllers
 
 import (
-	_ "embed"
+	"encoding/json"
 	"github.com/dustin/go-humanize"
 	"github.com/gin-gonic/gin"
 	"log"
@@ -13,21 +13,23 @@ import (
 	"sync"
 	. "uranus/internal/config"
 	"uranus/internal/models"
+	"uranus/internal/nginxconf"
 	"uranus/internal/services"
 )
 
-//go:embed template/http.conf
-var httpConf string
-
-//go:embed template/https.conf
-var httpsConf string
-
 // 模板缓存，用于防止重复的字符串操作
 var (
 	templateCache     = make(map[string]string)
 	templateCacheLock sync.RWMutex
 )
 
+// clearTemplateCache 站点或模板变化后清除生成的配置缓存
+func clearTemplateCache() {
+	templateCacheLock.Lock()
+	templateCache = make(map[string]string)
+	templateCacheLock.Unlock()
+}
+
 // NewSite 创建新站点的页面处理
 func NewSite(ctx *gin.Context) {
 	ctx.HTML(http.StatusOK, "siteConfEdit.html", gin.H{
@@ -36,18 +38,40 @@ func NewSite(ctx *gin.Context) {
 		"isNewSite":      true,
 		"infoPlus":       true,
 		"isDefaultConf":  false,
+		"templates":      services.SiteTemplates(),
 	})
 }
 
-// GetTemplate 获取配置模板
+// cleanDomains 去掉域名列表中的空格和空项
+func cleanDomains(domains []string) []string {
+	var result []string
+	for _, domain := range domains {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			result = append(result, domain)
+		}
+	}
+	return result
+}
+
+// GetTemplate 根据模板目录中的模板生成配置，没有指定模板时使用站点新建时保存的模板和参数
 func GetTemplate(ctx *gin.Context) {
-	domains := ctx.QueryArray("domains[]")
+	domains := cleanDomains(ctx.QueryArray("domains[]"))
 	configName := ctx.Query("configName")
 	proxy := ctx.Query("proxy")
 	enableSSL, _ := strconv.ParseBool(ctx.Query("ssl"))
+	templateID := ctx.Query("template")
+	params := ctx.QueryMap("params")
+	sharedCert := ctx.Query("cert")
+	if templateID == "" && configName != "" {
+		if site := models.GetSiteByFilename(configName); site.Template != "" {
+			templateID = site.Template
+			params = site.GetTemplateParams()
+		}
+	}
 
 	// 根据参数创建缓存键
-	cacheKey := strings.Join(domains, ",") + "|" + configName + "|" + proxy + "|" + strconv.FormatBool(enableSSL)
+	paramsJSON, _ := json.Marshal(params)
+	cacheKey := templateID + "|" + strings.Join(domains, ",") + "|" + configName + "|" + proxy + "|" + strconv.FormatBool(enableSSL) + "|" + sharedCert + "|" + string(paramsJSON)
 
 	// 首先检查模板缓存
 	templateCacheLock.RLock()
@@ -59,29 +83,50 @@ func GetTemplate(ctx *gin.Context) {
 	templateCacheLock.RUnlock()
 
 	// 缓存未命中，生成模板
-	var templateConf string
-	if enableSSL {
-		templateConf = httpsConf
-	} else {
-		templateConf = httpConf
+	siteTemplate, err := services.GetSiteTemplate(templateID)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	data := services.TemplateData{
+		ConfigName: configName,
+		Domains:    domains,
+		Proxy:      proxy,
+		SSL:        enableSSL,
+		Params:     params,
+	}
+	// 使用共享证书 (例如通配符证书) 时 ssl_certificate 指向共享证书目录
+	if sharedCert != "" {
+		cert := models.GetSharedCert(sharedCert)
+		if cert.ID == 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": "共享证书不存在: " + sharedCert})
+			return
+		}
+		data.CertDir = services.CertDir(&cert)
+	}
+	content, err := siteTemplate.Render(data)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
 	}
-
-	// 应用模板替换
-	inputTemplate := templateConf
-	inputTemplate = strings.ReplaceAll(inputTemplate, "{{domain}}", strings.Join(domains, " "))
-	inputTemplate = strings.ReplaceAll(inputTemplate, "{{configName}}", configName)
-	inputTemplate = strings.ReplaceAll(inputTemplate, "{{sslPath}}", GetAppConfig().SSLPath)
-	inputTemplate = strings.ReplaceAll(inputTemplate, "{{proxy}}", proxy)
 
 	// 更新缓存
 	templateCacheLock.Lock()
-	templateCache[cacheKey] = inputTemplate
+	templateCache[cacheKey] = content
 	templateCacheLock.Unlock()
 
-	ctx.JSON(http.StatusOK, gin.H{"content": inputTemplate})
+	ctx.JSON(http.StatusOK, gin.H{"content": content})
+}
+
+// siteEntry 网站列表中的一项
+type siteEntry struct {
+	Name     string
+	Size     uint64
+	Disabled bool
+	Stream   bool
 }
 
-// GetSites 获取所有站点配置
+// GetSites 获取所有站点配置，已停用的站点排在最后
 func GetSites(ctx *gin.Context) {
 	vhostPath := GetAppConfig().VhostPath
 	allFiles, err := os.ReadDir(vhostPath)
@@ -89,25 +134,131 @@ func GetSites(ctx *gin.Context) {
 		log.Println(err)
 		ctx.HTML(http.StatusOK, "sites.html", gin.H{
 			"activePage": "sites",
-			"files":      []string{}})
+			"files":      []siteEntry{}})
 		return
 	}
 
-	// 只过滤显示.conf文件
-	var confFiles []os.DirEntry
+	// 只过滤显示.conf文件，只分配了部分站点的用户只显示这些站点
+	user := sessionUser(ctx)
+	var sites []siteEntry
 	for _, file := range allFiles {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".conf") {
-			confFiles = append(confFiles, file)
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".conf") || services.IsUranusConfFile(file.Name()) {
+			continue
+		}
+		if !user.CanAccessSite(file.Name()) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		sites = append(sites, siteEntry{Name: file.Name(), Size: uint64(info.Size())})
+	}
+	// 从 sites-enabled 导入的站点，文件名可能没有 .conf 扩展名
+	for _, info := range services.ImportedSiteFiles() {
+		name := strings.TrimSuffix(info.Name(), ".conf") + ".conf"
+		if user.CanAccessSite(name) {
+			sites = append(sites, siteEntry{Name: name, Size: uint64(info.Size())})
+		}
+	}
+	for _, info := range services.StreamSiteFiles() {
+		if user.CanAccessSite(info.Name()) {
+			sites = append(sites, siteEntry{Name: info.Name(), Size: uint64(info.Size()), Stream: true})
+		}
+	}
+	for _, info := range services.DisabledSiteFiles() {
+		if user.CanAccessSite(info.Name()) {
+			sites = append(sites, siteEntry{Name: info.Name(), Size: uint64(info.Size()), Disabled: true})
+		}
+	}
+
+	// 数据库记录与配置文件不一致的站点，按文件名索引
+	drift := map[string]string{}
+	for fileName, fields := range services.SiteDriftByFile() {
+		drift[fileName+".conf"] = strings.Join(fields, ", ")
+	}
+
+	// 维护模式状态: active 表示已生效，scheduled 表示等待计划时间
+	maintenance := map[string]string{}
+	for _, m := range models.GetMaintenances() {
+		if m.Active {
+			maintenance[m.FileName+".conf"] = "active"
+		} else if m.Enabled {
+			maintenance[m.FileName+".conf"] = "scheduled"
 		}
 	}
 
 	ctx.HTML(http.StatusOK, "sites.html", gin.H{
-		"files":         confFiles,
+		"files":         sites,
+		"drift":         drift,
+		"maintenance":   maintenance,
 		"humanizeBytes": humanize.Bytes,
 		"activePage":    "sites",
 	})
 }
 
+// DisableSite 停用站点，保留配置文件和证书
+func DisableSite(ctx *gin.Context) {
+	setSiteEnabled(ctx, false)
+}
+
+// EnableSite 重新启用已停用的站点
+func EnableSite(ctx *gin.Context) {
+	setSiteEnabled(ctx, true)
+}
+
+func setSiteEnabled(ctx *gin.Context, enabled bool) {
+	filename := ctx.Param("filename")
+	var result *services.NginxTestResult
+	var err error
+	if enabled {
+		result, err = services.EnableSite(filename)
+	} else {
+		result, err = services.DisableSite(filename)
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": result.Message(), "issues": result.Issues})
+}
+
+// ReconcileSites 扫描站点目录，GET 只报告差异，POST 以磁盘为准导入/更新数据库记录
+func ReconcileSites(ctx *gin.Context) {
+	apply := ctx.Request.Method == http.MethodPost
+	// 导入会修改所有站点的记录
+	if user := sessionUser(ctx); apply && !user.AllSites() {
+		ctx.JSON(http.StatusForbidden, gin.H{"message": "只有可以管理所有站点的用户才能导入"})
+		return
+	}
+	report := services.ReconcileSites(apply)
+	if apply {
+		clearTemplateCache()
+	}
+	user := sessionUser(ctx)
+	ctx.JSON(http.StatusOK, visibleReconcileReport(&user, report))
+}
+
+// visibleReconcileReport 只分配了部分站点的用户只能看到自己站点的差异和孤立记录
+func visibleReconcileReport(user *models.User, report *services.ReconcileReport) *services.ReconcileReport {
+	if user.AllSites() {
+		return report
+	}
+	// 错误信息中包含其他站点的文件路径，不返回
+	visible := &services.ReconcileReport{Scanned: report.Scanned}
+	for _, drift := range report.Drift {
+		if user.CanAccessSite(drift.FileName) {
+			visible.Drift = append(visible.Drift, drift)
+		}
+	}
+	for _, name := range report.Orphans {
+		if user.CanAccessSite(name) {
+			visible.Orphans = append(visible.Orphans, name)
+		}
+	}
+	return visible
+}
+
 // EditSiteConf 编辑站点配置
 func EditSiteConf(ctx *gin.Context) {
 	// 从URL参数获取文件名
@@ -125,8 +276,12 @@ func EditSiteConf(ctx *gin.Context) {
 		configName = strings.TrimSuffix(configName, ".conf")
 	}
 
-	vhostPath := GetAppConfig().VhostPath
-	filePath := filepath.Join(vhostPath, fileToRead)
+	// TCP/UDP 代理的配置在 stream 目录中，从 sites-enabled 导入的站点使用原来的文件
+	stream := filename != "default" && services.IsStreamSite(fileToRead)
+	filePath := filepath.Join(GetAppConfig().VhostPath, fileToRead)
+	if filename != "default" {
+		filePath = services.SiteConfPath(fileToRead)
+	}
 
 	// 检查文件是否存在
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
@@ -144,15 +299,38 @@ func EditSiteConf(ctx *gin.Context) {
 	}
 
 	if filename != "default" {
-		// 从数据库获取证书信息
+		// 优先从配置文件中读取域名和反代地址，解析失败时使用数据库中的记录
 		cert := models.GetCertByFilename(configName)
+		site := models.GetSiteByFilename(configName)
+		domains, proxy := cert.Domains, cert.Proxy
+		if parsed, err := nginxconf.Parse(filePath, content); err == nil {
+			info := nginxconf.Summarize(parsed)
+			if len(info.Domains) > 0 {
+				domains = strings.Join(info.Domains, ",")
+			}
+			if info.Proxy != "" {
+				proxy = info.Proxy
+			}
+		} else {
+			log.Printf("解析配置文件出错: %v", err)
+		}
 		ctx.HTML(http.StatusOK, "siteConfEdit.html", gin.H{
 			"configFileName": configName,
-			"domains":        cert.Domains,
+			"domains":        domains,
 			"content":        string(content),
-			"proxy":          cert.Proxy,
-			"infoPlus":       true,
+			"proxy":          proxy,
+			"infoPlus":       !stream,
 			"isDefaultConf":  false,
+			"filePath":       filePath,
+			"mode":           site.Mode,
+			"stream":         stream,
+			"dnsCredentials": models.GetDNSCredentials(),
+			"dnsCredential":  cert.DNSCredentialID,
+			"sharedCerts":    models.GetSharedCerts(),
+			"acmeServers":    models.GetACMEServers(),
+			"acmeServer":     certIssuerValue(&cert),
+			"keyTypes":       services.ACMEKeyTypes(),
+			"keyType":        cert.KeyType,
 		})
 	} else {
 		ctx.HTML(http.StatusOK, "siteConfEdit.html", gin.H{
@@ -160,6 +338,7 @@ func EditSiteConf(ctx *gin.Context) {
 			"content":        string(content),
 			"infoPlus":       false,
 			"isDefaultConf":  true,
+			"filePath":       filePath,
 		})
 	}
 }
@@ -180,13 +359,36 @@ func DeleteSiteConf(ctx *gin.Context) {
 		configName = strings.TrimSuffix(configName, ".conf")
 	}
 
+	// 从 sites-enabled 导入的站点删除原来的文件 (软链接只删除链接本身)
+	if path := services.ImportedSitePath(configName); path != "" {
+		if err := os.Remove(path); err != nil {
+			log.Printf("删除配置文件出错: %v", err)
+		}
+	}
+
 	// 删除配置文件
 	vhostPath := GetAppConfig().VhostPath
 	err := os.Remove(filepath.Join(vhostPath, fileToDelete))
-	if err != nil {
+	if err != nil && !services.IsStreamSite(configName) {
 		log.Printf("删除配置文件出错: %v", err)
 	}
 
+	// TCP/UDP 代理的配置在 stream 目录中
+	if services.IsStreamSite(configName) {
+		if err := os.Remove(services.SiteConfPath(configName)); err != nil {
+			log.Printf("删除配置文件出错: %v", err)
+		}
+	}
+
+	// 已停用的站点配置在单独的目录中
+	if services.IsSiteDisabled(configName) {
+		if err := os.Remove(filepath.Join(services.DisabledSitesDir(), configName+".conf")); err != nil {
+			log.Printf("删除配置文件出错: %v", err)
+		}
+	}
+
+	services.RemoveMaintenance(configName)
+
 	// 如果存在，删除SSL目录
 	sslPath := GetAppConfig().SSLPath
 	err = os.RemoveAll(filepath.Join(sslPath, configName))
@@ -200,11 +402,13 @@ func DeleteSiteConf(ctx *gin.Context) {
 	if err != nil {
 		log.Println(err)
 	}
+	site := models.GetSiteByFilename(configName)
+	if err = site.Remove(); err != nil {
+		log.Println(err)
+	}
 
 	// 清除所有缓存以确保数据刷新
-	templateCacheLock.Lock()
-	templateCache = make(map[string]string)
-	templateCacheLock.Unlock()
+	clearTemplateCache()
 
 	// 重新加载nginx
 	services.ReloadNginx()
@@ -212,21 +416,25 @@ func DeleteSiteConf(ctx *gin.Context) {
 	ctx.Redirect(http.StatusFound, "/admin/sites")
 }
 
+// validSiteFileName 站点配置名只能是站点目录下的文件名，不能包含路径
+func validSiteFileName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `/\`) && !strings.Contains(name, "..")
+}
+
 // SaveSiteConf 保存站点配置
 func SaveSiteConf(ctx *gin.Context) {
 	fileName := ctx.PostForm("filename")
 	domains := ctx.PostFormArray("domains[]")
 	content := ctx.PostForm("content")
 	proxy := ctx.PostForm("proxy")
-
-	// 如果不是默认配置，则保存到数据库
-	if fileName != "default" {
-		cert := models.GetCertByFilename(fileName)
-		cert.Content = content
-		cert.Domains = strings.Join(domains, ",")
-		cert.FileName = fileName
-		cert.Proxy = proxy
-		models.GetDbClient().Save(&cert)
+	templateID := ctx.PostForm("template")
+	params := ctx.PostFormMap("params")
+	if !validSiteFileName(fileName) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "文件名不合法"})
+		return
+	}
+	if !requireSite(ctx, fileName) {
+		return
 	}
 
 	// 准备用于文件路径的文件名，确保具有.conf扩展名
@@ -235,32 +443,84 @@ func SaveSiteConf(ctx *gin.Context) {
 		fullFileName = fileName + ".conf"
 	}
 
-	// 确保vhost目录存在
-	vhostPath := GetAppConfig().VhostPath
-	if _, err := os.Stat(vhostPath); os.IsNotExist(err) {
-		err = os.MkdirAll(vhostPath, 0755)
-		if err != nil {
-			log.Printf("创建vhost目录出错: %v", err)
-			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "创建目录出错"})
+	// TCP/UDP 代理写入 stream 目录，其他站点写入站点目录
+	stream := fileName != "default" && services.IsStreamSite(fileName)
+	if siteTemplate, err := services.GetSiteTemplate(templateID); templateID != "" && err == nil {
+		if !siteTemplate.Stream && stream {
+			ctx.JSON(http.StatusOK, gin.H{"message": "已存在同名的 TCP/UDP 代理: " + fullFileName})
 			return
 		}
+		stream = siteTemplate.Stream
 	}
 
-	// 写入配置文件
-	filePath := filepath.Join(vhostPath, fullFileName)
-	err := os.WriteFile(filePath, []byte(content), 0644)
-	if err != nil {
-		log.Printf("写入配置文件出错: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"message": "写入文件出错"})
+	// 写入配置文件，nginx -t 检测失败时自动回滚；从 sites-enabled 导入的站点写回原来的文件
+	filePath := filepath.Join(GetAppConfig().VhostPath, fullFileName)
+	if path := services.ImportedSitePath(fileName); path != "" && fileName != "default" {
+		filePath = path
+	}
+	var result *services.NginxTestResult
+	var err error
+	if stream {
+		filePath = filepath.Join(services.StreamDir(), fullFileName)
+		result, err = services.SaveStreamSite(fileName, content, currentUser(ctx), requestSource(ctx))
+		if err != nil {
+			ctx.JSON(http.StatusOK, gin.H{"message": err.Error()})
+			return
+		}
+	} else {
+		result, err = services.SaveConfFile(filePath, content, currentUser(ctx), requestSource(ctx))
+		if err != nil {
+			log.Printf("写入配置文件出错: %v", err)
+			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "写入文件出错"})
+			return
+		}
+	}
+	if !result.OK {
+		ctx.JSON(http.StatusOK, gin.H{
+			"message": result.Message(),
+			"file":    filePath,
+			"issues":  result.Issues,
+		})
 		return
 	}
 
+	// 如果不是默认配置，则保存到数据库
+	if fileName != "default" && !stream {
+		cert := models.GetCertByFilename(fileName)
+		cert.Content = content
+		cert.Domains = strings.Join(domains, ",")
+		cert.FileName = fileName
+		cert.Proxy = proxy
+		// 以配置文件内容为准，避免数据库与磁盘不同步
+		if parsed, err := nginxconf.Parse(filePath, []byte(content)); err == nil {
+			services.FillCertFromSiteInfo(&cert, filePath, content, nginxconf.Summarize(parsed))
+		}
+		models.GetDbClient().Save(&cert)
+
+		// 手动编辑后配置文件不再由表单生成
+		if site := models.GetSiteByFilename(fileName); site.Mode == models.SiteModeForm {
+			if _, err := services.SetSiteMode(fileName, models.SiteModeRaw, nil); err != nil {
+				log.Printf("切换编辑模式出错: %v", err)
+			}
+		}
+	}
+
+	// 记录新建站点使用的模板，申请证书后据此生成 HTTPS 配置
+	if templateID != "" && fileName != "default" {
+		site := models.GetSiteByFilename(fileName)
+		site.FileName = fileName
+		if site.Mode == "" {
+			site.Mode = models.SiteModeRaw
+		}
+		site.Template = templateID
+		site.SetTemplateParams(params)
+		if err := models.GetDbClient().Save(&site).Error; err != nil {
+			log.Printf("保存站点模板出错: %v", err)
+		}
+	}
+
 	// 清除所有缓存以确保数据刷新
-	templateCacheLock.Lock()
-	templateCache = make(map[string]string)
-	templateCacheLock.Unlock()
+	clearTemplateCache()
 
-	// 重新加载nginx
-	response := services.ReloadNginx()
-	ctx.JSON(http.StatusOK, gin.H{"message": response})
+	ctx.JSON(http.StatusOK, gin.H{"message": result.Message()})
 }
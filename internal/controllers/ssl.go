@@ -1,57 +1,244 @@
 package controllers
 
 import (
+	"crypto"
+	"crypto/x509"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 	"uranus/internal/config"
 	models2 "uranus/internal/models"
 	services2 "uranus/internal/services"
 )
 
+// canSeeCert 只分配了部分站点的用户只能看到自己站点的证书，共享证书需要可以管理所有站点
+func canSeeCert(user *models2.User, fileName string, shared bool) bool {
+	if shared {
+		return user.AllSites()
+	}
+	return user.CanAccessSite(fileName)
+}
+
 func Certificates(ctx *gin.Context) {
+	currentUser := sessionUser(ctx)
 	var results []gin.H
 	for _, cert := range models2.GetCertificates() {
-		if cert.NotAfter.Unix() != -62135596800 {
-			results = append(results, gin.H{
+		if !canSeeCert(&currentUser, cert.FileName, cert.Shared) {
+			continue
+		}
+		// 共享证书申请失败时也显示，方便重新申请
+		if cert.NotAfter.Unix() != -62135596800 || cert.Shared {
+			expiredAt := "未签发"
+			if !cert.NotAfter.IsZero() {
+				expiredAt = cert.NotAfter.Format("2006-01-02")
+			}
+			result := gin.H{
 				"configName": cert.FileName,
 				"domains":    strings.Split(cert.Domains, ","),
-				"expiredAt":  cert.NotAfter.Format("2006-01-02"),
-			})
+				"expiredAt":  expiredAt,
+				"credential": cert.DNSCredentialID,
+				"acmeServer": certIssuerValue(&cert),
+				"keyType":    cert.KeyType,
+				"shared":     cert.Shared,
+				"uploaded":   cert.Uploaded,
+				"issuer":     cert.Issuer,
+				"expiring":   !cert.NotAfter.IsZero() && time.Until(cert.NotAfter) < services2.CertExpiryWarning,
+				"revoked":    cert.RevokedAt != nil,
+				"internalCA": cert.InternalCA,
+				// 自动续期状态
+				"renewFailures": cert.RenewFailures,
+				"nextRenewAt":   cert.NextRenewAt,
+				"renewAt":       cert.RenewAt,
+			}
+			if cert.Shared {
+				result["dependents"] = services2.SharedCertDependents(&cert)
+			}
+			results = append(results, result)
 		}
 	}
+
+	// 到期提醒、事件和检查结果同样只显示用户可以访问的证书
+	var expiringCerts []models2.Cert
+	for _, cert := range services2.ExpiringCerts() {
+		if canSeeCert(&currentUser, cert.FileName, cert.Shared) {
+			expiringCerts = append(expiringCerts, cert)
+		}
+	}
+	var certEvents []models2.CertEvent
+	for _, event := range models2.GetRecentCertEvents(20) {
+		if canSeeCert(&currentUser, event.FileName, event.Shared) {
+			certEvents = append(certEvents, event)
+		}
+	}
+	var renewals []models2.RenewalAttempt
+	for _, attempt := range models2.GetRecentRenewalAttempts(20) {
+		if canSeeCert(&currentUser, attempt.FileName, attempt.Shared) {
+			renewals = append(renewals, attempt)
+		}
+	}
+	tlsInspections := visibleTLSInspections(&currentUser, services2.GetTLSInspections())
+	var tlsAlerts []services2.TLSInspection
+	for _, inspection := range tlsInspections {
+		if inspection.Drift != "" {
+			tlsAlerts = append(tlsAlerts, inspection)
+		}
+	}
+
 	ctx.HTML(http.StatusOK, "ssl.html", gin.H{
-		"activePage": "ssl",
-		"results":    results,
+		"activePage":      "ssl",
+		"results":         results,
+		"dnsCredentials":  dnsCredentialViews(),
+		"dnsProviders":    services2.DNSProviders(),
+		"acmeAccounts":    services2.ACMEAccounts(),
+		"expiringCerts":   expiringCerts,
+		"internalCA":      services2.GetInternalCA(),
+		"revokeReasons":   services2.CertRevocationReasons(),
+		"certEvents":      certEvents,
+		"renewals":        renewals,
+		"tlsInspections":  tlsInspections,
+		"tlsAlerts":       tlsAlerts,
+		"renewBeforeDays": int(services2.RenewalWindow().Hours() / 24),
+		"canManageCerts":  currentUser.Can(models2.PermissionCerts),
+		"acmeServers":     acmeServerViews(),
+		"acmePresets":     services2.ACMEServerPresets(),
+		"keyTypes":        services2.ACMEKeyTypes(),
 	})
 }
 
 func IssueCert(ctx *gin.Context) {
-	domains := ctx.QueryArray("domains[]")
-	configName := ctx.Query("configName")
+	domains := ctx.PostFormArray("domains[]")
+	configName := ctx.PostForm("configName")
+	shared, _ := strconv.ParseBool(ctx.PostForm("shared"))
+	if !requireCert(ctx, configName, shared) {
+		return
+	}
+	// 从站点编辑页申请时可以同时选择验证方式
+	if credential, ok := ctx.GetPostForm("dnsCredential"); ok {
+		id, _ := strconv.ParseUint(credential, 10, 64)
+		if err := services2.SetCertDNSCredential(configName, shared, uint(id)); err != nil {
+			ctx.JSON(http.StatusOK, gin.H{"message": err.Error()})
+			return
+		}
+	}
+	// 以及签发的 CA 和私钥类型
+	if server, ok := ctx.GetPostForm("acmeServer"); ok {
+		id, internalCA := parseCertIssuer(server)
+		if err := services2.SetCertIssuer(configName, shared, id, internalCA, ctx.PostForm("keyType")); err != nil {
+			ctx.JSON(http.StatusOK, gin.H{"message": err.Error()})
+			return
+		}
+	}
 	message := "OK"
-	err := services2.IssueCert(domains, configName)
+	var err error
+	if shared {
+		err = services2.RenewSharedCert(configName)
+	} else {
+		err = services2.IssueCert(domains, configName)
+	}
+	response := gin.H{}
 	if err != nil {
 		message = err.Error()
+		// 检查没有通过时返回每个域名的检查结果
+		var readinessErr *services2.ReadinessError
+		if errors.As(err, &readinessErr) {
+			response["readiness"] = readinessErr.Report
+		}
+	}
+	response["message"] = message
+	ctx.JSON(http.StatusOK, response)
+}
+
+// CheckCertReadiness 申请证书前检查域名解析、/.well-known 转发、验证端口或 DNS 凭据
+func CheckCertReadiness(ctx *gin.Context) {
+	// GET 只做只读检查；POST 需要证书权限，会用 DNS 凭据创建并删除一条 TXT 记录
+	testDNS := ctx.Request.Method == http.MethodPost
+	param, array := ctx.Query, ctx.QueryArray
+	if testDNS {
+		param, array = ctx.PostForm, ctx.PostFormArray
+	}
+	configName := ctx.Param("name")
+	if configName == "" {
+		configName = param("configName")
+	}
+	shared, _ := strconv.ParseBool(param("shared"))
+	if !requireCert(ctx, configName, shared) {
+		return
+	}
+	report, err := services2.CheckCertReadiness(configName, shared, cleanDomains(array("domains[]")), testDNS)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
 	}
-	ctx.JSON(http.StatusOK, gin.H{"message": message})
+	ctx.JSON(http.StatusOK, report)
 }
 
+// CertInfo 使用 SNI 连接 nginx 检查域名实际返回的证书，address 为空时连接本机 443 端口
 func CertInfo(ctx *gin.Context) {
-	domain := ctx.Query("domain")
-	certInfo := services2.GetCertificateInfo(domain)
+	address := strings.TrimSpace(ctx.Query("address"))
+	if user := sessionUser(ctx); !certInfoAddressAllowed(&user, address) {
+		ctx.JSON(http.StatusForbidden, gin.H{"message": "只能检查站点自己的 HTTPS 地址"})
+		return
+	}
+	result := services2.InspectTLS(strings.TrimSpace(ctx.Query("domain")), address)
+	if result.Error != "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": result.Error, "inspection": result})
+		return
+	}
+	leaf := result.Chain[0]
 	ctx.JSON(http.StatusOK, gin.H{
-		"domain":    certInfo.Subject.CommonName,
-		"issuer":    certInfo.Issuer.CommonName,
-		"not_after": certInfo.NotAfter,
+		"domain":     leaf.Subject,
+		"issuer":     leaf.Issuer,
+		"not_after":  leaf.NotAfter,
+		"inspection": result,
 	})
 }
 
+// certInfoAddressAllowed 只读用户只能连接本机默认地址或自己站点的 HTTPS 地址，
+// 连接其他地址需要证书管理权限，避免通过服务器访问任意 host:port
+func certInfoAddressAllowed(user *models2.User, address string) bool {
+	if address == "" || user.Can(models2.PermissionCerts) {
+		return true
+	}
+	for _, cert := range models2.GetCertificates() {
+		if !cert.Shared && user.CanAccessSite(cert.FileName) && services2.SiteTLSAddress(&cert) == address {
+			return true
+		}
+	}
+	return false
+}
+
+// visibleTLSInspections 只返回用户可以访问的站点的检查结果
+func visibleTLSInspections(user *models2.User, inspections []services2.TLSInspection) []services2.TLSInspection {
+	visible := []services2.TLSInspection{}
+	for _, inspection := range inspections {
+		if user.CanAccessSite(inspection.ConfigName) {
+			visible = append(visible, inspection)
+		}
+	}
+	return visible
+}
+
+// InspectTLS 立即检查所有 HTTPS 站点实际返回的证书
+func InspectTLS(ctx *gin.Context) {
+	user := sessionUser(ctx)
+	ctx.JSON(http.StatusOK, visibleTLSInspections(&user, services2.InspectAllSites()))
+}
+
+// TLSInspections 最近一次 TLS 检查的结果
+func TLSInspections(ctx *gin.Context) {
+	user := sessionUser(ctx)
+	ctx.JSON(http.StatusOK, visibleTLSInspections(&user, services2.GetTLSInspections()))
+}
+
 func DeleteSSL(ctx *gin.Context) {
-	configName := ctx.Query("configName")
+	configName := ctx.PostForm("configName")
 
 	// 验证 configName 防止路径遍历攻击
 	if configName == "" || strings.Contains(configName, "..") || strings.Contains(configName, "/") || strings.Contains(configName, "\\") {
@@ -59,6 +246,19 @@ func DeleteSSL(ctx *gin.Context) {
 		return
 	}
 
+	shared, _ := strconv.ParseBool(ctx.PostForm("shared"))
+	if !requireCert(ctx, configName, shared) {
+		return
+	}
+	if shared {
+		if err := services2.DeleteSharedCert(configName); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.Redirect(http.StatusFound, "/admin/ssl")
+		return
+	}
+
 	cert := models2.GetCertByFilename(configName)
 	if cert.ID == 0 {
 		ctx.JSON(http.StatusNotFound, gin.H{"error": "Certificate not found"})
@@ -87,3 +287,162 @@ func DeleteSSL(ctx *gin.Context) {
 
 	ctx.Redirect(http.StatusFound, "/admin/ssl")
 }
+
+// CreateSharedCert 新建共享证书，例如 *.example.com，站点可以在模板中引用
+func CreateSharedCert(ctx *gin.Context) {
+	if !requireAllSites(ctx) {
+		return
+	}
+	var request struct {
+		Name          string   `json:"name"`
+		Domains       []string `json:"domains"`
+		DNSCredential uint     `json:"dnsCredential"`
+		ACMEServer    string   `json:"acmeServer"`
+		KeyType       string   `json:"keyType"`
+	}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	serverID, internalCA := parseCertIssuer(request.ACMEServer)
+	if err := services2.CreateSharedCert(request.Name, cleanDomains(request.Domains), request.DNSCredential,
+		serverID, internalCA, request.KeyType); err != nil {
+		log.Printf("申请共享证书出错: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+// RotateACMEAccountKey 更换 ACME 账户私钥
+func RotateACMEAccountKey(ctx *gin.Context) {
+	if !requireAllSites(ctx) {
+		return
+	}
+	if err := services2.RotateACMEAccountKey(ctx.PostForm("caDirUrl"), ctx.PostForm("email")); err != nil {
+		log.Printf("更换 ACME 账户私钥出错: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+// readUploadedFile 读取表单中上传的文件，没有上传时返回 nil
+func readUploadedFile(ctx *gin.Context, field string) ([]byte, error) {
+	header, err := ctx.FormFile(field)
+	if err != nil {
+		return nil, nil
+	}
+	if header.Size > 1<<20 {
+		return nil, errors.New(header.Filename + " 文件太大")
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// UploadCert 上传证书，支持 PEM 格式的证书、证书链和私钥，或者 PKCS#12 文件
+func UploadCert(ctx *gin.Context) {
+	if !requireAllSites(ctx) {
+		return
+	}
+	var certificates []*x509.Certificate
+	var key crypto.PrivateKey
+	fail := func(err error) {
+		log.Printf("上传证书出错: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	}
+
+	files := map[string][]byte{}
+	for _, field := range []string{"certificate", "chain", "key", "pkcs12"} {
+		data, err := readUploadedFile(ctx, field)
+		if err != nil {
+			fail(err)
+			return
+		}
+		files[field] = data
+	}
+
+	var err error
+	if files["pkcs12"] != nil {
+		certificates, key, err = services2.ParsePKCS12(files["pkcs12"], ctx.PostForm("password"))
+	} else if files["certificate"] == nil || files["key"] == nil {
+		err = errors.New("请上传证书和私钥，或者 PKCS#12 文件")
+	} else if certificates, err = services2.ParseCertificatePEM(files["certificate"], files["chain"]); err == nil {
+		key, err = services2.ParsePrivateKeyPEM(files["key"])
+	}
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	if err := services2.UploadCert(ctx.PostForm("name"), certificates, key); err != nil {
+		fail(err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+// certActionRequest 吊销、轮换私钥的参数
+type certActionRequest struct {
+	Shared    bool `json:"shared"`
+	Reason    uint `json:"reason"`
+	RevokeOld bool `json:"revokeOld"` // 轮换私钥后吊销旧证书
+}
+
+// RevokeCert 吊销证书
+func RevokeCert(ctx *gin.Context) {
+	var request certActionRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !requireCert(ctx, ctx.Param("name"), request.Shared) {
+		return
+	}
+	if err := services2.RevokeCert(ctx.Param("name"), request.Shared, request.Reason, currentUser(ctx), requestSource(ctx)); err != nil {
+		log.Printf("吊销证书出错: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+// RotateCertKey 轮换私钥并重新签发证书
+func RotateCertKey(ctx *gin.Context) {
+	var request certActionRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if !requireCert(ctx, ctx.Param("name"), request.Shared) {
+		return
+	}
+	if err := services2.RotateCertKey(ctx.Param("name"), request.Shared, request.RevokeOld, request.Reason, currentUser(ctx), requestSource(ctx)); err != nil {
+		log.Printf("轮换证书私钥出错: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
+
+// CertEvents 证书的吊销、轮换记录
+func CertEvents(ctx *gin.Context) {
+	shared, _ := strconv.ParseBool(ctx.Query("shared"))
+	if !requireCert(ctx, ctx.Param("name"), shared) {
+		return
+	}
+	ctx.JSON(http.StatusOK, models2.GetCertEvents(ctx.Param("name"), shared))
+}
+
+// RenewalAttempts 证书的自动续期记录
+func RenewalAttempts(ctx *gin.Context) {
+	shared, _ := strconv.ParseBool(ctx.Query("shared"))
+	if !requireCert(ctx, ctx.Param("name"), shared) {
+		return
+	}
+	ctx.JSON(http.StatusOK, models2.GetRenewalAttempts(ctx.Param("name"), shared, 50))
+}
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"uranus/internal/models"
+	"uranus/internal/services"
+)
+
+// customTemplateView 模板编辑器提交和展示的数据
+type customTemplateView struct {
+	ID          uint                   `json:"id"`
+	Slug        string                 `json:"slug"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Stream      bool                   `json:"stream"`
+	Inputs      []models.TemplateInput `json:"inputs"`
+	Content     string                 `json:"content"`
+	Version     int                    `json:"version"`
+	Author      string                 `json:"author"`
+	UpdatedAt   time.Time              `json:"updatedAt"`
+	HistoryFile string                 `json:"historyFile"`
+}
+
+// SiteTemplates 站点模板管理页面，内置模板只读
+func SiteTemplates(ctx *gin.Context) {
+	var builtins []services.SiteTemplate
+	for _, t := range services.SiteTemplates() {
+		if t.BuiltIn {
+			builtins = append(builtins, t)
+		}
+	}
+	custom := []customTemplateView{}
+	for _, t := range models.GetCustomTemplates() {
+		custom = append(custom, customTemplateView{
+			ID:          t.ID,
+			Slug:        t.Slug,
+			Name:        t.Name,
+			Description: t.Description,
+			Stream:      t.Stream,
+			Inputs:      t.GetInputs(),
+			Content:     t.Content,
+			Version:     t.Version,
+			Author:      t.Author,
+			UpdatedAt:   t.UpdatedAt,
+			HistoryFile: services.CustomTemplateFile(t.Slug),
+		})
+	}
+	ctx.HTML(http.StatusOK, "templates.html", gin.H{
+		"activePage": "templates",
+		"builtins":   builtins,
+		"custom":     custom,
+	})
+}
+
+// PreviewCustomTemplate 用示例参数生成配置，检查模板是否可用
+func PreviewCustomTemplate(ctx *gin.Context) {
+	var request customTemplateView
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if request.Slug == "" {
+		request.Slug = "preview"
+	}
+	siteTemplate := services.SiteTemplate{
+		ID:      request.Slug,
+		Stream:  request.Stream,
+		Inputs:  request.Inputs,
+		Content: request.Content,
+	}
+	ssl, _ := strconv.ParseBool(ctx.Query("ssl"))
+	content, err := siteTemplate.Preview(ssl)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK", "content": content})
+}
+
+// SaveCustomTemplate 新建或修改自定义模板，每次保存生成一个新版本
+func SaveCustomTemplate(ctx *gin.Context) {
+	if !requireAllSites(ctx) {
+		return
+	}
+	var request customTemplateView
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	template := models.CustomTemplate{
+		Slug:        request.Slug,
+		Name:        request.Name,
+		Description: request.Description,
+		Stream:      request.Stream,
+		Content:     request.Content,
+	}
+	template.ID = request.ID
+	if err := services.SaveCustomTemplate(&template, request.Inputs, currentUser(ctx), requestSource(ctx)); err != nil {
+		log.Printf("保存模板出错: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	clearTemplateCache()
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK", "version": template.Version})
+}
+
+// DeleteCustomTemplate 删除自定义模板
+func DeleteCustomTemplate(ctx *gin.Context) {
+	if !requireAllSites(ctx) {
+		return
+	}
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "无效的 ID"})
+		return
+	}
+	if err := services.DeleteCustomTemplate(uint(id)); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	clearTemplateCache()
+	ctx.JSON(http.StatusOK, gin.H{"message": "OK"})
+}
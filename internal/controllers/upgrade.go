@@ -0,0 +1,23 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"runtime"
+	"uranus/internal/services"
+)
+
+// Upgrade 页面上的升级按钮，下载新版本并重启
+func Upgrade(ctx *gin.Context) {
+	log.Printf("[升级] %s 从页面发起升级", currentUser(ctx))
+	go func() {
+		if err := services.ToUpdateProgram("https://fr.qfdk.me/uranus/uranus-" + runtime.GOARCH); err != nil {
+			log.Printf("[升级] 升级过程出错: %v", err)
+		}
+	}()
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  "OK",
+		"message": "升级请求已接收，正在处理中",
+	})
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"strconv"
+	"uranus/internal/models"
+	"uranus/internal/services"
+)
+
+// Upstreams 负载均衡服务器池页面
+func Upstreams(ctx *gin.Context) {
+	ctx.HTML(http.StatusOK, "upstreams.html", gin.H{
+		"activePage": "upstreams",
+		"pools":      models.GetUpstreamPools(),
+	})
+}
+
+// UpstreamStatus 所有服务器池及后端的健康状态
+func UpstreamStatus(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, services.GetUpstreamStatus())
+}
+
+// SaveUpstreamPool 新建或修改服务器池
+func SaveUpstreamPool(ctx *gin.Context) {
+	if !requireAllSites(ctx) {
+		return
+	}
+	var pool models.UpstreamPool
+	if err := ctx.ShouldBindJSON(&pool); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	result, err := services.SaveUpstreamPool(&pool, currentUser(ctx), requestSource(ctx))
+	if err != nil {
+		log.Printf("保存服务器池出错: %v", err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": result.Message(),
+		"file":    services.UpstreamsFile(),
+		"issues":  result.Issues,
+	})
+}
+
+// DeleteUpstreamPool 删除服务器池
+func DeleteUpstreamPool(ctx *gin.Context) {
+	if !requireAllSites(ctx) {
+		return
+	}
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "无效的 ID"})
+		return
+	}
+
+	result, err := services.DeleteUpstreamPool(uint(id), currentUser(ctx), requestSource(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": result.Message()})
+}
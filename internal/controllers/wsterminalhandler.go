@@ -3,6 +3,8 @@ package controllers
 import (
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
 	"uranus/internal/config"
 	"uranus/internal/wsterminal"
 
@@ -14,9 +16,31 @@ import (
 var wsUpgrader = websocket.Upgrader{
 	ReadBufferSize:  4096,
 	WriteBufferSize: 4096,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for now
-	},
+	CheckOrigin:     sameOrigin,
+}
+
+// sameOrigin 只允许 Uranus 自己的页面打开终端。握手是 GET 请求，不经过 CSRF 检查，
+// 同一台 nginx 上的其他站点也会带上会话 Cookie，所以必须检查 Origin。
+// 没有 Origin 的请求不是来自浏览器页面
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	if strings.EqualFold(parsed.Host, r.Host) {
+		return true
+	}
+	// 反向代理转发时浏览器访问的是代理的地址
+	forwarded := r.Header.Get("X-Forwarded-Host")
+	if forwarded != "" && strings.EqualFold(parsed.Host, strings.TrimSpace(strings.Split(forwarded, ",")[0])) {
+		return true
+	}
+	log.Printf("[TERMINAL] Rejected WebSocket from origin %s (host %s)", origin, r.Host)
+	return false
 }
 
 // WebSocketTerminalHandler handles WebSocket connections for the terminal
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// ACMEServer 自定义的 ACME 服务器，例如 ZeroSSL、Buypass、内网 step-ca 或测试用的 pebble
+type ACMEServer struct {
+	gorm.Model
+	Name         string `json:"name" gorm:"uniqueIndex"`
+	DirectoryURL string `json:"directoryUrl"`
+	// External Account Binding，ZeroSSL 等 CA 注册账户时需要，HMAC 加密保存
+	EABKeyID   string `json:"eabKeyId"`
+	EABHMACKey string `json:"-"`
+	// 信任的根证书 (PEM 文件路径)，CA 使用自签名证书时填写，例如 step-ca、pebble
+	RootCA  string `json:"rootCa"`
+	KeyType string `json:"keyType"` // 证书私钥类型，空为 RSA2048
+	// 默认 CA，没有单独设置的证书都使用它，没有默认 CA 时使用 Let's Encrypt
+	IsDefault bool `json:"isDefault" gorm:"default:false"`
+}
+
+// GetACMEServers 获取所有 ACME 服务器
+func GetACMEServers() (servers []ACMEServer) {
+	GetDbClient().Order("name").Find(&servers)
+	return
+}
+
+// GetACMEServerByID 根据 ID 获取 ACME 服务器
+func GetACMEServerByID(id uint) (server ACMEServer) {
+	if id == 0 {
+		return
+	}
+	GetDbClient().Find(&server, id)
+	return
+}
+
+// GetDefaultACMEServer 获取默认的 ACME 服务器，没有设置时 ID 为 0
+func GetDefaultACMEServer() (server ACMEServer) {
+	GetDbClient().Find(&server, "is_default = ?", true)
+	return
+}
+
+// Remove 从数据库中删除 ACME 服务器
+func (s *ACMEServer) Remove() error {
+	return GetDbClient().Unscoped().Delete(&ACMEServer{}, s.ID).Error
+}
+
+// GetCertsUsingACMEServer 使用某个 ACME 服务器签发的证书
+func GetCertsUsingACMEServer(id uint) (certs []Cert) {
+	GetDbClient().Find(&certs, "acme_server_id = ?", id)
+	return
+}
@@ -14,6 +14,31 @@ type Cert struct {
 	Domains  string    `json:"domains"`
 	FileName string    `json:"fileName"`
 	Proxy    string    `json:"proxy"`
+	// 申请证书使用的验证方式，空为 HTTP-01，设置凭据后使用 DNS-01
+	DNSCredentialID uint `json:"dnsCredentialId"`
+	// 签发证书的 CA 和私钥类型，为空时使用默认 CA 的设置
+	ACMEServerID uint   `json:"acmeServerId"`
+	KeyType      string `json:"keyType"`
+	// 由内置的内部 CA 签发，用于测试环境和内网站点，不需要 ACME 验证
+	InternalCA bool `json:"internalCa" gorm:"default:false"`
+	// 证书已在 CA 吊销，重新签发后清空，吊销后不再自动续期
+	RevokedAt *time.Time `json:"revokedAt"`
+	// 自动续期状态，连续失败时按指数退避重试，签发成功后清空
+	RenewFailures int        `json:"renewFailures" gorm:"default:0"`
+	NextRenewAt   *time.Time `json:"nextRenewAt"`
+	// CA 通过 ARI 建议的续期时间，在建议窗口内随机选择，ARICheckedAt 为上次查询时间
+	RenewAt      *time.Time `json:"renewAt"`
+	ARICheckedAt *time.Time `json:"ariCheckedAt"`
+	// 共享证书 (例如通配符证书) 不属于某个站点，FileName 为证书名称，可以被多个站点引用
+	Shared bool `json:"shared" gorm:"default:false"`
+	// 上传的证书 (商业证书或其他 CA 签发) 保存为共享证书，不自动续期，到期前提醒重新上传
+	Uploaded bool   `json:"uploaded" gorm:"default:false"`
+	Issuer   string `json:"issuer"`
+	// 以下字段由站点导入/同步任务从配置文件中读取
+	FilePath          string `json:"filePath"`
+	Listen            string `json:"listen"`
+	SSLCertificate    string `json:"sslCertificate"`
+	SSLCertificateKey string `json:"sslCertificateKey"`
 }
 
 // GetCertificates 获取所有证书
@@ -28,11 +53,29 @@ func GetCertByFilename(filename string) (cert Cert) {
 	if strings.HasSuffix(filename, ".conf") {
 		filename = strings.TrimSuffix(filename, ".conf")
 	}
-	GetDbClient().Find(&cert, "file_name = ?", filename)
+	GetDbClient().Find(&cert, "file_name = ? AND shared = ?", filename, false)
+	return
+}
+
+// GetSharedCerts 获取所有共享证书
+func GetSharedCerts() (certs []Cert) {
+	GetDbClient().Order("file_name").Find(&certs, "shared = ?", true)
+	return
+}
+
+// GetSharedCert 根据名称获取共享证书
+func GetSharedCert(name string) (cert Cert) {
+	GetDbClient().Find(&cert, "file_name = ? AND shared = ?", name, true)
+	return
+}
+
+// GetCertsUsingCertDir 配置文件中的 ssl_certificate 位于某个目录下的站点
+func GetCertsUsingCertDir(dir string) (certs []Cert) {
+	GetDbClient().Find(&certs, "shared = ? AND ssl_certificate LIKE ?", false, strings.TrimSuffix(dir, "/")+"/%")
 	return
 }
 
 // Remove 从数据库中删除证书
 func (c *Cert) Remove() error {
-	return GetDbClient().Where("file_name", c.FileName).Unscoped().Delete(c).Error
+	return GetDbClient().Where("file_name = ? AND shared = ?", c.FileName, c.Shared).Unscoped().Delete(c).Error
 }
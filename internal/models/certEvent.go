@@ -0,0 +1,39 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// 证书操作类型
+const (
+	CertActionRevoke = "revoke"
+	CertActionRotate = "rotate"
+)
+
+// CertEvent 证书吊销、轮换私钥等操作的审计记录
+type CertEvent struct {
+	gorm.Model
+	FileName string `json:"fileName" gorm:"index"`
+	Shared   bool   `json:"shared"`
+	Action   string `json:"action"`
+	Reason   uint   `json:"reason"` // 吊销原因，RFC 5280 CRLReason
+	// 操作前后的证书序列号，轮换时 NewSerial 为新证书
+	Serial    string `json:"serial"`
+	NewSerial string `json:"newSerial"`
+	Success   bool   `json:"success"`
+	Message   string `json:"message"`
+	Author    string `json:"author"`
+	Source    string `json:"source"`
+}
+
+// GetCertEvents 获取某个证书的操作记录，最新的在前
+func GetCertEvents(fileName string, shared bool) (events []CertEvent) {
+	GetDbClient().Where("file_name = ? AND shared = ?", fileName, shared).Order("id desc").Find(&events)
+	return
+}
+
+// GetRecentCertEvents 获取最近的证书操作记录
+func GetRecentCertEvents(limit int) (events []CertEvent) {
+	GetDbClient().Order("id desc").Limit(limit).Find(&events)
+	return
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// DNSCredential DNS 服务商的 API 凭据，证书使用 DNS-01 验证时引用
+type DNSCredential struct {
+	gorm.Model
+	Name     string `json:"name" gorm:"uniqueIndex"`
+	Provider string `json:"provider"` // lego 的 DNS provider 名称，例如 rfc2136
+	Values   string `json:"-"`        // 环境变量名到值的 JSON，包含密钥，加密保存，不返回给页面
+	// 检查 TXT 记录是否生效时使用的递归 DNS，逗号分隔，留空使用系统配置
+	Resolvers string `json:"resolvers"`
+}
+
+// GetDNSCredentials 获取所有 DNS 凭据
+func GetDNSCredentials() (credentials []DNSCredential) {
+	GetDbClient().Order("name").Find(&credentials)
+	return
+}
+
+// GetDNSCredentialByID 根据 ID 获取 DNS 凭据
+func GetDNSCredentialByID(id uint) (credential DNSCredential) {
+	if id == 0 {
+		return
+	}
+	GetDbClient().Find(&credential, id)
+	return
+}
+
+// Remove 从数据库中删除凭据
+func (c *DNSCredential) Remove() error {
+	return GetDbClient().Unscoped().Delete(&DNSCredential{}, c.ID).Error
+}
+
+// GetCertsUsingDNSCredential 使用某个凭据做 DNS-01 验证的证书
+func GetCertsUsingDNSCredential(id uint) (certs []Cert) {
+	GetDbClient().Find(&certs, "dns_credential_id = ?", id)
+	return
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// Maintenance 站点维护模式设置
+type Maintenance struct {
+	gorm.Model
+	FileName  string     `json:"fileName" gorm:"uniqueIndex"`
+	Enabled   bool       `json:"enabled"`
+	HTML      string     `json:"html"`
+	Allowlist string     `json:"allowlist"` // 可以绕过维护页面的 IP/CIDR，逗号或换行分隔
+	StartAt   *time.Time `json:"startAt"`   // 为空表示立即开始
+	EndAt     *time.Time `json:"endAt"`     // 为空表示手动关闭
+	Active    bool       `json:"active"`    // 当前是否已在 nginx 中生效
+}
+
+// ShouldBeActive 根据开关和计划时间判断此刻是否应处于维护状态
+func (m *Maintenance) ShouldBeActive(now time.Time) bool {
+	if !m.Enabled {
+		return false
+	}
+	if m.StartAt != nil && now.Before(*m.StartAt) {
+		return false
+	}
+	if m.EndAt != nil && !now.Before(*m.EndAt) {
+		return false
+	}
+	return true
+}
+
+// AllowlistEntries 返回白名单中的每一项
+func (m *Maintenance) AllowlistEntries() []string {
+	var entries []string
+	for _, entry := range strings.FieldsFunc(m.Allowlist, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r' || r == ' '
+	}) {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// GetMaintenances 获取所有维护模式设置
+func GetMaintenances() (maintenances []Maintenance) {
+	GetDbClient().Order("file_name").Find(&maintenances)
+	return
+}
+
+// GetMaintenanceByFilename 根据文件名获取维护模式设置
+func GetMaintenanceByFilename(filename string) (maintenance Maintenance) {
+	filename = strings.TrimSuffix(filename, ".conf")
+	GetDbClient().Find(&maintenance, "file_name = ?", filename)
+	return
+}
+
+// Remove 删除维护模式设置
+func (m *Maintenance) Remove() error {
+	if m.FileName == "" {
+		return nil
+	}
+	return GetDbClient().Where("file_name = ?", m.FileName).Unscoped().Delete(&Maintenance{}).Error
+}
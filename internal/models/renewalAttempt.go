@@ -0,0 +1,48 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// 自动续期的结果
+const (
+	RenewalOutcomeSuccess = "success"
+	RenewalOutcomeFailed  = "failed"
+)
+
+// 触发续期的原因
+const (
+	RenewalTriggerWindow = "window" // 进入配置的续期窗口
+	RenewalTriggerARI    = "ari"    // CA 通过 ARI 建议的续期时间
+	RenewalTriggerRetry  = "retry"  // 上次续期失败后重试
+)
+
+// RenewalAttempt 自动续期的每一次尝试，失败时保存错误和下次重试时间
+type RenewalAttempt struct {
+	gorm.Model
+	FileName string `json:"fileName" gorm:"index"`
+	Shared   bool   `json:"shared"`
+	// 连续失败后的第几次尝试，从 1 开始
+	Attempt int    `json:"attempt"`
+	Trigger string `json:"trigger"`
+	Outcome string `json:"outcome"`
+	Error   string `json:"error"`
+	// 续期前后证书的到期时间
+	NotAfter    time.Time  `json:"notAfter"`
+	NewNotAfter *time.Time `json:"newNotAfter"`
+	Duration    int64      `json:"duration"` // 毫秒
+	NextRetryAt *time.Time `json:"nextRetryAt"`
+}
+
+// GetRenewalAttempts 获取某个证书的续期记录，最新的在前
+func GetRenewalAttempts(fileName string, shared bool, limit int) (attempts []RenewalAttempt) {
+	GetDbClient().Where("file_name = ? AND shared = ?", fileName, shared).Order("id desc").Limit(limit).Find(&attempts)
+	return
+}
+
+// GetRecentRenewalAttempts 获取最近的续期记录
+func GetRecentRenewalAttempts(limit int) (attempts []RenewalAttempt) {
+	GetDbClient().Order("id desc").Limit(limit).Find(&attempts)
+	return
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Revision 配置文件的历史版本
+type Revision struct {
+	gorm.Model
+	FilePath string `json:"filePath" gorm:"index"`
+	Content  string `json:"content"`
+	Diff     string `json:"diff"`
+	Author   string `json:"author"`
+	Source   string `json:"source"`
+}
+
+// 配置变更来源
+const (
+	RevisionSourceWeb  = "web"
+	RevisionSourceMQTT = "mqtt"
+	RevisionSourceAPI  = "api"
+	RevisionSourceDisk = "disk"
+	// 按计划时间自动执行的变更
+	RevisionSourceSchedule = "schedule"
+)
+
+// GetRevisions 获取某个文件的所有历史版本，最新的在前
+func GetRevisions(filePath string) (revisions []Revision) {
+	GetDbClient().Where("file_path = ?", filePath).Order("id desc").Find(&revisions)
+	return
+}
+
+// GetRevisionFiles 获取所有有历史版本的文件
+func GetRevisionFiles() (files []string) {
+	GetDbClient().Model(&Revision{}).Distinct().Order("file_path").Pluck("file_path", &files)
+	return
+}
+
+// GetRevisionByID 根据ID获取历史版本
+func GetRevisionByID(id uint) (revision Revision) {
+	GetDbClient().First(&revision, id)
+	return
+}
+
+// GetLatestRevision 获取某个文件最新的历史版本
+func GetLatestRevision(filePath string) (revision Revision) {
+	GetDbClient().Where("file_path = ?", filePath).Order("id desc").Limit(1).Find(&revision)
+	return
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Session 服务端记录的登录会话。Cookie 中保存随机令牌，数据库只保存 SHA-256，
+// 记录被删除或超时后 Cookie 立即失效
+type Session struct {
+	gorm.Model
+	TokenHash  string    `json:"-" gorm:"uniqueIndex"`
+	UserID     uint      `json:"userId" gorm:"index"`
+	Username   string    `json:"username"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"userAgent"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// GetSessions 所有未过期的会话，最近活动的在前
+func GetSessions() (sessions []Session) {
+	GetDbClient().Where("expires_at > ?", time.Now()).Order("last_seen_at desc").Find(&sessions)
+	return
+}
+
+// GetSessionByHash 根据令牌哈希获取会话
+func GetSessionByHash(tokenHash string) (session Session) {
+	GetDbClient().Where("token_hash = ?", tokenHash).Find(&session)
+	return
+}
+
+// RemoveUserSessions 删除用户的所有会话，exceptHash 不为空时保留该会话
+func RemoveUserSessions(userID uint, exceptHash string) error {
+	return GetDbClient().Unscoped().Where("user_id = ? AND token_hash <> ?", userID, exceptHash).Delete(&Session{}).Error
+}
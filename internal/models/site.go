@@ -0,0 +1,115 @@
+package models
+
+import (
+	"encoding/json"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// 站点编辑模式
+const (
+	SiteModeForm = "form" // 由 SiteSpec 生成配置文件
+	SiteModeRaw  = "raw"  // 手动编辑配置文件
+)
+
+// Site 结构化的站点配置，Spec 以 JSON 保存 SiteSpec
+type Site struct {
+	gorm.Model
+	FileName string `json:"fileName" gorm:"uniqueIndex"`
+	Mode     string `json:"mode"`
+	Spec     string `json:"-"`
+	// 新建站点时使用的模板和参数，申请证书后用于重新生成 HTTPS 配置
+	Template       string `json:"template"`
+	TemplateParams string `json:"-"`
+}
+
+// SiteSpec 表单模式下的站点定义
+type SiteSpec struct {
+	Domains           []string       `json:"domains"`
+	SSL               bool           `json:"ssl"`
+	SSLCertificate    string         `json:"sslCertificate"`
+	SSLCertificateKey string         `json:"sslCertificateKey"`
+	ForceHTTPS        bool           `json:"forceHttps"`
+	HSTS              bool           `json:"hsts"`
+	ClientMaxBodySize string         `json:"clientMaxBodySize"`
+	Locations         []SiteLocation `json:"locations"`
+	Redirects         []SiteRedirect `json:"redirects"`
+	Snippet           string         `json:"snippet"`
+}
+
+// SiteLocation 一个 location，Upstreams 有多个地址时生成 upstream 块，
+// 指定 Pool 时反代到负载均衡页面管理的服务器池
+type SiteLocation struct {
+	Path           string       `json:"path"`
+	Upstreams      []string     `json:"upstreams"`
+	Pool           string       `json:"pool"`
+	Headers        []SiteHeader `json:"headers"`
+	WebSocket      bool         `json:"websocket"`
+	ConnectTimeout string       `json:"connectTimeout"`
+	ReadTimeout    string       `json:"readTimeout"`
+	SendTimeout    string       `json:"sendTimeout"`
+	Snippet        string       `json:"snippet"`
+}
+
+// SiteHeader 传给后端的请求头
+type SiteHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// SiteRedirect 路径跳转
+type SiteRedirect struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Code int    `json:"code"`
+}
+
+// GetSiteByFilename 根据文件名获取站点
+func GetSiteByFilename(filename string) (site Site) {
+	filename = strings.TrimSuffix(filename, ".conf")
+	GetDbClient().Find(&site, "file_name = ?", filename)
+	return
+}
+
+// GetSiteSpec 解析保存的 SiteSpec
+func (s *Site) GetSiteSpec() (*SiteSpec, error) {
+	spec := &SiteSpec{}
+	if s.Spec == "" {
+		return spec, nil
+	}
+	err := json.Unmarshal([]byte(s.Spec), spec)
+	return spec, err
+}
+
+// SetSiteSpec 保存 SiteSpec
+func (s *Site) SetSiteSpec(spec *SiteSpec) error {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	s.Spec = string(data)
+	return nil
+}
+
+// GetTemplateParams 解析保存的模板参数
+func (s *Site) GetTemplateParams() map[string]string {
+	params := map[string]string{}
+	if s.TemplateParams != "" {
+		_ = json.Unmarshal([]byte(s.TemplateParams), &params)
+	}
+	return params
+}
+
+// SetTemplateParams 保存模板参数
+func (s *Site) SetTemplateParams(params map[string]string) {
+	data, _ := json.Marshal(params)
+	s.TemplateParams = string(data)
+}
+
+// Remove 从数据库中删除站点
+func (s *Site) Remove() error {
+	if s.FileName == "" {
+		return nil
+	}
+	return GetDbClient().Where("file_name = ?", s.FileName).Unscoped().Delete(&Site{}).Error
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"encoding/json"
+	"gorm.io/gorm"
+)
+
+// TemplateInput 模板需要填写的参数，domains 和 proxy 对应页面上的域名和反代地址，
+// 其他参数在模板中通过 .Params.名称 使用
+type TemplateInput struct {
+	Name        string   `json:"name"`
+	Label       string   `json:"label"`
+	Type        string   `json:"type"`
+	Default     string   `json:"default"`
+	Placeholder string   `json:"placeholder"`
+	Required    bool     `json:"required"`
+	Options     []string `json:"options"`
+}
+
+// CustomTemplate 用户自定义的站点模板，Content 为 text/template 语法，
+// 同时保存在磁盘上，历史版本记录在 Revision 中
+type CustomTemplate struct {
+	gorm.Model
+	Slug        string `json:"slug" gorm:"uniqueIndex"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Stream      bool   `json:"stream"`
+	Inputs      string `json:"-"`
+	Content     string `json:"content"`
+	Version     int    `json:"version"`
+	Author      string `json:"author"`
+}
+
+// GetCustomTemplates 获取所有自定义模板
+func GetCustomTemplates() (templates []CustomTemplate) {
+	GetDbClient().Order("slug").Find(&templates)
+	return
+}
+
+// GetCustomTemplateByID 根据 ID 获取自定义模板
+func GetCustomTemplateByID(id uint) (template CustomTemplate) {
+	if id == 0 {
+		return
+	}
+	GetDbClient().First(&template, id)
+	return
+}
+
+// GetCustomTemplateBySlug 根据模板 ID 获取自定义模板
+func GetCustomTemplateBySlug(slug string) (template CustomTemplate) {
+	GetDbClient().Find(&template, "slug = ?", slug)
+	return
+}
+
+// GetInputs 解析保存的参数定义
+func (t *CustomTemplate) GetInputs() []TemplateInput {
+	inputs := []TemplateInput{}
+	if t.Inputs != "" {
+		_ = json.Unmarshal([]byte(t.Inputs), &inputs)
+	}
+	return inputs
+}
+
+// SetInputs 保存参数定义
+func (t *CustomTemplate) SetInputs(inputs []TemplateInput) {
+	data, _ := json.Marshal(inputs)
+	t.Inputs = string(data)
+}
+
+// Remove 从数据库中删除模板
+func (t *CustomTemplate) Remove() error {
+	return GetDbClient().Unscoped().Delete(&CustomTemplate{}, t.ID).Error
+}
+
+// GetSitesUsingTemplate 使用某个模板新建的站点
+func GetSitesUsingTemplate(slug string) (sites []Site) {
+	GetDbClient().Find(&sites, "template = ?", slug)
+	return
+}
@@ -50,6 +50,20 @@ func InitWithContext(ctx context.Context) {
 
 		// Auto migrate models
 		AutoMigrate(&Cert{})
+		AutoMigrate(&Revision{})
+		AutoMigrate(&Site{})
+		AutoMigrate(&UpstreamPool{})
+		AutoMigrate(&UpstreamMember{})
+		AutoMigrate(&Maintenance{})
+		AutoMigrate(&CustomTemplate{})
+		AutoMigrate(&DNSCredential{})
+		AutoMigrate(&ACMEServer{})
+		AutoMigrate(&CertEvent{})
+		AutoMigrate(&RenewalAttempt{})
+		AutoMigrate(&User{})
+		AutoMigrate(&RecoveryCode{})
+		AutoMigrate(&TrustedDevice{})
+		AutoMigrate(&Session{})
 
 		log.Println("[+] SQLite initialization successful")
 
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// RecoveryCode 两步验证的恢复码，只保存 SHA-256，每个只能使用一次
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint       `json:"userId" gorm:"index"`
+	CodeHash string     `json:"-"`
+	UsedAt   *time.Time `json:"usedAt"`
+}
+
+// TrustedDevice 登录时选择记住的设备，有效期内登录不需要输入验证码。
+// 浏览器 Cookie 中保存随机令牌，数据库只保存 SHA-256
+type TrustedDevice struct {
+	gorm.Model
+	UserID     uint       `json:"userId" gorm:"index"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex"`
+	UserAgent  string     `json:"userAgent"`
+	IP         string     `json:"ip"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// CountUnusedRecoveryCodes 用户还可以使用的恢复码数量
+func CountUnusedRecoveryCodes(userID uint) (count int64) {
+	GetDbClient().Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count)
+	return
+}
+
+// GetTrustedDevices 用户记住的未过期设备，最近使用的在前
+func GetTrustedDevices(userID uint) (devices []TrustedDevice) {
+	GetDbClient().Where("user_id = ? AND expires_at > ?", userID, time.Now()).Order("updated_at desc").Find(&devices)
+	return
+}
+
+// GetTrustedDeviceByHash 根据令牌哈希获取记住的设备
+func GetTrustedDeviceByHash(tokenHash string) (device TrustedDevice) {
+	GetDbClient().Where("token_hash = ?", tokenHash).Find(&device)
+	return
+}
+
+// RemoveTwoFactorData 删除用户的恢复码和记住的设备
+func RemoveTwoFactorData(userID uint) error {
+	if err := GetDbClient().Unscoped().Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	return GetDbClient().Unscoped().Where("user_id = ?", userID).Delete(&TrustedDevice{}).Error
+}
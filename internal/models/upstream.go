@@ -0,0 +1,122 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// 负载均衡策略，空字符串为 nginx 默认的加权轮询
+const (
+	UpstreamRoundRobin = ""
+	UpstreamLeastConn  = "least_conn"
+	UpstreamIPHash     = "ip_hash"
+	UpstreamHash       = "hash"
+)
+
+// 健康检查方式
+const (
+	HealthCheckNone = ""
+	HealthCheckHTTP = "http"
+	HealthCheckTCP  = "tcp"
+)
+
+// UpstreamPool 命名的后端服务器池，生成 nginx upstream 块
+type UpstreamPool struct {
+	gorm.Model
+	Name     string `json:"name" gorm:"uniqueIndex"`
+	Strategy string `json:"strategy"`
+	HashKey  string `json:"hashKey"` // hash 策略使用的 key，例如 $request_uri
+	// uranus 主动健康检查
+	HealthCheck    string `json:"healthCheck"`
+	HealthPath     string `json:"healthPath"`
+	HealthInterval int    `json:"healthInterval"` // 秒
+	HealthTimeout  int    `json:"healthTimeout"`  // 秒
+	FailThreshold  int    `json:"failThreshold"`  // 连续失败多少次判定为不健康
+	RiseThreshold  int    `json:"riseThreshold"`  // 连续成功多少次恢复
+	AutoDrain      bool   `json:"autoDrain"`      // 不健康时自动标记为 down
+
+	Members []UpstreamMember `json:"members" gorm:"foreignKey:PoolID"`
+}
+
+// UpstreamMember 服务器池中的一个后端
+type UpstreamMember struct {
+	gorm.Model
+	PoolID      uint   `json:"poolId" gorm:"index"`
+	Address     string `json:"address"` // host:port
+	Weight      int    `json:"weight"`
+	MaxFails    int    `json:"maxFails"`
+	FailTimeout string `json:"failTimeout"`
+	Backup      bool   `json:"backup"`
+	Down        bool   `json:"down"`    // 手动下线
+	Drained     bool   `json:"drained"` // 健康检查自动摘除
+}
+
+// IsDown 手动下线或被健康检查摘除
+func (m *UpstreamMember) IsDown() bool {
+	return m.Down || m.Drained
+}
+
+// GetUpstreamPools 获取所有服务器池及其成员
+func GetUpstreamPools() (pools []UpstreamPool) {
+	GetDbClient().Preload("Members", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Order("name").Find(&pools)
+	return
+}
+
+// GetUpstreamPoolByID 根据 ID 获取服务器池
+func GetUpstreamPoolByID(id uint) (pool UpstreamPool) {
+	if id == 0 {
+		return
+	}
+	GetDbClient().Preload("Members", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Find(&pool, id)
+	return
+}
+
+// GetUpstreamPoolByName 根据名称获取服务器池
+func GetUpstreamPoolByName(name string) (pool UpstreamPool) {
+	GetDbClient().Preload("Members", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id")
+	}).Find(&pool, "name = ?", name)
+	return
+}
+
+// Save 保存服务器池，成员列表整体替换
+func (p *UpstreamPool) Save() error {
+	return GetDbClient().Transaction(func(tx *gorm.DB) error {
+		members := p.Members
+		p.Members = nil
+		defer func() { p.Members = members }()
+
+		if err := tx.Save(p).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("pool_id = ?", p.ID).Delete(&UpstreamMember{}).Error; err != nil {
+			return err
+		}
+		for i := range members {
+			members[i].ID = 0
+			members[i].PoolID = p.ID
+		}
+		if len(members) == 0 {
+			return nil
+		}
+		return tx.Create(&members).Error
+	})
+}
+
+// Remove 删除服务器池及其成员
+func (p *UpstreamPool) Remove() error {
+	return GetDbClient().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("pool_id = ?", p.ID).Delete(&UpstreamMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&UpstreamPool{}, p.ID).Error
+	})
+}
+
+// SetUpstreamMemberDrained 更新健康检查摘除状态
+func SetUpstreamMemberDrained(id uint, drained bool) error {
+	return GetDbClient().Model(&UpstreamMember{}).Where("id = ?", id).Update("drained", drained).Error
+}
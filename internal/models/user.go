@@ -0,0 +1,160 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// 用户角色
+const (
+	RoleViewer       = "viewer"
+	RoleSiteOperator = "site-operator"
+	RoleCertManager  = "cert-manager"
+	RoleAdmin        = "admin"
+)
+
+// 权限，每个路由组需要其中一项
+const (
+	PermissionView      = "view"       // 只读访问所有页面
+	PermissionSites     = "sites"      // 网站、负载均衡、站点模板和历史版本
+	PermissionCerts     = "certs"      // 证书、DNS 凭据和 ACME 服务器
+	PermissionNginx     = "nginx"      // nginx.conf 和 nginx 进程
+	PermissionUsers     = "users"      // 用户管理
+	PermissionTerminal  = "terminal"   // root 终端，需要单独授权
+	PermissionAppConfig = "app-config" // config.toml，包含控制中心 Token，需要单独授权
+)
+
+var rolePermissions = map[string][]string{
+	RoleViewer:       {PermissionView},
+	RoleSiteOperator: {PermissionView, PermissionSites},
+	RoleCertManager:  {PermissionView, PermissionCerts},
+	RoleAdmin: {PermissionView, PermissionSites, PermissionCerts, PermissionNginx, PermissionUsers,
+		PermissionTerminal, PermissionAppConfig},
+}
+
+// Roles 可以分配的角色
+func Roles() []string {
+	return []string{RoleViewer, RoleSiteOperator, RoleCertManager, RoleAdmin}
+}
+
+// ValidRole 判断角色是否存在
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// User 登录用户，密码只保存 bcrypt 哈希
+type User struct {
+	gorm.Model
+	Username     string `json:"username" gorm:"uniqueIndex"`
+	PasswordHash string `json:"-"`
+	Role         string `json:"role"`
+	// 终端和应用配置与角色分开授权，管理员总是可以访问
+	TerminalAccess bool `json:"terminalAccess"`
+	ConfigAccess   bool `json:"configAccess"`
+	// 可以管理的站点配置名，逗号分隔，留空表示所有站点
+	Sites string `json:"sites"`
+	// 两步验证，TOTPSecret 使用数据密钥加密，启用之前保存的是待确认的密钥
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `json:"totpEnabled"`
+	// 最后一次使用的 TOTP 时间步，同一个验证码不能使用两次
+	TOTPLastStep int64 `json:"-"`
+	// 连续输错验证码的次数，达到上限后锁定到 TOTPLockedUntil。
+	// 保存在数据库中，重放旧 Cookie 或重新输入密码都不能清零
+	TOTPFailures    int        `json:"-"`
+	TOTPLockedUntil *time.Time `json:"-"`
+	// 首次登录或被管理员重置密码后必须先修改密码
+	MustChangePassword bool       `json:"mustChangePassword"`
+	PasswordChangedAt  *time.Time `json:"passwordChangedAt"`
+	LastLoginAt        *time.Time `json:"lastLoginAt"`
+	// 已经从 config.toml 迁移过的明文密码的哈希，配置文件没能清除密码时避免重启后再次覆盖
+	ConfigPasswordHash string `json:"-"`
+}
+
+// GetUsers 获取所有用户
+func GetUsers() (users []User) {
+	GetDbClient().Order("username").Find(&users)
+	return
+}
+
+// GetUserByID 根据 ID 获取用户
+func GetUserByID(id uint) (user User) {
+	if id == 0 {
+		return
+	}
+	GetDbClient().Find(&user, id)
+	return
+}
+
+// GetUserByUsername 根据用户名获取用户
+func GetUserByUsername(username string) (user User) {
+	if username == "" {
+		return
+	}
+	GetDbClient().Where("username = ?", username).Find(&user)
+	return
+}
+
+// CountUsers 用户数量
+func CountUsers() (count int64) {
+	GetDbClient().Model(&User{}).Count(&count)
+	return
+}
+
+// Remove 从数据库中删除用户
+func (u *User) Remove() error {
+	return GetDbClient().Unscoped().Delete(&User{}, u.ID).Error
+}
+
+// Can 判断用户是否有某项权限
+func (u *User) Can(permission string) bool {
+	switch {
+	case permission == PermissionTerminal && u.TerminalAccess:
+		return true
+	case permission == PermissionAppConfig && u.ConfigAccess:
+		return true
+	}
+	for _, item := range rolePermissions[u.Role] {
+		if item == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// SiteList 分配给用户的站点，为空表示不限制
+func (u *User) SiteList() []string {
+	var sites []string
+	for _, site := range strings.Split(u.Sites, ",") {
+		if site = strings.TrimSuffix(strings.TrimSpace(site), ".conf"); site != "" {
+			sites = append(sites, site)
+		}
+	}
+	return sites
+}
+
+// AllSites 用户是否可以访问所有站点，管理员不受站点分配限制
+func (u *User) AllSites() bool {
+	return u.Role == RoleAdmin || len(u.SiteList()) == 0
+}
+
+// CanAccessSite 判断用户是否可以访问某个站点，name 可以带 .conf 后缀
+func (u *User) CanAccessSite(name string) bool {
+	if u.AllSites() {
+		return true
+	}
+	name = strings.TrimSuffix(name, ".conf")
+	for _, site := range u.SiteList() {
+		if site == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CountAdmins 管理员数量
+func CountAdmins() (count int64) {
+	GetDbClient().Model(&User{}).Where("role = ?", RoleAdmin).Count(&count)
+	return
+}
@@ -12,6 +12,7 @@ import (
 	"sync/atomic"
 	"time"
 	"uranus/internal/config"
+	"uranus/internal/services"
 	"uranus/internal/tools"
 )
 
@@ -200,3 +201,29 @@ func publishStatus(status string) {
 		log.Printf("[MQTTY] 已发送状态: %s", status)
 	}
 }
+
+// publishTLSAlert 发布证书漂移告警
+func publishTLSAlert(result services.TLSInspection) {
+	if mqttClient == nil || !mqttClient.IsConnected() {
+		log.Printf("[MQTTY] 告警消息取消: MQTT未连接")
+		return
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"uuid":       getUUID(),
+		"type":       "tls_drift",
+		"domain":     result.Domain,
+		"site":       result.ConfigName,
+		"drift":      result.Drift,
+		"message":    result.DriftMessage,
+		"inspection": result,
+		"timestamp":  time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		log.Printf("[MQTTY] 告警消息序列化失败: %v", err)
+		return
+	}
+	token := mqttClient.Publish(AlertTopic, 1, false, payload)
+	if token.Wait() && token.Error() != nil {
+		log.Printf("[MQTTY] 告警消息发送失败: %v", token.Error())
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"sync/atomic"
 	"time"
 	"uranus/internal/config"
+	"uranus/internal/models"
 	"uranus/internal/services"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -119,6 +120,15 @@ func handleCommandMessage(client mqtt.Client, msg mqtt.Message, topicPrefix stri
 	case "restart":
 		handleRestartCommand(client, command, agentUuid)
 		return
+	case "enable_site", "disable_site":
+		handleSiteStateCommand(client, command, agentUuid)
+		return
+	case "maintenance":
+		handleMaintenanceCommand(client, command, agentUuid)
+		return
+	case "revoke_cert", "rotate_cert":
+		handleCertCommand(client, command, agentUuid)
+		return
 	}
 
 	// 其他命令类型的处理继续原来的逻辑
@@ -1170,3 +1180,192 @@ func handleRefreshIPCommand(client mqtt.Client, command struct {
 	client.Publish(responseTopic, 1, false, respPayload)
 }
 
+// commandSiteName 从命令数据中读取站点文件名，支持字符串或 {"site": "..."}
+func commandSiteName(data interface{}) string {
+	switch value := data.(type) {
+	case string:
+		return value
+	case map[string]interface{}:
+		if site, ok := value["site"].(string); ok {
+			return site
+		}
+	}
+	return ""
+}
+
+// handleSiteStateCommand 处理站点启用/停用命令
+func handleSiteStateCommand(client mqtt.Client, command struct {
+	Command   string      `json:"command"`
+	RequestId string      `json:"requestId"`
+	ClientId  string      `json:"clientId"`
+	Type      string      `json:"type"`
+	SessionId string      `json:"sessionId"`
+	Data      interface{} `json:"data"`
+}, agentUuid string) {
+	site := commandSiteName(command.Data)
+	log.Printf("[MQTTY] 处理站点命令 %s: %s，RequestId: %s", command.Command, site, command.RequestId)
+
+	// 创建响应主题
+	responseTopic := fmt.Sprintf("uranus/response/%s", agentUuid)
+
+	// 准备响应
+	response := struct {
+		Success   bool   `json:"success"`
+		RequestId string `json:"requestId"`
+		Command   string `json:"command"`
+		Site      string `json:"site"`
+		Message   string `json:"message"`
+	}{
+		RequestId: command.RequestId,
+		Command:   command.Command,
+		Site:      site,
+	}
+
+	var result *services.NginxTestResult
+	var err error
+	switch {
+	case site == "":
+		err = fmt.Errorf("没有指定站点")
+	case command.Command == "enable_site":
+		result, err = services.EnableSite(site)
+	default:
+		result, err = services.DisableSite(site)
+	}
+
+	switch {
+	case err != nil:
+		response.Message = err.Error()
+	case !result.OK:
+		response.Message = fmt.Sprintf("Nginx配置检测失败: %s", result.Message())
+	default:
+		response.Success = true
+		if command.Command == "enable_site" {
+			response.Message = "站点已启用"
+		} else {
+			response.Message = "站点已停用"
+		}
+	}
+
+	// 发送响应
+	respPayload, _ := json.Marshal(response)
+	client.Publish(responseTopic, 1, false, respPayload)
+}
+
+// handleMaintenanceCommand 处理站点维护模式命令，data: {"site": "...", "enabled": true}
+func handleMaintenanceCommand(client mqtt.Client, command struct {
+	Command   string      `json:"command"`
+	RequestId string      `json:"requestId"`
+	ClientId  string      `json:"clientId"`
+	Type      string      `json:"type"`
+	SessionId string      `json:"sessionId"`
+	Data      interface{} `json:"data"`
+}, agentUuid string) {
+	site := commandSiteName(command.Data)
+	enabled := false
+	if data, ok := command.Data.(map[string]interface{}); ok {
+		enabled, _ = data["enabled"].(bool)
+	}
+	log.Printf("[MQTTY] 处理维护模式命令: %s enabled=%v，RequestId: %s", site, enabled, command.RequestId)
+
+	// 创建响应主题
+	responseTopic := fmt.Sprintf("uranus/response/%s", agentUuid)
+
+	// 准备响应
+	response := struct {
+		Success   bool   `json:"success"`
+		RequestId string `json:"requestId"`
+		Command   string `json:"command"`
+		Site      string `json:"site"`
+		Enabled   bool   `json:"enabled"`
+		Message   string `json:"message"`
+	}{
+		RequestId: command.RequestId,
+		Command:   "maintenance",
+		Site:      site,
+		Enabled:   enabled,
+	}
+
+	if site == "" {
+		response.Message = "没有指定站点"
+	} else if result, err := services.SetMaintenanceEnabled(site, enabled, "mqtt", models.RevisionSourceMQTT); err != nil {
+		response.Message = err.Error()
+	} else if !result.OK {
+		response.Message = fmt.Sprintf("Nginx配置检测失败: %s", result.Message())
+	} else {
+		response.Success = true
+		if enabled {
+			response.Message = "维护模式已开启"
+		} else {
+			response.Message = "维护模式已关闭"
+		}
+	}
+
+	// 发送响应
+	respPayload, _ := json.Marshal(response)
+	client.Publish(responseTopic, 1, false, respPayload)
+}
+
+// handleCertCommand 处理证书吊销、轮换私钥命令，
+// data: {"cert": "...", "shared": false, "reason": 1, "revokeOld": true}
+func handleCertCommand(client mqtt.Client, command struct {
+	Command   string      `json:"command"`
+	RequestId string      `json:"requestId"`
+	ClientId  string      `json:"clientId"`
+	Type      string      `json:"type"`
+	SessionId string      `json:"sessionId"`
+	Data      interface{} `json:"data"`
+}, agentUuid string) {
+	var name string
+	var shared, revokeOld bool
+	var reason uint
+	if data, ok := command.Data.(map[string]interface{}); ok {
+		name, _ = data["cert"].(string)
+		shared, _ = data["shared"].(bool)
+		revokeOld, _ = data["revokeOld"].(bool)
+		if value, ok := data["reason"].(float64); ok && value >= 0 {
+			reason = uint(value)
+		}
+	}
+	log.Printf("[MQTTY] 处理证书命令 %s: %s，RequestId: %s", command.Command, name, command.RequestId)
+
+	// 创建响应主题
+	responseTopic := fmt.Sprintf("uranus/response/%s", agentUuid)
+
+	// 准备响应
+	response := struct {
+		Success   bool   `json:"success"`
+		RequestId string `json:"requestId"`
+		Command   string `json:"command"`
+		Cert      string `json:"cert"`
+		Message   string `json:"message"`
+	}{
+		RequestId: command.RequestId,
+		Command:   command.Command,
+		Cert:      name,
+	}
+
+	var err error
+	switch {
+	case name == "":
+		err = fmt.Errorf("没有指定证书")
+	case command.Command == "revoke_cert":
+		err = services.RevokeCert(name, shared, reason, "mqtt", models.RevisionSourceMQTT)
+	default:
+		err = services.RotateCertKey(name, shared, revokeOld, reason, "mqtt", models.RevisionSourceMQTT)
+	}
+
+	if err != nil {
+		response.Message = err.Error()
+	} else {
+		response.Success = true
+		if command.Command == "revoke_cert" {
+			response.Message = "证书已吊销"
+		} else {
+			response.Message = "已轮换私钥并重新签发证书"
+		}
+	}
+
+	// 发送响应
+	respPayload, _ := json.Marshal(response)
+	client.Publish(responseTopic, 1, false, respPayload)
+}
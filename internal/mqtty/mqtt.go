@@ -10,6 +10,7 @@ import (
 	"sync"
 	"time"
 	"uranus/internal/config"
+	"uranus/internal/services"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
@@ -19,6 +20,8 @@ const (
 	// 心跳和状态主题
 	HeartbeatTopic = "uranus/heartbeat"
 	StatusTopic    = "uranus/status"
+	// 告警主题，例如 nginx 返回的证书与磁盘上的证书不一致
+	AlertTopic = "uranus/alert"
 
 	// 终端相关主题
 	TopicInput   = "input"
@@ -119,6 +122,9 @@ func (t *Terminal) Start() error {
 	log.Printf("[进程][%d]: 启动MQTT心跳服务", os.Getpid())
 	go StartHeartbeat(t.ctx)
 
+	// 证书漂移告警发送到控制中心
+	services.SetTLSDriftHandler(publishTLSAlert)
+
 	log.Println("[MQTTY] MQTT终端服务已启动")
 	return nil
 }
@@ -0,0 +1,250 @@
+// Package nginxconf 解析 nginx 配置文件为带源码位置的语法树，并能够在保留原有
+// 格式和注释的前提下重新输出。
+package nginxconf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Position 节点在源文件中的位置，行列号从 1 开始
+type Position struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// Node 语法树中的节点: *Directive 或 *Comment
+type Node interface {
+	Pos() Position
+}
+
+// Config 一个配置文件
+type Config struct {
+	File  string
+	Nodes []Node
+
+	// 文件末尾的空白，parsed 为 false 表示新建的配置
+	trailing string
+	parsed   bool
+}
+
+// Directive 一条指令，Block 不为 nil 时表示带 {} 的块指令，例如 server / location
+type Directive struct {
+	Name     string
+	Args     []string
+	Block    []Node
+	Position Position
+
+	// include 指令展开后的文件，仅在 ParseOptions.FollowIncludes 时填充
+	Includes []*Config
+
+	raw *directiveRaw
+}
+
+// Comment 一条 # 注释，Text 不包含 #
+type Comment struct {
+	Text     string
+	Position Position
+
+	raw *commentRaw
+}
+
+// directiveRaw 记录原始文本中的空白与引号，用于无损输出
+type directiveRaw struct {
+	space      string // 指令名前的空白
+	name       string // 指令名原始文本，包括引号
+	nameValue  string
+	args       []rawArg
+	termSpace  string // ; 或 { 前的空白
+	closeSpace string // } 前的空白
+}
+
+type rawArg struct {
+	space   string
+	text    string // 原始文本，包括引号
+	value   string // 解析后的值
+	comment bool   // 参数之间的注释
+}
+
+type commentRaw struct {
+	space string
+	text  string // 原始文本，包括 #
+	value string
+}
+
+func (d *Directive) Pos() Position { return d.Position }
+func (c *Comment) Pos() Position   { return c.Position }
+
+// IsBlock 是否为块指令
+func (d *Directive) IsBlock() bool {
+	return d.Block != nil
+}
+
+// Arg 返回第 i 个参数，不存在时返回空字符串
+func (d *Directive) Arg(i int) string {
+	if i < 0 || i >= len(d.Args) {
+		return ""
+	}
+	return d.Args[i]
+}
+
+// SetArgs 替换参数，输出时只重写参数部分
+func (d *Directive) SetArgs(args ...string) {
+	d.Args = args
+}
+
+// Find 返回块内 (不递归) 指定名称的指令
+func (d *Directive) Find(name string) []*Directive {
+	return findIn(d.Block, name)
+}
+
+// FindOne 返回块内第一个指定名称的指令
+func (d *Directive) FindOne(name string) *Directive {
+	if found := d.Find(name); len(found) > 0 {
+		return found[0]
+	}
+	return nil
+}
+
+// Append 在块末尾添加节点
+func (d *Directive) Append(nodes ...Node) {
+	if d.Block == nil {
+		d.Block = []Node{}
+	}
+	d.Block = append(d.Block, nodes...)
+}
+
+// Prepend 在块开头添加节点
+func (d *Directive) Prepend(nodes ...Node) {
+	d.Block = append(append([]Node{}, nodes...), d.Block...)
+}
+
+// Remove 从块内删除节点
+func (d *Directive) Remove(node Node) bool {
+	var removed bool
+	d.Block, removed = removeFrom(d.Block, node)
+	return removed
+}
+
+// Find 返回顶层 (不递归) 指定名称的指令
+func (c *Config) Find(name string) []*Directive {
+	return findIn(c.Nodes, name)
+}
+
+// Append 在文件末尾添加节点
+func (c *Config) Append(nodes ...Node) {
+	c.Nodes = append(c.Nodes, nodes...)
+}
+
+// Remove 从顶层删除节点
+func (c *Config) Remove(node Node) bool {
+	var removed bool
+	c.Nodes, removed = removeFrom(c.Nodes, node)
+	return removed
+}
+
+// NewDirective 创建一条普通指令
+func NewDirective(name string, args ...string) *Directive {
+	return &Directive{Name: name, Args: args}
+}
+
+// NewBlock 创建一条块指令
+func NewBlock(name string, args []string, children ...Node) *Directive {
+	if children == nil {
+		children = []Node{}
+	}
+	return &Directive{Name: name, Args: args, Block: children}
+}
+
+// NewComment 创建一条注释
+func NewComment(text string) *Comment {
+	return &Comment{Text: text}
+}
+
+// Walk 深度优先遍历所有指令，fn 返回 false 时不再进入该指令的块；
+// followIncludes 为 true 时同时遍历 include 展开后的文件
+func Walk(nodes []Node, followIncludes bool, fn func(d *Directive) bool) {
+	for _, node := range nodes {
+		d, ok := node.(*Directive)
+		if !ok {
+			continue
+		}
+		if !fn(d) {
+			continue
+		}
+		if d.Block != nil {
+			Walk(d.Block, followIncludes, fn)
+		}
+		if followIncludes {
+			for _, included := range d.Includes {
+				Walk(included.Nodes, followIncludes, fn)
+			}
+		}
+	}
+}
+
+// FindAll 递归查找所有指定名称的指令
+func FindAll(nodes []Node, name string, followIncludes bool) []*Directive {
+	var found []*Directive
+	Walk(nodes, followIncludes, func(d *Directive) bool {
+		if d.Name == name {
+			found = append(found, d)
+		}
+		return true
+	})
+	return found
+}
+
+func findIn(nodes []Node, name string) []*Directive {
+	var found []*Directive
+	for _, node := range nodes {
+		if d, ok := node.(*Directive); ok && d.Name == name {
+			found = append(found, d)
+		}
+	}
+	return found
+}
+
+func removeFrom(nodes []Node, node Node) ([]Node, bool) {
+	for i, n := range nodes {
+		if n == node {
+			return append(nodes[:i], nodes[i+1:]...), true
+		}
+	}
+	return nodes, false
+}
+
+// ParseError 解析错误，带源码位置
+type ParseError struct {
+	Position Position
+	Message  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Position.File, e.Position.Line, e.Message)
+}
+
+// needsQuote 判断参数是否需要加引号才能原样输出
+func needsQuote(value string) bool {
+	if value == "" {
+		return true
+	}
+	if strings.HasPrefix(value, "#") {
+		return true
+	}
+	return strings.ContainsAny(value, " \t\r\n;{}\"'")
+}
+
+// quote 为参数加引号
+func quote(value string) string {
+	if !needsQuote(value) {
+		return value
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+	return `"` + replacer.Replace(value) + `"`
+}
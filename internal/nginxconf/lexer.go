@@ -0,0 +1,166 @@
+package nginxconf
+
+import (
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenSemicolon
+	tokenOpenBrace
+	tokenCloseBrace
+	tokenComment
+)
+
+type token struct {
+	kind  tokenKind
+	space string // token 前的空白
+	text  string // 原始文本
+	value string // 去掉引号和转义后的值，注释为 # 之后的内容
+	pos   Position
+}
+
+type lexer struct {
+	file   string
+	input  string
+	offset int
+	line   int
+	column int
+}
+
+func newLexer(file string, input string) *lexer {
+	return &lexer{file: file, input: input, line: 1, column: 1}
+}
+
+func (l *lexer) peek() byte {
+	if l.offset >= len(l.input) {
+		return 0
+	}
+	return l.input[l.offset]
+}
+
+func (l *lexer) advance() byte {
+	c := l.input[l.offset]
+	l.offset++
+	if c == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+	return c
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// next 返回下一个 token
+func (l *lexer) next() (token, error) {
+	start := l.offset
+	for l.offset < len(l.input) && isSpace(l.peek()) {
+		l.advance()
+	}
+	tok := token{
+		space: l.input[start:l.offset],
+		pos:   Position{File: l.file, Line: l.line, Column: l.column},
+	}
+	if l.offset >= len(l.input) {
+		tok.kind = tokenEOF
+		return tok, nil
+	}
+
+	begin := l.offset
+	switch c := l.peek(); c {
+	case ';':
+		l.advance()
+		tok.kind = tokenSemicolon
+	case '{':
+		l.advance()
+		tok.kind = tokenOpenBrace
+	case '}':
+		l.advance()
+		tok.kind = tokenCloseBrace
+	case '#':
+		for l.offset < len(l.input) && l.peek() != '\n' {
+			l.advance()
+		}
+		tok.kind = tokenComment
+		tok.value = strings.TrimRight(l.input[begin+1:l.offset], "\r")
+	case '"', '\'':
+		value, err := l.readQuoted(c)
+		if err != nil {
+			return tok, err
+		}
+		tok.kind = tokenWord
+		tok.value = value
+	default:
+		tok.kind = tokenWord
+		tok.value = l.readWord()
+	}
+	tok.text = l.input[begin:l.offset]
+	return tok, nil
+}
+
+// readQuoted 读取引号包围的参数
+func (l *lexer) readQuoted(quoteChar byte) (string, error) {
+	pos := Position{File: l.file, Line: l.line, Column: l.column}
+	l.advance()
+
+	var value strings.Builder
+	for l.offset < len(l.input) {
+		c := l.advance()
+		switch {
+		case c == quoteChar:
+			return value.String(), nil
+		case c == '\\' && l.offset < len(l.input):
+			escaped := l.advance()
+			switch escaped {
+			case '"', '\'', '\\':
+				value.WriteByte(escaped)
+			case 't':
+				value.WriteByte('\t')
+			case 'r':
+				value.WriteByte('\r')
+			case 'n':
+				value.WriteByte('\n')
+			default:
+				value.WriteByte('\\')
+				value.WriteByte(escaped)
+			}
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return "", &ParseError{Position: pos, Message: "unexpected end of file, expecting " + string(quoteChar)}
+}
+
+// readWord 读取不带引号的参数，${var} 中的大括号不作为块处理
+func (l *lexer) readWord() string {
+	begin := l.offset
+	for l.offset < len(l.input) {
+		c := l.peek()
+		if isSpace(c) || c == ';' || c == '{' || c == '}' {
+			break
+		}
+		if c == '\\' && l.offset+1 < len(l.input) {
+			l.advance()
+			l.advance()
+			continue
+		}
+		if c == '$' && l.offset+1 < len(l.input) && l.input[l.offset+1] == '{' {
+			for l.offset < len(l.input) && l.peek() != '}' {
+				l.advance()
+			}
+			if l.offset < len(l.input) {
+				l.advance()
+			}
+			continue
+		}
+		l.advance()
+	}
+	return l.input[begin:l.offset]
+}
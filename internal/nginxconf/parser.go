@@ -0,0 +1,166 @@
+package nginxconf
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ParseOptions 解析选项
+type ParseOptions struct {
+	// FollowIncludes 展开 include 指令，支持通配符
+	FollowIncludes bool
+	// BaseDir include 相对路径的基准目录，默认为主配置文件所在目录
+	BaseDir string
+}
+
+// Parse 解析配置文本，file 仅用于错误信息和节点位置
+func Parse(file string, content []byte) (*Config, error) {
+	p := &parser{lexer: newLexer(file, string(content))}
+	nodes, trailing, err := p.parseBlock(false)
+	if err != nil {
+		return nil, err
+	}
+	return &Config{File: file, Nodes: nodes, trailing: trailing, parsed: true}, nil
+}
+
+// ParseFile 读取并解析配置文件
+func ParseFile(path string, options ParseOptions) (*Config, error) {
+	if options.BaseDir == "" {
+		options.BaseDir = filepath.Dir(path)
+	}
+	return parseFile(path, options, map[string]bool{})
+}
+
+func parseFile(path string, options ParseOptions, visited map[string]bool) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, err := Parse(path, content)
+	if err != nil {
+		return nil, err
+	}
+	if !options.FollowIncludes {
+		return config, nil
+	}
+
+	visited[path] = true
+	defer delete(visited, path)
+
+	var includeErr error
+	Walk(config.Nodes, false, func(d *Directive) bool {
+		if includeErr != nil || d.Name != "include" || len(d.Args) != 1 {
+			return includeErr == nil
+		}
+		pattern := d.Args[0]
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(options.BaseDir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			includeErr = &ParseError{Position: d.Position, Message: err.Error()}
+			return false
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if visited[match] {
+				includeErr = &ParseError{Position: d.Position, Message: "include cycle: " + match}
+				return false
+			}
+			included, err := parseFile(match, options, visited)
+			if err != nil {
+				includeErr = err
+				return false
+			}
+			d.Includes = append(d.Includes, included)
+		}
+		return true
+	})
+	if includeErr != nil {
+		return nil, includeErr
+	}
+	return config, nil
+}
+
+type parser struct {
+	lexer *lexer
+}
+
+// parseBlock 解析一组节点直到 } 或文件结束，返回结束符前的空白
+func (p *parser) parseBlock(inBlock bool) ([]Node, string, error) {
+	nodes := []Node{}
+	for {
+		tok, err := p.lexer.next()
+		if err != nil {
+			return nil, "", err
+		}
+
+		switch tok.kind {
+		case tokenEOF:
+			if inBlock {
+				return nil, "", &ParseError{Position: tok.pos, Message: `unexpected end of file, expecting "}"`}
+			}
+			return nodes, tok.space, nil
+		case tokenCloseBrace:
+			if !inBlock {
+				return nil, "", &ParseError{Position: tok.pos, Message: `unexpected "}"`}
+			}
+			return nodes, tok.space, nil
+		case tokenComment:
+			nodes = append(nodes, &Comment{
+				Text:     tok.value,
+				Position: tok.pos,
+				raw:      &commentRaw{space: tok.space, text: tok.text, value: tok.value},
+			})
+		case tokenWord:
+			directive, err := p.parseDirective(tok)
+			if err != nil {
+				return nil, "", err
+			}
+			nodes = append(nodes, directive)
+		default:
+			return nil, "", &ParseError{Position: tok.pos, Message: "unexpected \"" + tok.text + "\""}
+		}
+	}
+}
+
+// parseDirective 解析指令名之后的参数以及可能的块
+func (p *parser) parseDirective(name token) (*Directive, error) {
+	directive := &Directive{
+		Name:     name.value,
+		Position: name.pos,
+		raw:      &directiveRaw{space: name.space, name: name.text, nameValue: name.value},
+	}
+
+	for {
+		tok, err := p.lexer.next()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok.kind {
+		case tokenWord:
+			directive.Args = append(directive.Args, tok.value)
+			directive.raw.args = append(directive.raw.args, rawArg{space: tok.space, text: tok.text, value: tok.value})
+		case tokenComment:
+			directive.raw.args = append(directive.raw.args, rawArg{space: tok.space, text: tok.text, comment: true})
+		case tokenSemicolon:
+			directive.raw.termSpace = tok.space
+			return directive, nil
+		case tokenOpenBrace:
+			directive.raw.termSpace = tok.space
+			block, closeSpace, err := p.parseBlock(true)
+			if err != nil {
+				return nil, err
+			}
+			directive.Block = block
+			directive.raw.closeSpace = closeSpace
+			return directive, nil
+		case tokenCloseBrace:
+			return nil, &ParseError{Position: tok.pos, Message: `unexpected "}"`}
+		case tokenEOF:
+			return nil, &ParseError{Position: tok.pos, Message: `unexpected end of file, expecting ";" or "}"`}
+		}
+	}
+}
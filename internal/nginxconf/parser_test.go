@@ -0,0 +1,236 @@
+package nginxconf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, input string) *Config {
+	t.Helper()
+	config, err := Parse("test.conf", []byte(input))
+	if err != nil {
+		t.Fatalf("Parse(%q) error: %v", input, err)
+	}
+	return config
+}
+
+func firstDirective(t *testing.T, nodes []Node) *Directive {
+	t.Helper()
+	for _, node := range nodes {
+		if d, ok := node.(*Directive); ok {
+			return d
+		}
+	}
+	t.Fatal("no directive found")
+	return nil
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"plain", "listen 443 ssl http2;", []string{"443", "ssl", "http2"}},
+		{"double quoted", `add_header X-Test "a b";`, []string{"X-Test", "a b"}},
+		{"single quoted", `log_format main '$remote_addr "$request"';`, []string{"main", `$remote_addr "$request"`}},
+		{"escaped quote", `set $a "x\"y";`, []string{"$a", `x"y`}},
+		{"escape sequences", `set $a "1\t2\n";`, []string{"$a", "1\t2\n"}},
+		{"unknown escape kept", `rewrite "^/a\.html$" /b;`, []string{`^/a\.html$`, "/b"}},
+		{"empty string", `set $a "";`, []string{"$a", ""}},
+		{"variable braces", "set $b ${a}suffix;", []string{"$b", "${a}suffix"}},
+		{"escaped semicolon", `return 200 a\;b;`, []string{"200", `a\;b`}},
+		{"comment between args", "listen 80 # main port\n    default_server;", []string{"80", "default_server"}},
+		{"no args", "ssl_stapling_verify;", nil},
+		{"quoted regex with braces", `location ~ "^/a{2}$" { }`, []string{"~", "^/a{2}$"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := firstDirective(t, mustParse(t, tt.input).Nodes)
+			if !reflect.DeepEqual(d.Args, tt.want) {
+				t.Errorf("args = %q, want %q", d.Args, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseComments(t *testing.T) {
+	input := "# top\nserver { # open\n    listen 80; # after\n    #inner\n}\n"
+	config := mustParse(t, input)
+
+	if len(config.Nodes) != 2 {
+		t.Fatalf("top level nodes = %d, want 2", len(config.Nodes))
+	}
+	if c, ok := config.Nodes[0].(*Comment); !ok || c.Text != " top" {
+		t.Errorf("first node = %#v, want comment \" top\"", config.Nodes[0])
+	}
+
+	server := config.Find("server")[0]
+	var comments []string
+	for _, node := range server.Block {
+		if c, ok := node.(*Comment); ok {
+			comments = append(comments, c.Text)
+		}
+	}
+	want := []string{" open", " after", "inner"}
+	if !reflect.DeepEqual(comments, want) {
+		t.Errorf("comments = %q, want %q", comments, want)
+	}
+	if listen := server.FindOne("listen"); listen == nil || listen.Position.Line != 3 {
+		t.Errorf("listen position = %v, want line 3", listen)
+	}
+}
+
+func TestParseBlocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		args     []string
+		children []string // 子指令: 名称和参数以空格连接
+	}{
+		{
+			name:     "if",
+			input:    "if ($request_method = POST) {\n    return 405;\n}",
+			args:     []string{"($request_method", "=", "POST)"},
+			children: []string{"return 405"},
+		},
+		{
+			name:     "if with quoted regex",
+			input:    `if ($http_user_agent ~* "(bot|spider)") { return 403; }`,
+			args:     []string{"($http_user_agent", "~*", "(bot|spider)", ")"},
+			children: []string{"return 403"},
+		},
+		{
+			name:     "map",
+			input:    "map $http_upgrade $connection_upgrade {\n    default upgrade;\n    '' close;\n}",
+			args:     []string{"$http_upgrade", "$connection_upgrade"},
+			children: []string{"default upgrade", " close"},
+		},
+		{
+			name:     "map with regex keys",
+			input:    "map $uri $new {\n    ~^/old/(?<rest>.*)$ /new/$rest;\n    \"~*\\.php$\" 1;\n}",
+			args:     []string{"$uri", "$new"},
+			children: []string{"~^/old/(?<rest>.*)$ /new/$rest", "~*\\.php$ 1"},
+		},
+		{
+			name:  "empty block",
+			input: "events {}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := firstDirective(t, mustParse(t, tt.input).Nodes)
+			if !d.IsBlock() {
+				t.Fatalf("%s is not a block", d.Name)
+			}
+			if !reflect.DeepEqual(d.Args, tt.args) {
+				t.Errorf("args = %q, want %q", d.Args, tt.args)
+			}
+			var children []string
+			for _, node := range d.Block {
+				if child, ok := node.(*Directive); ok {
+					children = append(children, strings.Join(append([]string{child.Name}, child.Args...), " "))
+				}
+			}
+			if !reflect.DeepEqual(children, tt.children) {
+				t.Errorf("children = %q, want %q", children, tt.children)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		line    int
+		message string
+	}{
+		{"unclosed block", "server {\n    listen 80;\n", 3, `expecting "}"`},
+		{"unexpected close", "listen 80;\n}", 2, `unexpected "}"`},
+		{"missing semicolon", "listen 80", 1, `expecting ";" or "}"`},
+		{"close inside args", "server {\n    listen 80 }", 2, `unexpected "}"`},
+		{"unclosed quote", "server {\n    return 200 \"abc;\n}\n", 2, `expecting "`},
+		{"stray semicolon", ";", 1, `unexpected ";"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("test.conf", []byte(tt.input))
+			parseErr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("error = %v, want *ParseError", err)
+			}
+			if parseErr.Position.Line != tt.line || !strings.Contains(parseErr.Message, tt.message) {
+				t.Errorf("error = %v, want line %d containing %q", err, tt.line, tt.message)
+			}
+		})
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParseFileIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"nginx.conf":        "http {\n    include mime.types;\n    include conf.d/*.conf;\n}\n",
+		"mime.types":        "types {\n    text/html html;\n}\n",
+		"conf.d/b.conf":     "server {\n    server_name b.example.com;\n}\n",
+		"conf.d/a.conf":     "server {\n    server_name a.example.com;\n}\n",
+		"conf.d/skip.conf~": "server {\n    server_name skipped;\n}\n",
+	})
+	path := filepath.Join(dir, "nginx.conf")
+
+	config, err := ParseFile(path, ParseOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := FindAll(config.Nodes, "server_name", true); len(found) != 0 {
+		t.Errorf("includes expanded without FollowIncludes: %d server_name", len(found))
+	}
+
+	config, err = ParseFile(path, ParseOptions{FollowIncludes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, d := range FindAll(config.Nodes, "server_name", true) {
+		names = append(names, d.Arg(0))
+	}
+	if want := []string{"a.example.com", "b.example.com"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("server_name = %q, want %q", names, want)
+	}
+	if types := FindAll(config.Nodes, "types", true); len(types) != 1 {
+		t.Errorf("types blocks = %d, want 1", len(types))
+	}
+	// 展开 include 不影响输出
+	content, _ := os.ReadFile(path)
+	if got := config.String(); got != string(content) {
+		t.Errorf("output with includes = %q, want %q", got, content)
+	}
+}
+
+func TestParseFileIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.conf": "include b.conf;\n",
+		"b.conf": "include a.conf;\n",
+	})
+	_, err := ParseFile(filepath.Join(dir, "a.conf"), ParseOptions{FollowIncludes: true})
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("error = %v, want include cycle", err)
+	}
+}
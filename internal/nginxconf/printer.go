@@ -0,0 +1,171 @@
+package nginxconf
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// indentUnit 新增节点使用的缩进
+const indentUnit = "    "
+
+// Bytes 输出配置文本，未修改的部分与原文完全一致
+func (c *Config) Bytes() []byte {
+	var buf bytes.Buffer
+	_, _ = c.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+// String 输出配置文本
+func (c *Config) String() string {
+	return string(c.Bytes())
+}
+
+// WriteTo 将配置写入 w
+func (c *Config) WriteTo(w io.Writer) (int64, error) {
+	p := &printer{}
+	p.printNodes(c.Nodes, 0, true)
+
+	trailing := c.trailing
+	if !c.parsed && len(c.Nodes) > 0 {
+		trailing = "\n"
+	}
+	p.buf.WriteString(trailing)
+
+	n, err := w.Write(p.buf.Bytes())
+	return int64(n), err
+}
+
+type printer struct {
+	buf bytes.Buffer
+}
+
+func (p *printer) printNodes(nodes []Node, depth int, topLevel bool) {
+	for i, node := range nodes {
+		first := topLevel && i == 0 && p.buf.Len() == 0
+		switch n := node.(type) {
+		case *Directive:
+			p.printDirective(n, depth, first)
+		case *Comment:
+			p.printComment(n, depth, first)
+		}
+	}
+}
+
+// leadingSpace 新节点的前导空白: 换行加缩进，文件开头不加换行
+func leadingSpace(depth int, first bool) string {
+	if first {
+		return strings.Repeat(indentUnit, depth)
+	}
+	return "\n" + strings.Repeat(indentUnit, depth)
+}
+
+func (p *printer) printComment(c *Comment, depth int, first bool) {
+	if c.raw != nil {
+		p.buf.WriteString(c.raw.space)
+		if c.Text == c.raw.value {
+			p.buf.WriteString(c.raw.text)
+			return
+		}
+	} else {
+		p.buf.WriteString(leadingSpace(depth, first))
+	}
+	p.buf.WriteString("#" + c.Text)
+}
+
+func (p *printer) printDirective(d *Directive, depth int, first bool) {
+	raw := d.raw
+	if raw == nil {
+		raw = &directiveRaw{space: leadingSpace(depth, first)}
+		if d.Block != nil {
+			raw.termSpace = " "
+			raw.closeSpace = "\n" + strings.Repeat(indentUnit, depth)
+		}
+	}
+
+	p.buf.WriteString(raw.space)
+	if d.raw != nil && d.raw.nameValue == d.Name {
+		p.buf.WriteString(d.raw.name)
+	} else {
+		p.buf.WriteString(quote(d.Name))
+	}
+	p.printArgs(d, raw)
+	p.buf.WriteString(raw.termSpace)
+
+	if d.Block == nil {
+		p.buf.WriteString(";")
+		return
+	}
+	p.buf.WriteString("{")
+	p.printNodes(d.Block, depth+1, false)
+	p.buf.WriteString(raw.closeSpace)
+	p.buf.WriteString("}")
+}
+
+// printArgs 参数未修改时输出原文，否则按单个空格分隔重新生成
+func (p *printer) printArgs(d *Directive, raw *directiveRaw) {
+	if argsUnchanged(d.Args, raw.args) {
+		for _, arg := range raw.args {
+			p.buf.WriteString(arg.space)
+			p.buf.WriteString(arg.text)
+		}
+		return
+	}
+	for _, arg := range d.Args {
+		p.buf.WriteString(" ")
+		p.buf.WriteString(quote(arg))
+	}
+}
+
+func argsUnchanged(args []string, rawArgs []rawArg) bool {
+	i := 0
+	for _, arg := range rawArgs {
+		if arg.comment {
+			continue
+		}
+		if i >= len(args) || args[i] != arg.value {
+			return false
+		}
+		i++
+	}
+	return i == len(args)
+}
+
+// ResetFormatting 丢弃节点的原始格式，之后按统一缩进输出
+func ResetFormatting(nodes []Node) {
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case *Directive:
+			n.raw = nil
+			ResetFormatting(n.Block)
+		case *Comment:
+			n.raw = nil
+		}
+	}
+}
+
+// Format 按统一缩进输出一组节点，不修改节点本身的格式信息
+func Format(nodes []Node) string {
+	config := &Config{Nodes: cloneNodes(nodes)}
+	ResetFormatting(config.Nodes)
+	return config.String()
+}
+
+func cloneNodes(nodes []Node) []Node {
+	cloned := make([]Node, 0, len(nodes))
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case *Directive:
+			copied := *n
+			copied.Args = append([]string(nil), n.Args...)
+			if n.Block != nil {
+				copied.Block = cloneNodes(n.Block)
+			}
+			cloned = append(cloned, &copied)
+		case *Comment:
+			copied := *n
+			cloned = append(cloned, &copied)
+		}
+	}
+	return cloned
+}
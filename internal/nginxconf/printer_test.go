@@ -0,0 +1,211 @@
+package nginxconf
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"only whitespace", "\n\n  \n"},
+		{"no trailing newline", "worker_processes auto;"},
+		{"tabs and blank lines", "http {\n\tgzip on;\n\n\n\tserver {\n\t\tlisten 80;\n\t}\n}\n"},
+		{"crlf", "server {\r\n    listen 80;\r\n}\r\n"},
+		{"odd spacing", "server{listen   80 ;server_name a b\n  c;}"},
+		{"quotes kept as written", "add_header X-A 'single';\nadd_header \"X-B\" \"double \\\" quote\";\n"},
+		{"comments everywhere", "# head\nserver { # open\n    listen 80 # arg\n        default_server; # tail\n    # inner\n} # close\n"},
+		{"comment without space", "#no space\n"},
+		{"variable braces", "set $b ${a}x;\n"},
+		{"if and map", "map $a $b {\n    default 0;\n    '' 1;\n    ~^x 2;\n}\nserver {\n    if ($b = 1) {\n        return 403;\n    }\n}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustParse(t, tt.input).String(); got != tt.input {
+				t.Errorf("round trip = %q, want %q", got, tt.input)
+			}
+		})
+	}
+}
+
+// templateData 与 services.TemplateData 字段相同，这里不能引用 services 包
+type templateData struct {
+	ConfigName string
+	Domain     string
+	Proxy      string
+	SSL        bool
+	CertDir    string
+	Params     map[string]string
+}
+
+// TestBundledTemplatesRoundTrip 内置站点模板生成的配置解析后原样输出
+func TestBundledTemplatesRoundTrip(t *testing.T) {
+	dir := filepath.Join("..", "services", "template")
+	partials, err := os.ReadFile(filepath.Join(dir, "partials.tmpl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.conf"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no bundled templates found: %v", err)
+	}
+
+	params := map[string]string{
+		"root": "/var/www/example", "index": "index.html index.htm", "port": "8080",
+		"backend": "127.0.0.1:50051", "timeout": "60s", "fastcgi": "unix:/run/php/php-fpm.sock",
+		"target": "https://example.org", "code": "301", "keepPath": "true",
+		"apiPath": "/api/", "protocol": "tcp",
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl, err := template.New("partials").Option("missingkey=zero").Parse(string(partials))
+		if err == nil {
+			tmpl, err = tmpl.New(filepath.Base(file)).Parse(string(content))
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+
+		for _, ssl := range []bool{false, true} {
+			data := templateData{
+				ConfigName: "example",
+				Domain:     "example.com www.example.com",
+				Proxy:      "http://127.0.0.1:3000",
+				SSL:        ssl,
+				CertDir:    "/etc/nginx/ssl/example",
+				Params:     params,
+			}
+			var out bytes.Buffer
+			if err := tmpl.Execute(&out, data); err != nil {
+				t.Fatalf("%s: %v", file, err)
+			}
+			config, err := Parse(file, out.Bytes())
+			if err != nil {
+				t.Fatalf("%s (ssl=%v): %v", file, ssl, err)
+			}
+			if len(config.Nodes) == 0 {
+				t.Errorf("%s (ssl=%v): no nodes parsed", file, ssl)
+			}
+			if got := config.Bytes(); !bytes.Equal(got, out.Bytes()) {
+				t.Errorf("%s (ssl=%v): round trip differs\ngot:\n%s\nwant:\n%s", file, ssl, got, out.Bytes())
+			}
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"plain", "plain"},
+		{"$host$request_uri", "$host$request_uri"},
+		{"", `""`},
+		{"a b", `"a b"`},
+		{"#not-comment", `"#not-comment"`},
+		{"a;b", `"a;b"`},
+		{"{x}", `"{x}"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{"it's", `"it's"`},
+		{"line\nbreak\t", `"line\nbreak\t"`},
+		{`back\slash x`, `"back\\slash x"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := quote(tt.value); got != tt.want {
+				t.Errorf("quote(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+			// 加引号后的参数解析回原值
+			d := firstDirective(t, mustParse(t, "set $a "+quote(tt.value)+";").Nodes)
+			if d.Arg(1) != tt.value {
+				t.Errorf("parsed %s = %q, want %q", quote(tt.value), d.Arg(1), tt.value)
+			}
+		})
+	}
+}
+
+func TestPrintModified(t *testing.T) {
+	input := "# site\nserver {\n\tlisten 80; # http\n\tserver_name 'a.com';\n\tlocation / {\n\t\tproxy_pass http://a;\n\t}\n}\n"
+	config := mustParse(t, input)
+	server := config.Find("server")[0]
+
+	// 修改参数只重写该指令的参数，缩进和注释保持不变
+	server.FindOne("server_name").SetArgs("b.com", "c d.com")
+	// 新增的节点按层级缩进
+	server.Append(NewDirective("client_max_body_size", "10m"))
+	server.FindOne("location").Append(NewComment(" added"))
+	config.Append(NewBlock("upstream", []string{"a"}, NewDirective("server", "127.0.0.1:80")))
+
+	want := "# site\nserver {\n\tlisten 80; # http\n\tserver_name b.com \"c d.com\";\n\tlocation / {\n\t\tproxy_pass http://a;\n" +
+		"        # added\n\t}\n    client_max_body_size 10m;\n}\nupstream a {\n    server 127.0.0.1:80;\n}\n"
+	if got := config.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestPrintRemoved(t *testing.T) {
+	config := mustParse(t, "listen 80;\nlisten 443 ssl;\nserver_name a.com;\n")
+	if !config.Remove(config.Find("listen")[1]) {
+		t.Fatal("Remove returned false")
+	}
+	if config.Remove(NewDirective("listen", "443")) {
+		t.Error("Remove of a node not in the config returned true")
+	}
+	if got, want := config.String(), "listen 80;\nserver_name a.com;\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestPrintUnchangedArgsKeepQuotes(t *testing.T) {
+	config := mustParse(t, "add_header 'X-A' \"v\";\n")
+	d := firstDirective(t, config.Nodes)
+	d.SetArgs(d.Args...)
+	if got := config.String(); got != "add_header 'X-A' \"v\";\n" {
+		t.Errorf("output = %q", got)
+	}
+	d.Name = "more_set_headers"
+	if got := config.String(); got != "more_set_headers 'X-A' \"v\";\n" {
+		t.Errorf("renamed output = %q", got)
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	config := &Config{}
+	config.Append(
+		NewComment(" generated"),
+		NewBlock("server", nil,
+			NewDirective("listen", "80"),
+			NewBlock("location", []string{"/"}),
+		),
+	)
+	want := "# generated\nserver {\n    listen 80;\n    location / {\n    }\n}\n"
+	if got := config.String(); got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	input := "server{listen 80;# c\n\t\tlocation /{return 200 'ok';}}"
+	config := mustParse(t, input)
+	want := "server {\n    listen 80;\n    # c\n    location / {\n        return 200 ok;\n    }\n}\n"
+	if got := Format(config.Nodes); got != want {
+		t.Errorf("Format = %q, want %q", got, want)
+	}
+	// Format 不修改原有节点
+	if got := config.String(); got != input {
+		t.Errorf("original output changed to %q", got)
+	}
+	if !strings.HasPrefix(Format(config.Find("server")[0].Block), "listen 80;") {
+		t.Errorf("Format of block children should start at column 0")
+	}
+}
@@ -0,0 +1,129 @@
+package nginxconf
+
+import (
+	"sort"
+	"strings"
+)
+
+// Server 从 server {} 块中提取的站点信息
+type Server struct {
+	ServerNames       []string `json:"serverNames"`
+	Listen            []string `json:"listen"`
+	SSL               bool     `json:"ssl"`
+	SSLCertificate    string   `json:"sslCertificate"`
+	SSLCertificateKey string   `json:"sslCertificateKey"`
+	ProxyPass         []string `json:"proxyPass"`
+	Root              string   `json:"root"`
+	Position          Position `json:"position"`
+
+	Directive *Directive `json:"-"`
+}
+
+// Servers 返回配置中所有 http server 块 (跳过 stream 中的 server)
+func Servers(nodes []Node, followIncludes bool) []*Server {
+	var servers []*Server
+	Walk(nodes, followIncludes, func(d *Directive) bool {
+		switch d.Name {
+		case "stream", "upstream":
+			return false
+		case "server":
+			if d.IsBlock() {
+				servers = append(servers, newServer(d))
+			}
+			return false
+		}
+		return true
+	})
+	return servers
+}
+
+func newServer(d *Directive) *Server {
+	server := &Server{Position: d.Position, Directive: d}
+	for _, name := range d.Find("server_name") {
+		for _, arg := range name.Args {
+			if arg != "_" && arg != "" {
+				server.ServerNames = append(server.ServerNames, arg)
+			}
+		}
+	}
+	for _, listen := range d.Find("listen") {
+		server.Listen = append(server.Listen, strings.Join(listen.Args, " "))
+		for i, arg := range listen.Args {
+			if i > 0 && arg == "ssl" {
+				server.SSL = true
+			}
+		}
+	}
+	if cert := d.FindOne("ssl_certificate"); cert != nil {
+		server.SSLCertificate = cert.Arg(0)
+		server.SSL = true
+	}
+	if key := d.FindOne("ssl_certificate_key"); key != nil {
+		server.SSLCertificateKey = key.Arg(0)
+	}
+	if root := d.FindOne("root"); root != nil {
+		server.Root = root.Arg(0)
+	}
+	for _, proxy := range FindAll(d.Block, "proxy_pass", false) {
+		server.ProxyPass = append(server.ProxyPass, proxy.Arg(0))
+	}
+	return server
+}
+
+// SiteInfo 一个站点配置文件中所有 server 块信息的汇总
+type SiteInfo struct {
+	Domains           []string  `json:"domains"`
+	Listen            []string  `json:"listen"`
+	SSL               bool      `json:"ssl"`
+	SSLCertificate    string    `json:"sslCertificate"`
+	SSLCertificateKey string    `json:"sslCertificateKey"`
+	Proxy             string    `json:"proxy"`
+	Upstreams         []string  `json:"upstreams"`
+	Servers           []*Server `json:"servers"`
+}
+
+// Summarize 汇总配置中的域名、端口、证书和反代地址
+func Summarize(config *Config) *SiteInfo {
+	info := &SiteInfo{Servers: Servers(config.Nodes, true)}
+	domains := map[string]bool{}
+	listens := map[string]bool{}
+	upstreams := map[string]bool{}
+
+	for _, server := range info.Servers {
+		for _, name := range server.ServerNames {
+			if !domains[name] {
+				domains[name] = true
+				info.Domains = append(info.Domains, name)
+			}
+		}
+		for _, listen := range server.Listen {
+			if !listens[listen] {
+				listens[listen] = true
+				info.Listen = append(info.Listen, listen)
+			}
+		}
+		if server.SSL {
+			info.SSL = true
+		}
+		if info.SSLCertificate == "" {
+			info.SSLCertificate = server.SSLCertificate
+			info.SSLCertificateKey = server.SSLCertificateKey
+		}
+		for _, proxy := range server.ProxyPass {
+			// 跳过证书申请用的本地反代
+			if proxy == "" || strings.HasSuffix(proxy, ":9999") {
+				continue
+			}
+			if !upstreams[proxy] {
+				upstreams[proxy] = true
+				info.Upstreams = append(info.Upstreams, proxy)
+			}
+		}
+	}
+
+	sort.Strings(info.Listen)
+	if len(info.Upstreams) > 0 {
+		info.Proxy = info.Upstreams[0]
+	}
+	return info
+}
@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"uranus/internal/controllers"
+)
+
+// accountRoute 所有用户都可以修改自己的密码
+func accountRoute(engine *gin.RouterGroup) {
+	engine.GET("/account", controllers.Account)
+	engine.POST("/account/password", controllers.ChangePassword)
+	engine.POST("/account/2fa/setup", controllers.SetupTOTP)
+	engine.POST("/account/2fa/enable", controllers.EnableTOTP)
+	engine.POST("/account/2fa/disable", controllers.DisableTOTP)
+	engine.POST("/account/2fa/recovery", controllers.RegenerateRecoveryCodes)
+	engine.POST("/account/devices/forget", controllers.ForgetTrustedDevices)
+
+	// REST API
+	engine.POST("/api/account/password", controllers.ChangePassword)
+}
+
+// usersRoute 用户和会话管理，只有管理员可以访问
+func usersRoute(engine *gin.RouterGroup) {
+	engine.POST("/users/save", controllers.SaveUser)
+	engine.POST("/users/reset/:id", controllers.ResetUserPassword)
+	engine.POST("/users/delete/:id", controllers.DeleteUser)
+	engine.POST("/users/2fa/reset/:id", controllers.ResetUserTOTP)
+	engine.POST("/sessions/revoke/:id", controllers.RevokeSession)
+	engine.POST("/sessions/keys/rotate", controllers.RotateSessionKeys)
+
+	// REST API
+	engine.GET("/api/users", controllers.Users)
+	engine.POST("/api/users", controllers.SaveUser)
+	engine.GET("/api/sessions", controllers.Sessions)
+}
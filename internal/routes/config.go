@@ -8,4 +8,5 @@ import (
 func configRoute(engine *gin.RouterGroup) {
 	engine.GET("/config/edit", controllers.GetConfigEditor)
 	engine.POST("/config/save", controllers.SaveConfig)
+	engine.POST("/upgrade", controllers.Upgrade)
 }
@@ -0,0 +1,69 @@
+package routes
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+)
+
+const (
+	// 页面脚本从这个 Cookie 读取令牌，其他站点的页面读不到
+	csrfCookie = "uranus_csrf"
+	// ajax 请求通过请求头提交令牌，表单通过隐藏字段提交
+	csrfHeader = "X-CSRF-Token"
+	csrfField  = "_csrf"
+)
+
+// safeMethods 不修改状态的请求不需要令牌
+var safeMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+}
+
+func newCSRFToken() string {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		log.Fatalf("[CSRF] Failed to generate token: %v", err)
+	}
+	return hex.EncodeToString(raw)
+}
+
+// csrf 令牌保存在会话中，登录和退出时会话被清空，令牌随之更换。
+// 修改状态的请求必须在请求头或表单字段中带上同一个令牌
+func csrf(context *gin.Context) {
+	session := sessions.Default(context)
+	token, _ := session.Get("csrf").(string)
+	if token == "" {
+		token = newCSRFToken()
+		session.Set("csrf", token)
+		_ = session.Save()
+	}
+	if cookie, err := context.Cookie(csrfCookie); err != nil || cookie != token {
+		http.SetCookie(context.Writer, &http.Cookie{
+			Name:     csrfCookie,
+			Value:    token,
+			Path:     "/",
+			Secure:   isSecureRequest(context.Request),
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+	context.Set("csrfToken", token)
+
+	if !safeMethods[context.Request.Method] {
+		submitted := context.GetHeader(csrfHeader)
+		if submitted == "" {
+			submitted = context.PostForm(csrfField)
+		}
+		if subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+			log.Printf("[CSRF] Rejected %s %s from %s", context.Request.Method, context.Request.URL.Path, context.ClientIP())
+			forbidden(context, "请求已过期或来源无效，请刷新页面后重试")
+			return
+		}
+	}
+	context.Next()
+}
@@ -3,18 +3,72 @@ package routes
 import (
 	"fmt"
 	"github.com/gin-contrib/sessions"
-	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"net/url"
 	"strings"
 	"uranus/internal/config"
 	"uranus/internal/controllers"
+	"uranus/internal/models"
+	"uranus/internal/services"
 )
 
+// accountSetupPaths 必须修改密码或启用两步验证的用户只能访问这些路径
+var accountSetupPaths = map[string]bool{
+	"/admin/account":              true,
+	"/admin/account/password":     true,
+	"/admin/api/account/password": true,
+	"/admin/account/2fa/setup":    true,
+	"/admin/account/2fa/enable":   true,
+}
+
+// accountSetupRequired 用户使用前需要完成的设置，不需要时返回空字符串
+func accountSetupRequired(user *models.User) string {
+	switch {
+	case user.MustChangePassword:
+		return "请先修改初始密码"
+	case !user.TOTPEnabled && services.TwoFactorRequired():
+		return "请先启用两步验证"
+	}
+	return ""
+}
+
+// loginSession Cookie 中的会话在服务端仍然有效时返回会话记录。
+// 会话被吊销、超时或用户被删除后清空 Cookie
+func loginSession(session sessions.Session) (models.Session, models.User, bool) {
+	if session.Get("login") != true {
+		return models.Session{}, models.User{}, false
+	}
+	token, _ := session.Get("token").(string)
+	record, err := services.ValidateSession(token)
+	if err == nil {
+		if user := models.GetUserByID(record.UserID); user.ID != 0 {
+			return record, user, true
+		}
+	}
+	session.Clear()
+	_ = session.Save()
+	return models.Session{}, models.User{}, false
+}
+
 func auth(context *gin.Context) {
 	var isAuth = false
 	session := sessions.Default(context)
-	isAuth = session.Get("login") == true
+	expired := session.Get("login") == true
+	if _, user, ok := loginSession(session); ok {
+		isAuth = true
+		context.Set("user", user)
+		context.Set("sessionToken", session.Get("token"))
+		if setup := accountSetupRequired(&user); setup != "" && !accountSetupPaths[context.FullPath()] {
+			if context.Request.Method == http.MethodGet {
+				context.Redirect(http.StatusFound, "/admin/account")
+			} else {
+				context.JSON(http.StatusForbidden, gin.H{"message": setup})
+			}
+			context.Abort()
+			return
+		}
+	}
 
 	if !isAuth {
 		queryUrl := strings.Split(fmt.Sprint(context.Request.URL.String()), "?")[0]
@@ -28,24 +82,92 @@ func auth(context *gin.Context) {
 
 	if isAuth {
 		context.Next()
+	} else if expired {
+		context.Redirect(http.StatusFound, "/?error="+url.QueryEscape(services.ErrSessionExpired.Error()))
 	} else {
 		context.Redirect(http.StatusFound, "/")
 	}
 	context.Abort()
 }
 
+// readOnlyPermissions 这些路由组的只读请求只需要查看权限
+var readOnlyPermissions = map[string]bool{
+	models.PermissionSites: true,
+	models.PermissionCerts: true,
+	models.PermissionNginx: true,
+}
+
+// forbidden 页面请求返回错误页，ajax 和 API 请求返回 JSON
+func forbidden(context *gin.Context, message string) {
+	isPage := context.Request.Method == http.MethodGet &&
+		context.GetHeader("X-Requested-With") != "XMLHttpRequest" &&
+		!strings.HasPrefix(context.FullPath(), "/admin/api/")
+	if isPage {
+		context.HTML(http.StatusForbidden, "error.html", gin.H{"message": message})
+	} else {
+		context.JSON(http.StatusForbidden, gin.H{"message": message})
+	}
+	context.Abort()
+}
+
+// permit 检查当前用户是否有路由组需要的权限，只读请求只需要查看权限
+func permit(permission string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		value, ok := context.Get("user")
+		if !ok {
+			forbidden(context, "没有权限访问")
+			return
+		}
+		user := value.(models.User)
+		required := permission
+		method := context.Request.Method
+		if readOnlyPermissions[permission] && (method == http.MethodGet || method == http.MethodHead) {
+			required = models.PermissionView
+		}
+		if !user.Can(required) {
+			forbidden(context, "没有权限访问")
+			return
+		}
+		context.Next()
+	}
+}
+
+// siteScope 只分配了部分站点的用户不能访问其他站点
+func siteScope(context *gin.Context) {
+	filename := context.Param("filename")
+	if filename == "" {
+		context.Next()
+		return
+	}
+	if strings.ContainsAny(filename, `/\`) || strings.Contains(filename, "..") {
+		forbidden(context, "文件名不合法")
+		return
+	}
+	value, _ := context.Get("user")
+	if user, ok := value.(models.User); !ok || !user.CanAccessSite(filename) {
+		forbidden(context, "没有权限访问该站点")
+		return
+	}
+	context.Next()
+}
+
 // RegisterRoutes /** 路由组*/
 func RegisterRoutes(engine *gin.Engine) {
 	// 错误中间件
 	//engine.Use(middlewares.ErrorHttp)
 	// 初始化路由
-	engine.Use(sessions.Sessions("uranus", cookie.NewStore([]byte("secret"))))
+	engine.Use(sessions.Sessions("uranus", newSessionStore()))
 	publicRoute(engine)
-	authorized := engine.Group("/admin", auth)
+	authorized := engine.Group("/admin", auth, csrf)
 	authorized.GET("/dashboard", controllers.Index)
-	nginxRoute(authorized)
-	sitesRoute(authorized)
-	sslRoute(authorized)
-	terminalRoute(authorized)
-	configRoute(authorized)
+	nginxRoute(authorized.Group("", permit(models.PermissionNginx)))
+	sitesRoute(authorized.Group("", permit(models.PermissionSites), siteScope))
+	upstreamsRoute(authorized.Group("", permit(models.PermissionSites)))
+	templatesRoute(authorized.Group("", permit(models.PermissionSites)))
+	sslRoute(authorized.Group("", permit(models.PermissionCerts)))
+	terminalRoute(authorized.Group("", permit(models.PermissionTerminal)))
+	configRoute(authorized.Group("", permit(models.PermissionAppConfig)))
+	revisionsRoute(authorized.Group("", permit(models.PermissionSites)))
+	accountRoute(authorized)
+	usersRoute(authorized.Group("", permit(models.PermissionUsers)))
 }
@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"errors"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+	"uranus/internal/models"
+	"uranus/internal/services"
+)
+
+const (
+	// 记住设备的 Cookie，保存随机令牌
+	trustedDeviceCookie = "uranus_device"
+	// 输入密码后需要在这段时间内完成两步验证
+	secondFactorTimeout = 5 * time.Minute
+)
+
+// completeLogin 密码和两步验证都通过后写入会话
+func completeLogin(context *gin.Context, user models.User) {
+	session := sessions.Default(context)
+	session.Clear()
+	token, err := services.CreateSession(user, context.ClientIP(), context.Request.UserAgent())
+	if err != nil {
+		log.Printf("[USER] Failed to create session for %s: %v", user.Username, err)
+		_ = session.Save()
+		context.Redirect(http.StatusFound, "/?error="+url.QueryEscape("登录失败，请稍后重试"))
+		return
+	}
+	session.Set("login", true)
+	session.Set("username", user.Username)
+	session.Set("token", token)
+	_ = session.Save()
+	// 首次登录或密码被重置后先修改密码
+	if user.MustChangePassword {
+		context.Redirect(http.StatusFound, "/admin/account")
+	} else {
+		context.Redirect(http.StatusFound, "/admin/dashboard")
+	}
+}
+
+// pendingUser 已经通过密码验证、等待输入验证码的用户，超时后需要重新登录
+func pendingUser(session sessions.Session) models.User {
+	userID, _ := session.Get("pendingUserId").(uint)
+	pendingAt, _ := session.Get("pendingAt").(int64)
+	if userID == 0 || time.Since(time.Unix(pendingAt, 0)) > secondFactorTimeout {
+		return models.User{}
+	}
+	return models.GetUserByID(userID)
+}
+
+func loginSecondFactorPage(context *gin.Context) {
+	if pendingUser(sessions.Default(context)).ID == 0 {
+		context.Redirect(http.StatusFound, "/")
+		return
+	}
+	context.HTML(http.StatusOK, "login.html", gin.H{
+		"twoFactor":   true,
+		"error":       context.Query("error"),
+		"rememberDay": int(services.TrustedDeviceDuration.Hours() / 24),
+		"csrfToken":   context.GetString("csrfToken"),
+	})
+}
+
+func loginSecondFactor(context *gin.Context) {
+	session := sessions.Default(context)
+	user := pendingUser(session)
+	if user.ID == 0 {
+		session.Clear()
+		_ = session.Save()
+		context.Redirect(http.StatusFound, "/?error="+url.QueryEscape("验证超时，请重新登录"))
+		return
+	}
+
+	if err := services.VerifySecondFactor(user.ID, context.PostForm("code")); err != nil {
+		log.Printf("[USER] Two-factor verification failed for %s from %s", user.Username, context.ClientIP())
+		// 错误次数记录在数据库中，锁定后需要等待并重新输入密码
+		if errors.Is(err, services.ErrSecondFactorLocked) {
+			session.Clear()
+			_ = session.Save()
+			context.Redirect(http.StatusFound, "/?error="+url.QueryEscape(err.Error()))
+			return
+		}
+		context.Redirect(http.StatusFound, "/login/2fa?error="+url.QueryEscape(err.Error()))
+		return
+	}
+
+	if context.PostForm("remember") != "" {
+		token, err := services.TrustDevice(user.ID, context.Request.UserAgent(), context.ClientIP())
+		if err != nil {
+			log.Printf("[USER] Failed to remember device for %s: %v", user.Username, err)
+		} else {
+			context.SetSameSite(http.SameSiteLaxMode)
+			context.SetCookie(trustedDeviceCookie, token, int(services.TrustedDeviceDuration.Seconds()), "/", "",
+				isSecureRequest(context.Request), true)
+		}
+	}
+	completeLogin(context, user)
+}
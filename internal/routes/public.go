@@ -1,13 +1,16 @@
 package routes
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"runtime"
+	"time"
 	"uranus/internal/config"
 	"uranus/internal/services"
 )
@@ -24,39 +27,54 @@ type VersionResponse struct {
 func publicRoute(engine *gin.Engine) {
 
 	// 登录路由
-	engine.GET("/", func(context *gin.Context) {
-		session := sessions.Default(context)
-		if session.Get("login") == true {
+	engine.GET("/", csrf, func(context *gin.Context) {
+		if _, _, ok := loginSession(sessions.Default(context)); ok {
 			context.Redirect(http.StatusFound, "/admin/dashboard")
 			context.Abort()
 		} else {
-			context.HTML(http.StatusOK, "login.html", gin.H{})
+			context.HTML(http.StatusOK, "login.html", gin.H{
+				"error":     context.Query("error"),
+				"csrfToken": context.GetString("csrfToken"),
+			})
 		}
 	})
 
-	engine.GET("/logout", func(context *gin.Context) {
+	engine.POST("/logout", csrf, func(context *gin.Context) {
 		session := sessions.Default(context)
 		if session.Get("login") == true {
-			session.Delete("login")
+			token, _ := session.Get("token").(string)
+			services.RevokeSessionToken(token)
+			session.Clear()
 			_ = session.Save()
 		}
 		context.Redirect(http.StatusFound, "/")
 	})
 
-	engine.POST("/login", func(context *gin.Context) {
+	engine.POST("/login", csrf, func(context *gin.Context) {
 		session := sessions.Default(context)
 		username, _ := context.GetPostForm("username")
 		password, _ := context.GetPostForm("password")
-		if username == config.GetAppConfig().Username && password == config.GetAppConfig().Password {
-			session.Set("login", true)
+		user, err := services.Authenticate(username, password)
+		if err != nil {
+			log.Printf("[USER] Login failed for %s from %s", username, context.ClientIP())
+			context.Redirect(http.StatusFound, "/?error="+url.QueryEscape(err.Error()))
+		} else if deviceToken, _ := context.Cookie(trustedDeviceCookie); user.TOTPEnabled && !services.IsTrustedDevice(user.ID, deviceToken) {
+			// 启用了两步验证且不是记住的设备，密码正确后还需要输入验证码
+			session.Clear()
+			session.Set("pendingUserId", user.ID)
+			session.Set("pendingAt", time.Now().Unix())
 			_ = session.Save()
-			context.Redirect(http.StatusFound, "/admin/dashboard")
+			context.Redirect(http.StatusFound, "/login/2fa")
 		} else {
-			context.Redirect(http.StatusFound, "/")
+			completeLogin(context, user)
 		}
 		context.Abort()
 	})
 
+	// 两步验证
+	engine.GET("/login/2fa", csrf, loginSecondFactorPage)
+	engine.POST("/login/2fa", csrf, loginSecondFactor)
+
 	engine.GET("/info", func(context *gin.Context) {
 		context.JSON(200, gin.H{
 			"buildName":    config.BuildName,
@@ -114,34 +132,16 @@ func publicRoute(engine *gin.Engine) {
 		}
 	})
 
-	// 升级接口：支持本地调用和远程调用
+	// 远程升级接口，控制中心使用 Token 调用。页面上的升级按钮使用 /admin/upgrade
 	engine.POST("/upgrade", func(context *gin.Context) {
-		// 检查是否是内部直接调用的场景（没有请求体或请求体为空）
-		if context.Request.ContentLength == 0 {
-			log.Printf("[升级] 本地直接调用升级接口")
-
-			// 执行升级操作，无需验证token
-			go func() {
-				upgradeErr := services.ToUpdateProgram("https://fr.qfdk.me/uranus/uranus-" + runtime.GOARCH)
-				if upgradeErr != nil {
-					log.Printf("[升级] 升级过程出错: %v", upgradeErr)
-				}
-			}()
-
-			context.JSON(200, gin.H{
-				"status":  "OK",
-				"message": "本地升级请求已接收，正在处理中",
-			})
-			return
-		}
-
 		// 远程调用场景，需要验证token
 		var requestData map[string]interface{}
 		if err := context.BindJSON(&requestData); err == nil {
 			// 检查token是否匹配
 			if token, exists := requestData["token"].(string); exists {
 				// 验证token是否正确
-				if token == config.GetAppConfig().Token {
+				expected := config.GetAppConfig().Token
+				if expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
 					// 记录日志
 					log.Printf("[升级] 收到远程升级请求，Token验证通过")
 
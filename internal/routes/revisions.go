@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"uranus/internal/controllers"
+)
+
+func revisionsRoute(engine *gin.RouterGroup) {
+	engine.GET("/revisions", controllers.Revisions)
+	engine.GET("/revisions/compare", controllers.CompareRevisions)
+	engine.GET("/revisions/:id", controllers.GetRevision)
+	engine.POST("/revisions/restore/:id", controllers.RestoreRevision)
+
+	// REST API
+	engine.GET("/api/revisions", controllers.RevisionsAPI)
+	engine.GET("/api/revisions/compare", controllers.CompareRevisions)
+	engine.GET("/api/revisions/:id", controllers.GetRevision)
+	engine.POST("/api/revisions/:id/restore", controllers.RestoreRevision)
+}
@@ -0,0 +1,78 @@
+package routes
+
+import (
+	"github.com/gin-contrib/sessions"
+	gsessions "github.com/gorilla/sessions"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"uranus/internal/services"
+)
+
+// sessionStore 可以在运行中更换密钥的 Cookie 存储，轮换密钥后已经登录的用户不会掉线
+type sessionStore struct {
+	mutex sync.RWMutex
+	inner *gsessions.CookieStore
+}
+
+func newSessionStore() *sessionStore {
+	keyPairs, err := services.SessionKeyPairs()
+	if err != nil {
+		log.Fatalf("[SESSION] Failed to load session keys: %v", err)
+	}
+	store := &sessionStore{}
+	store.setKeys(keyPairs)
+	services.SetSessionKeysHandler(store.setKeys)
+	return store
+}
+
+// setKeys 第一对密钥签发新的 Cookie，其余只用于验证旧 Cookie
+func (s *sessionStore) setKeys(keyPairs [][]byte) {
+	inner := gsessions.NewCookieStore(keyPairs...)
+	inner.MaxAge(int(services.SessionMaxAge().Seconds()))
+	s.mutex.Lock()
+	s.inner = inner
+	s.mutex.Unlock()
+}
+
+func (s *sessionStore) current() *gsessions.CookieStore {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.inner
+}
+
+func (s *sessionStore) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(s, name)
+}
+
+func (s *sessionStore) New(r *http.Request, name string) (*gsessions.Session, error) {
+	session, err := s.current().New(r, name)
+	if session != nil {
+		session.Options = cookieOptions(r)
+	}
+	return session, err
+}
+
+func (s *sessionStore) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	return s.current().Save(r, w, session)
+}
+
+// Options Cookie 属性由每个请求决定，见 cookieOptions
+func (s *sessionStore) Options(sessions.Options) {}
+
+// isSecureRequest 直接使用 TLS 或者在反向代理后面使用 HTTPS
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// cookieOptions 会话 Cookie 不能被脚本读取，HTTPS 访问时只通过 HTTPS 发送
+func cookieOptions(r *http.Request) *gsessions.Options {
+	return &gsessions.Options{
+		Path:     "/",
+		MaxAge:   int(services.SessionMaxAge().Seconds()),
+		Secure:   isSecureRequest(r),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -10,6 +10,25 @@ func sitesRoute(engine *gin.RouterGroup) {
 	engine.GET("/sites/new", controllers.NewSite)
 	engine.GET("/sites/template", controllers.GetTemplate)
 	engine.GET("/sites/edit/:filename", controllers.EditSiteConf)
-	engine.GET("/sites/delete/:filename", controllers.DeleteSiteConf)
+	engine.POST("/sites/delete/:filename", controllers.DeleteSiteConf)
+	engine.POST("/sites/disable/:filename", controllers.DisableSite)
+	engine.POST("/sites/enable/:filename", controllers.EnableSite)
+	engine.GET("/sites/maintenance/:filename", controllers.MaintenancePage)
+	engine.POST("/sites/maintenance/:filename", controllers.SaveMaintenance)
+	engine.POST("/sites/maintenance/:filename/enable", controllers.EnableMaintenance)
+	engine.POST("/sites/maintenance/:filename/disable", controllers.DisableMaintenance)
+
+	// 维护模式 REST 接口
+	engine.GET("/api/sites/:filename/maintenance", controllers.GetMaintenance)
+	engine.PUT("/api/sites/:filename/maintenance", controllers.SaveMaintenance)
+	engine.POST("/api/sites/:filename/maintenance/enable", controllers.EnableMaintenance)
+	engine.POST("/api/sites/:filename/maintenance/disable", controllers.DisableMaintenance)
 	engine.POST("/sites/save", controllers.SaveSiteConf)
+	engine.GET("/sites/form", controllers.SiteForm)
+	engine.GET("/sites/form/:filename", controllers.SiteForm)
+	engine.POST("/sites/form/preview", controllers.PreviewSiteForm)
+	engine.POST("/sites/form/save", controllers.SaveSiteForm)
+	engine.POST("/sites/mode/:filename", controllers.SetSiteMode)
+	engine.GET("/sites/reconcile", controllers.ReconcileSites)
+	engine.POST("/sites/reconcile", controllers.ReconcileSites)
 }
@@ -7,7 +7,35 @@ import (
 
 func sslRoute(engine *gin.RouterGroup) {
 	engine.GET("/ssl", controllers.Certificates)
-	engine.GET("/ssl/renew", controllers.IssueCert)
+	engine.POST("/ssl/renew", controllers.IssueCert)
+	engine.GET("/ssl/check", controllers.CheckCertReadiness)
+	engine.POST("/ssl/check", controllers.CheckCertReadiness)
 	engine.GET("/ssl/info", controllers.CertInfo)
-	engine.GET("/ssl/delete", controllers.DeleteSSL)
+	engine.POST("/ssl/inspect", controllers.InspectTLS)
+	engine.POST("/ssl/delete", controllers.DeleteSSL)
+	engine.POST("/ssl/challenge", controllers.SetCertChallenge)
+	engine.POST("/ssl/issuer", controllers.SetCertIssuer)
+	engine.POST("/ssl/shared/save", controllers.CreateSharedCert)
+	engine.POST("/ssl/upload", controllers.UploadCert)
+	engine.POST("/ssl/revoke/:name", controllers.RevokeCert)
+	engine.POST("/ssl/rotate/:name", controllers.RotateCertKey)
+	engine.POST("/ssl/ca/create", controllers.CreateInternalCA)
+	engine.GET("/ssl/ca/root.crt", controllers.DownloadInternalCARoot)
+	engine.POST("/ssl/account/rotate", controllers.RotateACMEAccountKey)
+	engine.POST("/ssl/dns/save", controllers.SaveDNSCredential)
+	engine.POST("/ssl/dns/delete/:id", controllers.DeleteDNSCredential)
+	engine.POST("/ssl/acme/save", controllers.SaveACMEServer)
+	engine.POST("/ssl/acme/delete/:id", controllers.DeleteACMEServer)
+
+	// 证书吊销、轮换、续期记录和申请前检查 REST 接口
+	engine.GET("/api/ssl/:name/events", controllers.CertEvents)
+	engine.GET("/api/ssl/:name/renewals", controllers.RenewalAttempts)
+	engine.GET("/api/ssl/:name/readiness", controllers.CheckCertReadiness)
+	engine.POST("/api/ssl/:name/readiness", controllers.CheckCertReadiness)
+	engine.POST("/api/ssl/:name/revoke", controllers.RevokeCert)
+	engine.POST("/api/ssl/:name/rotate", controllers.RotateCertKey)
+
+	// nginx 实际返回的证书检查
+	engine.GET("/api/ssl/inspect", controllers.TLSInspections)
+	engine.POST("/api/ssl/inspect", controllers.InspectTLS)
 }
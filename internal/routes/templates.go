@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"uranus/internal/controllers"
+)
+
+func templatesRoute(engine *gin.RouterGroup) {
+	engine.GET("/templates", controllers.SiteTemplates)
+	engine.POST("/templates/preview", controllers.PreviewCustomTemplate)
+	engine.POST("/templates/save", controllers.SaveCustomTemplate)
+	engine.POST("/templates/delete/:id", controllers.DeleteCustomTemplate)
+}
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"uranus/internal/controllers"
+)
+
+func upstreamsRoute(engine *gin.RouterGroup) {
+	engine.GET("/upstreams", controllers.Upstreams)
+	engine.GET("/upstreams/status", controllers.UpstreamStatus)
+	engine.POST("/upstreams/save", controllers.SaveUpstreamPool)
+	engine.POST("/upstreams/delete/:id", controllers.DeleteUpstreamPool)
+}
@@ -0,0 +1,365 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-acme/lego/v4/acme/api"
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/lego"
+	"github.com/go-acme/lego/v4/registration"
+	"gopkg.in/square/go-jose.v2"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"uranus/internal/config"
+)
+
+// ACMEAccount 保存在数据目录中的 ACME 账户，按 CA 目录地址和邮箱区分，私钥加密保存
+type ACMEAccount struct {
+	Email        string                 `json:"email"`
+	CADirURL     string                 `json:"caDirUrl"`
+	Registration *registration.Resource `json:"registration"`
+	Key          string                 `json:"key"`
+	CreatedAt    time.Time              `json:"createdAt"`
+	KeyRotatedAt time.Time              `json:"keyRotatedAt,omitempty"`
+}
+
+// ACMEAccountInfo SSL 页面上展示的账户信息，不包含私钥
+type ACMEAccountInfo struct {
+	Email        string    `json:"email"`
+	CADirURL     string    `json:"caDirUrl"`
+	URI          string    `json:"uri"`
+	Status       string    `json:"status"`
+	CreatedAt    time.Time `json:"createdAt"`
+	KeyRotatedAt time.Time `json:"keyRotatedAt"`
+	Current      bool      `json:"current"` // 当前签发证书使用的账户
+}
+
+var (
+	acmeAccountMutex    sync.Mutex
+	acmePathUnsafeRegex = regexp.MustCompile(`[^a-zA-Z0-9.@_-]+`)
+)
+
+// ACMEAccountDir ACME 账户保存目录
+func ACMEAccountDir() string {
+	return filepath.Join(config.GetAppConfig().InstallPath, "acme", "accounts")
+}
+
+// acmeDirectoryURL 当前使用的 CA 目录地址，非生产环境使用 Let's Encrypt 测试环境
+func acmeDirectoryURL() string {
+	if gin.Mode() != gin.ReleaseMode {
+		return lego.LEDirectoryStaging
+	}
+	return lego.LEDirectoryProduction
+}
+
+// acmeAccountFile 账户文件路径: acme/accounts/<CA 主机和路径>/<邮箱>.json
+func acmeAccountFile(caDirURL string, email string) string {
+	ca := caDirURL
+	if u, err := url.Parse(caDirURL); err == nil && u.Host != "" {
+		ca = u.Host + u.Path
+	}
+	if email == "" {
+		email = "default"
+	}
+	return filepath.Join(ACMEAccountDir(),
+		strings.Trim(acmePathUnsafeRegex.ReplaceAllString(ca, "_"), "_"),
+		acmePathUnsafeRegex.ReplaceAllString(email, "_")+".json")
+}
+
+func readACMEAccount(path string) (*ACMEAccount, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var account ACMEAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("ACME 账户文件格式错误: %v", err)
+	}
+	return &account, nil
+}
+
+// privateKey 解密账户私钥
+func (a *ACMEAccount) privateKey() (crypto.PrivateKey, error) {
+	data, err := decryptData(a.Key)
+	if err != nil {
+		return nil, err
+	}
+	return certcrypto.ParsePEMPrivateKey(data)
+}
+
+// saveACMEAccount 加密私钥后写入账户文件
+func saveACMEAccount(account *ACMEAccount, key crypto.PrivateKey) error {
+	return writeACMEAccount(acmeAccountFile(account.CADirURL, account.Email), account, key)
+}
+
+// writeACMEAccount 加密私钥后把账户写入 path，文件只有 root 可读
+func writeACMEAccount(path string, account *ACMEAccount, key crypto.PrivateKey) error {
+	encrypted, err := encryptData(certcrypto.PEMEncode(key))
+	if err != nil {
+		return err
+	}
+	account.Key = encrypted
+	data, err := json.MarshalIndent(account, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// newACMEClient 使用保存的 ACME 账户创建客户端，账户不存在时生成私钥并注册，
+// 申请、续期和吊销证书共用同一个账户，每个 CA 各有一个账户
+func newACMEClient(issuer *acmeIssuer) (*lego.Client, error) {
+	acmeAccountMutex.Lock()
+	defer acmeAccountMutex.Unlock()
+
+	caDirURL := issuer.DirectoryURL
+	email := config.GetAppConfig().Email
+	path := acmeAccountFile(caDirURL, email)
+
+	var key crypto.PrivateKey
+	account, err := readACMEAccount(path)
+	if err == nil {
+		if key, err = account.privateKey(); err != nil {
+			return nil, fmt.Errorf("读取 ACME 账户私钥失败: %v", err)
+		}
+	} else if os.IsNotExist(err) {
+		if key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+			return nil, err
+		}
+		account = &ACMEAccount{Email: email, CADirURL: caDirURL, CreatedAt: time.Now()}
+	} else {
+		return nil, err
+	}
+
+	user := &MyUser{Email: email, Registration: account.Registration, key: key}
+	legoConfig := lego.NewConfig(user)
+	legoConfig.CADirURL = caDirURL
+	legoConfig.Certificate.KeyType = issuer.KeyType
+	if legoConfig.HTTPClient, err = acmeHTTPClient(issuer.RootCA); err != nil {
+		return nil, err
+	}
+
+	client, err := lego.NewClient(legoConfig)
+	if err != nil {
+		log.Printf("[SSL] Failed to create ACME client: %v", err)
+		return nil, err
+	}
+
+	if account.Registration == nil {
+		var reg *registration.Resource
+		if issuer.EABKeyID != "" {
+			reg, err = client.Registration.RegisterWithExternalAccountBinding(registration.RegisterEABOptions{
+				TermsOfServiceAgreed: true,
+				Kid:                  issuer.EABKeyID,
+				HmacEncoded:          issuer.EABHMACKey,
+			})
+		} else {
+			reg, err = client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("注册 ACME 账户失败: %v", err)
+		}
+		user.Registration = reg
+		account.Registration = reg
+		if err := saveACMEAccount(account, key); err != nil {
+			return nil, fmt.Errorf("保存 ACME 账户失败: %v", err)
+		}
+		log.Printf("[SSL] Registered ACME account %s at %s", reg.URI, caDirURL)
+	}
+	return client, nil
+}
+
+// ACMEAccounts 列出数据目录中保存的所有 ACME 账户
+func ACMEAccounts() []ACMEAccountInfo {
+	current := acmeAccountFile(defaultACMEServer().DirectoryURL, config.GetAppConfig().Email)
+	accounts := []ACMEAccountInfo{}
+	_ = filepath.Walk(ACMEAccountDir(), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+		account, err := readACMEAccount(path)
+		if err != nil {
+			log.Printf("[SSL] %s: %v", path, err)
+			return nil
+		}
+		item := ACMEAccountInfo{
+			Email:        account.Email,
+			CADirURL:     account.CADirURL,
+			CreatedAt:    account.CreatedAt,
+			KeyRotatedAt: account.KeyRotatedAt,
+			Current:      path == current,
+		}
+		if account.Registration != nil {
+			item.URI = account.Registration.URI
+			item.Status = account.Registration.Body.Status
+		}
+		accounts = append(accounts, item)
+		return nil
+	})
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].Current || (!accounts[j].Current && accounts[i].CADirURL < accounts[j].CADirURL)
+	})
+	return accounts
+}
+
+// RotateACMEAccountKey 按 RFC 8555 7.3.5 更换账户私钥，账户和证书历史保持不变
+func RotateACMEAccountKey(caDirURL string, email string) error {
+	acmeAccountMutex.Lock()
+	defer acmeAccountMutex.Unlock()
+
+	account, err := readACMEAccount(acmeAccountFile(caDirURL, email))
+	if err != nil {
+		return errors.New("ACME 账户不存在")
+	}
+	if account.Registration == nil || account.Registration.URI == "" {
+		return errors.New("ACME 账户还没有注册")
+	}
+	oldKey, err := account.privateKey()
+	if err != nil {
+		return err
+	}
+	newKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	// 先把新私钥写入待生效的文件，CA 接受后再替换账户文件，
+	// 避免 CA 已经更换私钥而本地没有保存新私钥，导致账户无法再使用
+	path := acmeAccountFile(caDirURL, email)
+	pendingPath := path + ".pending"
+	account.KeyRotatedAt = time.Now()
+	if err := writeACMEAccount(pendingPath, account, newKey); err != nil {
+		return fmt.Errorf("保存新的账户私钥失败: %v", err)
+	}
+	if err := acmeKeyChange(account, oldKey, newKey); err != nil {
+		_ = os.Remove(pendingPath)
+		return fmt.Errorf("更换账户私钥失败: %v", err)
+	}
+	if err := os.Rename(pendingPath, path); err != nil {
+		return fmt.Errorf("CA 已更换私钥，但替换账户文件失败，新私钥保存在 %s: %v", pendingPath, err)
+	}
+	log.Printf("[SSL] Rotated ACME account key for %s", account.Registration.URI)
+	return nil
+}
+
+// acmeNonceSource 从 CA 的 newNonce 地址获取 nonce
+type acmeNonceSource struct {
+	client *http.Client
+	url    string
+}
+
+func (n *acmeNonceSource) Nonce() (string, error) {
+	resp, err := n.client.Head(n.url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", errors.New("CA 没有返回 Replay-Nonce")
+	}
+	return nonce, nil
+}
+
+func jwsAlgorithm(key crypto.PrivateKey) (jose.SignatureAlgorithm, error) {
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return jose.ES256, nil
+		case elliptic.P384():
+			return jose.ES384, nil
+		}
+	case *rsa.PrivateKey:
+		return jose.RS256, nil
+	}
+	return "", errors.New("不支持的账户私钥类型")
+}
+
+// acmeKeyChange 发送 keyChange 请求，内层 JWS 由新私钥签名，外层由旧私钥签名
+func acmeKeyChange(account *ACMEAccount, oldKey crypto.PrivateKey, newKey crypto.PrivateKey) error {
+	httpClient, err := acmeHTTPClient(acmeRootCAForDirectory(account.CADirURL))
+	if err != nil {
+		return err
+	}
+	core, err := api.New(httpClient, "uranus", account.CADirURL, account.Registration.URI, oldKey)
+	if err != nil {
+		return err
+	}
+	directory := core.GetDirectory()
+	if directory.KeyChangeURL == "" {
+		return errors.New("CA 不支持更换账户私钥")
+	}
+
+	oldPublic := oldKey.(crypto.Signer).Public()
+	payload, err := json.Marshal(map[string]interface{}{
+		"account": account.Registration.URI,
+		"oldKey":  jose.JSONWebKey{Key: oldPublic},
+	})
+	if err != nil {
+		return err
+	}
+	newAlg, err := jwsAlgorithm(newKey)
+	if err != nil {
+		return err
+	}
+	innerSigner, err := jose.NewSigner(jose.SigningKey{Algorithm: newAlg, Key: newKey},
+		(&jose.SignerOptions{EmbedJWK: true}).WithHeader("url", directory.KeyChangeURL))
+	if err != nil {
+		return err
+	}
+	inner, err := innerSigner.Sign(payload)
+	if err != nil {
+		return err
+	}
+
+	oldAlg, err := jwsAlgorithm(oldKey)
+	if err != nil {
+		return err
+	}
+	outerSigner, err := jose.NewSigner(jose.SigningKey{Algorithm: oldAlg, Key: oldKey},
+		(&jose.SignerOptions{NonceSource: &acmeNonceSource{client: httpClient, url: directory.NewNonceURL}}).
+			WithHeader("kid", account.Registration.URI).
+			WithHeader("url", directory.KeyChangeURL))
+	if err != nil {
+		return err
+	}
+	outer, err := outerSigner.Sign([]byte(inner.FullSerialize()))
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Post(directory.KeyChangeURL, "application/jose+json", strings.NewReader(outer.FullSerialize()))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/go-acme/lego/v4/certcrypto"
+	"github.com/go-acme/lego/v4/lego"
+	"gorm.io/gorm"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"uranus/internal/models"
+)
+
+// 证书私钥类型
+const (
+	KeyTypeEC256   = "EC256"
+	KeyTypeEC384   = "EC384"
+	KeyTypeRSA2048 = "RSA2048"
+	KeyTypeRSA4096 = "RSA4096"
+)
+
+// DefaultKeyType 没有设置时使用的私钥类型
+const DefaultKeyType = KeyTypeRSA2048
+
+var acmeKeyTypes = map[string]certcrypto.KeyType{
+	KeyTypeEC256:   certcrypto.EC256,
+	KeyTypeEC384:   certcrypto.EC384,
+	KeyTypeRSA2048: certcrypto.RSA2048,
+	KeyTypeRSA4096: certcrypto.RSA4096,
+}
+
+// ACMEKeyTypes 可以选择的私钥类型
+func ACMEKeyTypes() []string {
+	return []string{KeyTypeEC256, KeyTypeEC384, KeyTypeRSA2048, KeyTypeRSA4096}
+}
+
+// ACMEServerPreset 常用 CA 的目录地址，页面上选择后自动填写
+type ACMEServerPreset struct {
+	Name         string `json:"name"`
+	DirectoryURL string `json:"directoryUrl"`
+	EAB          bool   `json:"eab"` // 需要 External Account Binding
+	Note         string `json:"note"`
+}
+
+// ACMEServerPresets 常用 CA
+func ACMEServerPresets() []ACMEServerPreset {
+	return []ACMEServerPreset{
+		{Name: "Let's Encrypt", DirectoryURL: lego.LEDirectoryProduction},
+		{Name: "Let's Encrypt Staging", DirectoryURL: lego.LEDirectoryStaging, Note: "测试环境，证书不受信任"},
+		{Name: "ZeroSSL", DirectoryURL: "https://acme.zerossl.com/v2/DV90", EAB: true, Note: "需要在 ZeroSSL 控制台生成 EAB 凭据"},
+		{Name: "Buypass", DirectoryURL: "https://api.buypass.com/acme/directory"},
+		{Name: "Buypass Test", DirectoryURL: "https://api.test4.buypass.no/acme/directory", Note: "测试环境，证书不受信任"},
+		{Name: "step-ca", DirectoryURL: "https://ca.internal:9000/acme/acme/directory", Note: "修改为自己的 step-ca 地址，并填写根证书路径"},
+		{Name: "pebble", DirectoryURL: "https://localhost:14000/dir", Note: "本地测试 CA，根证书为 pebble 的 test/certs/pebble.minica.pem"},
+	}
+}
+
+// acmeIssuer 申请某个证书时使用的 CA 设置
+type acmeIssuer struct {
+	DirectoryURL string
+	EABKeyID     string
+	EABHMACKey   string
+	RootCA       string
+	KeyType      certcrypto.KeyType
+}
+
+// defaultACMEServer 默认 CA，没有设置时使用 Let's Encrypt，非生产环境使用测试环境
+func defaultACMEServer() models.ACMEServer {
+	server := models.GetDefaultACMEServer()
+	if server.ID == 0 {
+		server.DirectoryURL = acmeDirectoryURL()
+	}
+	return server
+}
+
+// resolveACMEIssuer 证书单独设置的 CA 和私钥类型优先，否则使用默认 CA
+func resolveACMEIssuer(cert *models.Cert) (*acmeIssuer, error) {
+	server := defaultACMEServer()
+	if cert.ACMEServerID != 0 {
+		server = models.GetACMEServerByID(cert.ACMEServerID)
+		if server.ID == 0 {
+			return nil, errors.New("证书使用的 ACME 服务器不存在")
+		}
+	}
+
+	issuer := &acmeIssuer{
+		DirectoryURL: server.DirectoryURL,
+		EABKeyID:     server.EABKeyID,
+		RootCA:       server.RootCA,
+	}
+	if server.EABHMACKey != "" {
+		hmac, err := decryptData(server.EABHMACKey)
+		if err != nil {
+			return nil, fmt.Errorf("读取 EAB 凭据失败: %v", err)
+		}
+		issuer.EABHMACKey = string(hmac)
+	}
+
+	keyType := DefaultKeyType
+	if server.KeyType != "" {
+		keyType = server.KeyType
+	}
+	if cert.KeyType != "" {
+		keyType = cert.KeyType
+	}
+	var ok bool
+	if issuer.KeyType, ok = acmeKeyTypes[keyType]; !ok {
+		return nil, fmt.Errorf("不支持的私钥类型: %s", keyType)
+	}
+	return issuer, nil
+}
+
+// acmeHTTPClient 访问 CA 使用的 HTTP 客户端，rootCA 不为空时额外信任该根证书
+func acmeHTTPClient(rootCA string) (*http.Client, error) {
+	client := lego.NewConfig(&MyUser{}).HTTPClient
+	if rootCA == "" {
+		return client, nil
+	}
+	data, err := os.ReadFile(rootCA)
+	if err != nil {
+		return nil, fmt.Errorf("读取根证书失败: %v", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("根证书 %s 不是有效的 PEM 证书", rootCA)
+	}
+	if transport, ok := client.Transport.(*http.Transport); ok {
+		transport.TLSClientConfig.RootCAs = pool
+	}
+	return client, nil
+}
+
+// acmeRootCAForDirectory 根据目录地址找到自定义 CA 的根证书
+func acmeRootCAForDirectory(directoryURL string) string {
+	for _, server := range models.GetACMEServers() {
+		if server.DirectoryURL == directoryURL {
+			return server.RootCA
+		}
+	}
+	return ""
+}
+
+// SaveACMEServer 新建或修改 ACME 服务器，EAB HMAC 留空时保留原来的值
+func SaveACMEServer(server *models.ACMEServer, hmacKey string) error {
+	server.Name = strings.TrimSpace(server.Name)
+	server.DirectoryURL = strings.TrimSpace(server.DirectoryURL)
+	server.EABKeyID = strings.TrimSpace(server.EABKeyID)
+	server.RootCA = strings.TrimSpace(server.RootCA)
+	if server.Name == "" {
+		return errors.New("请填写名称")
+	}
+	if u, err := url.Parse(server.DirectoryURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.New("请填写正确的 ACME 目录地址")
+	}
+	if _, ok := acmeKeyTypes[server.KeyType]; server.KeyType != "" && !ok {
+		return fmt.Errorf("不支持的私钥类型: %s", server.KeyType)
+	}
+	if server.RootCA != "" {
+		if _, err := acmeHTTPClient(server.RootCA); err != nil {
+			return err
+		}
+	}
+
+	existing := models.GetACMEServerByID(server.ID)
+	if server.ID != 0 && existing.ID == 0 {
+		return errors.New("ACME 服务器不存在")
+	}
+	var sameName models.ACMEServer
+	models.GetDbClient().Find(&sameName, "name = ?", server.Name)
+	if sameName.ID != 0 && sameName.ID != server.ID {
+		return fmt.Errorf("ACME 服务器 %s 已存在", server.Name)
+	}
+
+	server.EABHMACKey = existing.EABHMACKey
+	if hmacKey = strings.TrimSpace(hmacKey); hmacKey != "" {
+		encrypted, err := encryptData([]byte(hmacKey))
+		if err != nil {
+			return err
+		}
+		server.EABHMACKey = encrypted
+	}
+	if server.EABKeyID == "" {
+		server.EABHMACKey = ""
+	} else if server.EABHMACKey == "" {
+		return errors.New("请填写 EAB HMAC Key")
+	}
+	server.CreatedAt = existing.CreatedAt
+
+	// 只能有一个默认 CA
+	return models.GetDbClient().Transaction(func(tx *gorm.DB) error {
+		if server.IsDefault {
+			if err := tx.Model(&models.ACMEServer{}).Where("id <> ?", server.ID).Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Save(server).Error
+	})
+}
+
+// DeleteACMEServer 删除 ACME 服务器，仍被证书使用时不能删除
+func DeleteACMEServer(id uint) error {
+	server := models.GetACMEServerByID(id)
+	if server.ID == 0 {
+		return errors.New("ACME 服务器不存在")
+	}
+	if certs := models.GetCertsUsingACMEServer(id); len(certs) > 0 {
+		var names []string
+		for _, cert := range certs {
+			names = append(names, cert.FileName)
+		}
+		return fmt.Errorf("ACME 服务器正在被证书使用: %s", strings.Join(names, ", "))
+	}
+	return server.Remove()
+}
+
+// SetCertIssuer 设置证书使用的 CA 和私钥类型，下次申请或续期时生效，
+// internalCA 为 true 时使用内部 CA 签发，serverID 无效
+func SetCertIssuer(configName string, shared bool, serverID uint, internalCA bool, keyType string) error {
+	if internalCA {
+		serverID = 0
+	}
+	if serverID != 0 && models.GetACMEServerByID(serverID).ID == 0 {
+		return errors.New("ACME 服务器不存在")
+	}
+	if _, ok := acmeKeyTypes[keyType]; keyType != "" && !ok {
+		return fmt.Errorf("不支持的私钥类型: %s", keyType)
+	}
+	cert := models.GetCertByFilename(configName)
+	if shared {
+		cert = models.GetSharedCert(configName)
+	}
+	if cert.ID == 0 {
+		return errors.New("证书不存在")
+	}
+	return models.GetDbClient().Model(&cert).Updates(map[string]interface{}{
+		"acme_server_id": serverID,
+		"internal_ca":    internalCA,
+		"key_type":       keyType,
+	}).Error
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ariWindow CA 通过 ACME Renewal Information (RFC 9773) 建议的续期窗口
+type ariWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// ariCertID 证书在 ARI 中的标识: base64url(AKI).base64url(序列号)
+func ariCertID(leaf *x509.Certificate) (string, error) {
+	if len(leaf.AuthorityKeyId) == 0 {
+		return "", errors.New("证书没有 Authority Key Identifier")
+	}
+	// 序列号使用 DER 编码的整数，最高位为 1 时需要补 0
+	serial := leaf.SerialNumber.Bytes()
+	if len(serial) == 0 || serial[0]&0x80 != 0 {
+		serial = append([]byte{0}, serial...)
+	}
+	return base64.RawURLEncoding.EncodeToString(leaf.AuthorityKeyId) + "." +
+		base64.RawURLEncoding.EncodeToString(serial), nil
+}
+
+func getJSON(client *http.Client, url string, v interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s 返回 %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// fetchRenewalInfo 查询证书的建议续期窗口，CA 不支持 ARI 时返回 nil
+func fetchRenewalInfo(issuer *acmeIssuer, leaf *x509.Certificate) (*ariWindow, error) {
+	client, err := acmeHTTPClient(issuer.RootCA)
+	if err != nil {
+		return nil, err
+	}
+	var directory struct {
+		RenewalInfo string `json:"renewalInfo"`
+	}
+	if err := getJSON(client, issuer.DirectoryURL, &directory); err != nil {
+		return nil, err
+	}
+	if directory.RenewalInfo == "" {
+		return nil, nil
+	}
+	certID, err := ariCertID(leaf)
+	if err != nil {
+		return nil, err
+	}
+	var info struct {
+		SuggestedWindow ariWindow `json:"suggestedWindow"`
+	}
+	if err := getJSON(client, directory.RenewalInfo+"/"+certID, &info); err != nil {
+		return nil, err
+	}
+	window := info.SuggestedWindow
+	if window.Start.IsZero() || window.End.Before(window.Start) {
+		return nil, errors.New("ARI 返回的续期窗口无效")
+	}
+	return &window, nil
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-acme/lego/v4/acme"
+	"github.com/go-acme/lego/v4/certcrypto"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"uranus/internal/models"
+)
+
+// CertRevocationReason 吊销原因，ACME 只接受 RFC 5280 中的部分原因
+type CertRevocationReason struct {
+	Code  uint   `json:"code"`
+	Label string `json:"label"`
+}
+
+// CertRevocationReasons 可以选择的吊销原因
+func CertRevocationReasons() []CertRevocationReason {
+	return []CertRevocationReason{
+		{Code: acme.CRLReasonUnspecified, Label: "未指定"},
+		{Code: acme.CRLReasonKeyCompromise, Label: "私钥泄露"},
+		{Code: acme.CRLReasonAffiliationChanged, Label: "信息变更"},
+		{Code: acme.CRLReasonSuperseded, Label: "已被新证书替代"},
+		{Code: acme.CRLReasonCessationOfOperation, Label: "停止使用"},
+	}
+}
+
+func validRevocationReason(reason uint) bool {
+	for _, item := range CertRevocationReasons() {
+		if item.Code == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// findManagedCert 根据名称查找证书，shared 表示共享证书
+func findManagedCert(configName string, shared bool) (models.Cert, error) {
+	cert := models.GetCertByFilename(configName)
+	if shared {
+		cert = models.GetSharedCert(configName)
+	}
+	if cert.ID == 0 {
+		return cert, errors.New("证书不存在")
+	}
+	return cert, nil
+}
+
+// readCertPEM 读取证书目录中的证书链和序列号
+func readCertPEM(cert *models.Cert) ([]byte, string, error) {
+	data, err := os.ReadFile(filepath.Join(CertDir(cert), "fullchain.cer"))
+	if err != nil {
+		return nil, "", fmt.Errorf("读取证书文件失败: %v", err)
+	}
+	leaf, err := certcrypto.ParsePEMCertificate(data)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, certSerial(leaf.SerialNumber.Bytes()), nil
+}
+
+func certSerial(serial []byte) string {
+	hex := make([]string, len(serial))
+	for i, b := range serial {
+		hex[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(hex, ":")
+}
+
+// recordCertEvent 保存审计记录，失败的操作也记录
+func recordCertEvent(event *models.CertEvent, err error) {
+	event.Success = err == nil
+	if err != nil {
+		event.Message = err.Error()
+	}
+	if dbErr := models.GetDbClient().Create(event).Error; dbErr != nil {
+		log.Printf("[SSL] Failed to save certificate event: %v", dbErr)
+	}
+}
+
+// revokeAtCA 向签发证书的 CA 吊销证书
+func revokeAtCA(cert *models.Cert, certPEM []byte, reason uint) error {
+	issuer, err := resolveACMEIssuer(cert)
+	if err != nil {
+		return err
+	}
+	client, err := newACMEClient(issuer)
+	if err != nil {
+		return err
+	}
+	return client.Certificate.RevokeWithReason(certPEM, &reason)
+}
+
+// RevokeCert 吊销证书，证书文件保留，站点需要重新签发或删除证书。吊销后不再自动续期
+func RevokeCert(configName string, shared bool, reason uint, author string, source string) error {
+	cert, err := findManagedCert(configName, shared)
+	if err != nil {
+		return err
+	}
+	event := &models.CertEvent{
+		FileName: cert.FileName,
+		Shared:   cert.Shared,
+		Action:   models.CertActionRevoke,
+		Reason:   reason,
+		Author:   author,
+		Source:   source,
+	}
+	err = revokeCert(&cert, reason, event)
+	recordCertEvent(event, err)
+	return err
+}
+
+func revokeCert(cert *models.Cert, reason uint, event *models.CertEvent) error {
+	switch {
+	case !validRevocationReason(reason):
+		return fmt.Errorf("不支持的吊销原因: %d", reason)
+	case cert.Uploaded:
+		return errors.New("上传的证书需要到签发的 CA 吊销")
+	case cert.InternalCA:
+		return errors.New("内部 CA 的证书不支持吊销，可以轮换私钥重新签发")
+	case cert.RevokedAt != nil:
+		return errors.New("证书已经吊销")
+	}
+	certPEM, serial, err := readCertPEM(cert)
+	if err != nil {
+		return err
+	}
+	event.Serial = serial
+	if err := revokeAtCA(cert, certPEM, reason); err != nil {
+		return fmt.Errorf("吊销证书失败: %v", err)
+	}
+
+	now := time.Now()
+	if err := models.GetDbClient().Model(cert).Update("revoked_at", &now).Error; err != nil {
+		return err
+	}
+	log.Printf("[SSL] Revoked certificate %s (serial %s, reason %d)", cert.FileName, serial, reason)
+	return nil
+}
+
+// RotateCertKey 生成新的私钥并重新签发证书，revokeOld 为 true 时签发成功后吊销旧证书，
+// 私钥泄露时应当吊销
+func RotateCertKey(configName string, shared bool, revokeOld bool, reason uint, author string, source string) error {
+	cert, err := findManagedCert(configName, shared)
+	if err != nil {
+		return err
+	}
+	if cert.Uploaded {
+		return errors.New("上传的证书不能轮换私钥，请上传新证书")
+	}
+	if revokeOld && !validRevocationReason(reason) {
+		return fmt.Errorf("不支持的吊销原因: %d", reason)
+	}
+
+	// 旧证书已经被删除时直接重新签发
+	oldPEM, oldSerial, readErr := readCertPEM(&cert)
+	event := &models.CertEvent{
+		FileName: cert.FileName,
+		Shared:   cert.Shared,
+		Action:   models.CertActionRotate,
+		Serial:   oldSerial,
+		Author:   author,
+		Source:   source,
+	}
+	if revokeOld {
+		event.Reason = reason
+	}
+
+	// 每次签发都会生成新的私钥
+	old := cert
+	err = issueCertificate(&cert, nil)
+	if err == nil {
+		if _, newSerial, err := readCertPEM(&cert); err == nil {
+			event.NewSerial = newSerial
+		}
+		log.Printf("[SSL] Rotated key for certificate %s (%s -> %s)", cert.FileName, oldSerial, event.NewSerial)
+	}
+	if err == nil && revokeOld && readErr == nil && !old.InternalCA && old.RevokedAt == nil {
+		if revokeErr := revokeAtCA(&old, oldPEM, reason); revokeErr != nil {
+			err = fmt.Errorf("新证书已签发，但吊销旧证书失败: %v", revokeErr)
+		}
+	}
+	recordCertEvent(event, err)
+	return err
+}
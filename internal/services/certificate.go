@@ -2,22 +2,16 @@ package services
 
 import (
 	"crypto"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
-	"github.com/gin-gonic/gin"
-	"github.com/go-acme/lego/v4/certcrypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"github.com/go-acme/lego/v4/certificate"
-	"github.com/go-acme/lego/v4/challenge/http01"
-	"github.com/go-acme/lego/v4/lego"
 	"github.com/go-acme/lego/v4/registration"
-	"io/ioutil"
 	"log"
 	"os"
-	"path"
 	"path/filepath"
 	"strings"
-	. "uranus/internal/config"
+	"time"
 	models2 "uranus/internal/models"
 )
 
@@ -38,16 +32,27 @@ func (u *MyUser) GetPrivateKey() crypto.PrivateKey {
 	return u.key
 }
 
+// IssueCert 为站点申请或续签证书，证书保存在 SSLPath/configName
 func IssueCert(domains []string, configName string) error {
-	// Create a user. New accounts need an email and private key to start.
-	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err != nil {
-		return err
+	cert := models2.GetCertByFilename(configName)
+	cert.FileName = configName
+	return issueCertificate(&cert, domains)
+}
+
+// issueCertificate 通过 ACME 或内部 CA 申请证书并写入 CertDir，经过 nginx -t 检测后 reload 一次，
+// 引用同一个共享证书的站点一起生效
+func issueCertificate(cert *models2.Cert, domains []string) error {
+	if cert.Uploaded {
+		return errors.New("上传的证书不能通过 ACME 续期，请上传新证书")
 	}
+	certificateSavedDir := CertDir(cert)
 	// 如果没有传入域名的话，默认是点击续签
 	// 需要读取保存的domains 列表
 	if len(domains) == 0 {
-		data, err := os.ReadFile(path.Join(GetAppConfig().SSLPath, configName, "domains"))
+		data, err := os.ReadFile(filepath.Join(certificateSavedDir, "domains"))
+		if err != nil && cert.Shared && cert.Domains != "" {
+			data, err = []byte(cert.Domains), nil
+		}
 		if err != nil {
 			log.Printf("[SSL] Failed to read domains file: %v", err)
 			return err
@@ -55,69 +60,118 @@ func IssueCert(domains []string, configName string) error {
 		domains = strings.Split(string(data), ",")
 	}
 
-	myUser := MyUser{
-		Email: GetAppConfig().Email,
-		key:   privateKey,
+	var certPEM, keyPEM []byte
+	var err error
+	if cert.InternalCA {
+		certPEM, keyPEM, err = issueInternalCertificate(cert, domains)
+	} else if report := checkReadiness(cert, domains, false); !report.Ready {
+		// 下单前检查域名解析、验证端口和 DNS 凭据，避免验证失败触发 CA 的频率限制
+		return &ReadinessError{Report: report}
+	} else {
+		certPEM, keyPEM, err = obtainACMECertificate(cert, domains)
 	}
-
-	config := lego.NewConfig(&myUser)
-
-	// 不是生产环境用测试 URL
-	if gin.Mode() != gin.ReleaseMode {
-		config.CADirURL = "https://acme-staging-v02.api.letsencrypt.org/directory"
+	if err != nil {
+		return err
 	}
 
-	config.Certificate.KeyType = certcrypto.RSA2048
-
-	// A client facilitates communication with the CA server.
-	client, err := lego.NewClient(config)
+	// 替换前检查新证书，检查不通过时保留旧证书
+	pCert, err := validateIssuedCertificate(certPEM, keyPEM, domains)
 	if err != nil {
-		log.Printf("[SSL] Failed to create ACME client: %v", err)
 		return err
 	}
 
-	// 9999 端口为签名端口
-	err = client.Challenge.SetHTTP01Provider(http01.NewProviderServer("", "9999"))
+	// nginx 证书目录，证书和私钥经过 nginx -t 检测后才生效
+	result, err := ApplyNginxFiles(map[string][]byte{
+		filepath.Join(certificateSavedDir, "fullchain.cer"): certPEM,
+		filepath.Join(certificateSavedDir, "private.key"):   keyPEM,
+		filepath.Join(certificateSavedDir, "domains"):       []byte(strings.Join(domains, ",")),
+	})
 	if err != nil {
 		return err
 	}
+	if !result.OK {
+		return fmt.Errorf("nginx 配置检测失败: %s", result.Output)
+	}
 
-	// New users will need to register
-	reg, err := client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+	// 申请期间记录可能被修改过，重新读取后只更新证书相关字段
+	latest := models2.GetCertByFilename(cert.FileName)
+	if cert.Shared {
+		latest = models2.GetSharedCert(cert.FileName)
+	}
+	if latest.ID != 0 {
+		*cert = latest
+	}
+	cert.NotAfter = pCert.NotAfter
+	cert.RevokedAt = nil
+	// 新证书重新计算续期时间
+	cert.RenewFailures = 0
+	cert.NextRenewAt = nil
+	cert.RenewAt = nil
+	cert.ARICheckedAt = nil
+	if cert.Shared {
+		cert.Domains = strings.Join(domains, ",")
+		if sites := SharedCertDependents(cert); len(sites) > 0 {
+			log.Printf("[SSL] Shared certificate %s reloaded for sites: %s", cert.FileName, strings.Join(sites, ", "))
+		}
+	}
+	models2.GetDbClient().Save(cert)
+
+	log.Printf("[+] SSL任务完成, 证书到期时间 : %v\n", pCert.NotAfter.Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+// validateIssuedCertificate 检查签发的证书与私钥匹配、包含所有域名并且在有效期内
+func validateIssuedCertificate(certPEM []byte, keyPEM []byte, domains []string) (*x509.Certificate, error) {
+	certificates, err := ParseCertificatePEM(certPEM, nil)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	key, err := ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	leaf := certificates[0]
+	if !publicKeyMatches(leaf, key) {
+		return nil, errors.New("签发的证书与私钥不匹配")
+	}
+	if time.Now().After(leaf.NotAfter) {
+		return nil, fmt.Errorf("签发的证书已于 %s 过期", leaf.NotAfter.Format("2006-01-02"))
+	}
+	covered := map[string]bool{}
+	for _, domain := range certificateDomains(leaf) {
+		covered[strings.ToLower(domain)] = true
+	}
+	for _, domain := range domains {
+		if !covered[strings.ToLower(domain)] && leaf.VerifyHostname(domain) != nil {
+			return nil, fmt.Errorf("签发的证书不包含域名 %s", domain)
+		}
+	}
+	return leaf, nil
+}
+
+// obtainACMECertificate 向证书设置的 CA 申请证书，返回证书链和私钥
+func obtainACMECertificate(cert *models2.Cert, domains []string) ([]byte, []byte, error) {
+	// 使用证书设置的 CA 和私钥类型，每个 CA 的账户第一次申请时才注册
+	issuer, err := resolveACMEIssuer(cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := newACMEClient(issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 默认使用 HTTP-01 验证，证书设置了 DNS 凭据时使用 DNS-01
+	if err = setChallengeProvider(client, cert, domains); err != nil {
+		return nil, nil, err
 	}
-	myUser.Registration = reg
 
 	certificates, err := client.Certificate.Obtain(certificate.ObtainRequest{
 		Domains: domains,
 		Bundle:  true,
 	})
-
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-
-	// nginx 证书目录
-	certificateSavedDir := filepath.Join(GetAppConfig().SSLPath, configName)
-	if _, err := os.Stat(certificateSavedDir); os.IsNotExist(err) {
-		os.MkdirAll(certificateSavedDir, 0755)
-	}
-	// Each certificate comes back with the cert bytes, the bytes of the client's
-	ioutil.WriteFile(filepath.Join(certificateSavedDir, "fullchain.cer"),
-		certificates.Certificate, 0644)
-	// private key, and a certificate URL. SAVE THESE TO DISK.
-	ioutil.WriteFile(filepath.Join(certificateSavedDir, "private.key"),
-		certificates.PrivateKey, 0644)
-	// 保存域名
-	ioutil.WriteFile(filepath.Join(certificateSavedDir, "domains"),
-		[]byte(strings.Join(domains, ",")), 0644)
-	pCert, _ := certcrypto.ParsePEMCertificate(certificates.Certificate)
-
-	cert := models2.GetCertByFilename(configName)
-	cert.NotAfter = pCert.NotAfter
-	models2.GetDbClient().Save(cert)
-
-	log.Printf("[+] SSL任务完成, 证书到期时间 : %v\n", pCert.NotAfter.Format("2006-01-02 15:04:05"))
-	return nil
+	return certificates.Certificate, certificates.PrivateKey, nil
 }
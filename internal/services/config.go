@@ -33,6 +33,8 @@ func UpdateAgentConfig(configData map[string]interface{}) ([]string, error) {
 		"url":           "url",
 		"uuid":          "uuid",
 		"installPath":   "installpath",
+		// 证书自动续期窗口 (天)
+		"renewBeforeDays": "renewbeforedays",
 	}
 
 	// 使用相同的锁确保与loadConfig不冲突
@@ -50,6 +52,18 @@ func UpdateAgentConfig(configData map[string]interface{}) ([]string, error) {
 	for key, value := range configData {
 		if configKey, allowed := allowedFields[key]; allowed {
 			if strValue, ok := value.(string); ok && strValue != "" {
+				// 密码不再写入配置文件，直接更新对应用户的哈希
+				if key == "password" {
+					username, _ := configData["username"].(string)
+					if username == "" {
+						username = viper.GetString("username")
+					}
+					if err := saveConfigUser(username, strValue); err != nil {
+						return nil, fmt.Errorf("更新密码失败: %v", err)
+					}
+					updatedKeys = append(updatedKeys, key)
+					continue
+				}
 				viper.Set(configKey, strValue)
 				updatedKeys = append(updatedKeys, key)
 			}
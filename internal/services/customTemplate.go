@@ -0,0 +1,265 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"uranus/internal/config"
+	"uranus/internal/models"
+)
+
+// 磁盘上的模板文件以 text/template 注释开头，保存名称和参数定义，渲染时会被忽略
+const (
+	customTemplateHeader    = "{{/* uranus:template\n"
+	customTemplateHeaderEnd = "\n*/}}\n"
+)
+
+var (
+	customTemplateSlugRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	templateInputNameRegex  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	templateInputTypes      = []string{
+		TemplateInputDomains, TemplateInputURL, TemplateInputAddress, TemplateInputPath,
+		TemplateInputPort, TemplateInputSelect, TemplateInputBool, TemplateInputText,
+	}
+)
+
+// customTemplateMutex 保证数据库与模板文件同时更新
+var customTemplateMutex sync.Mutex
+
+// customTemplateMeta 模板文件头部保存的定义
+type customTemplateMeta struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Stream      bool                   `json:"stream"`
+	Inputs      []models.TemplateInput `json:"inputs"`
+}
+
+// CustomTemplateDir 自定义模板在磁盘上的目录，每个模板一个 .tmpl 文件
+func CustomTemplateDir() string {
+	return filepath.Join(config.GetAppConfig().InstallPath, "templates")
+}
+
+// CustomTemplateFile 自定义模板文件路径，历史版本按此路径记录
+func CustomTemplateFile(slug string) string {
+	return filepath.Join(CustomTemplateDir(), slug+".tmpl")
+}
+
+// IsCustomTemplateFile 判断路径是否为自定义模板文件
+func IsCustomTemplateFile(path string) bool {
+	return filepath.Dir(filepath.Clean(path)) == filepath.Clean(CustomTemplateDir()) && strings.HasSuffix(path, ".tmpl")
+}
+
+func customSiteTemplate(m *models.CustomTemplate) SiteTemplate {
+	return SiteTemplate{
+		ID:          m.Slug,
+		Name:        m.Name,
+		Description: m.Description,
+		Stream:      m.Stream,
+		Inputs:      m.GetInputs(),
+		Content:     m.Content,
+		Version:     m.Version,
+	}
+}
+
+// encodeCustomTemplate 生成磁盘上的模板文件内容
+func encodeCustomTemplate(m *models.CustomTemplate) string {
+	meta, _ := json.MarshalIndent(customTemplateMeta{
+		Name:        m.Name,
+		Description: m.Description,
+		Stream:      m.Stream,
+		Inputs:      m.GetInputs(),
+	}, "", "  ")
+	return customTemplateHeader + string(meta) + customTemplateHeaderEnd + m.Content
+}
+
+// decodeCustomTemplate 解析模板文件，没有头部时整个文件作为模板内容
+func decodeCustomTemplate(slug string, data string) (*models.CustomTemplate, error) {
+	m := &models.CustomTemplate{Slug: slug, Name: slug}
+	if strings.HasPrefix(data, customTemplateHeader) {
+		end := strings.Index(data, customTemplateHeaderEnd)
+		if end < 0 {
+			return nil, errors.New("模板文件头部不完整")
+		}
+		var meta customTemplateMeta
+		if err := json.Unmarshal([]byte(data[len(customTemplateHeader):end]), &meta); err != nil {
+			return nil, fmt.Errorf("模板文件头部格式错误: %v", err)
+		}
+		if meta.Name != "" {
+			m.Name = meta.Name
+		}
+		m.Description = meta.Description
+		m.Stream = meta.Stream
+		m.SetInputs(meta.Inputs)
+		data = data[end+len(customTemplateHeaderEnd):]
+	}
+	m.Content = data
+	return m, nil
+}
+
+// ValidateCustomTemplate 检查模板 ID、参数定义和模板语法
+func ValidateCustomTemplate(m *models.CustomTemplate, inputs []models.TemplateInput) error {
+	if !customTemplateSlugRegex.MatchString(m.Slug) {
+		return errors.New("模板 ID 只能包含小写字母、数字、下划线和横线")
+	}
+	if isBuiltinTemplate(m.Slug) {
+		return fmt.Errorf("%s 是内置模板，不能覆盖", m.Slug)
+	}
+	if strings.TrimSpace(m.Name) == "" {
+		return errors.New("请填写模板名称")
+	}
+	if strings.TrimSpace(m.Content) == "" {
+		return errors.New("模板内容不能为空")
+	}
+
+	seen := map[string]bool{}
+	for _, input := range inputs {
+		if !templateInputNameRegex.MatchString(input.Name) {
+			return fmt.Errorf("参数名 %q 不合法", input.Name)
+		}
+		if seen[input.Name] {
+			return fmt.Errorf("参数 %s 重复", input.Name)
+		}
+		seen[input.Name] = true
+		if !containsString(templateInputTypes, input.Type) {
+			return fmt.Errorf("参数 %s 的类型 %q 不支持", input.Name, input.Type)
+		}
+		if input.Type == TemplateInputSelect && len(input.Options) == 0 {
+			return fmt.Errorf("参数 %s 需要填写可选值", input.Name)
+		}
+	}
+
+	_, err := parseSiteTemplate(m.Slug, m.Content)
+	return err
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveCustomTemplate 新建或修改自定义模板，写入磁盘并记录一个历史版本
+func SaveCustomTemplate(m *models.CustomTemplate, inputs []models.TemplateInput, author string, source string) error {
+	m.Slug = strings.TrimSpace(m.Slug)
+	for i := range inputs {
+		if inputs[i].Label == "" {
+			inputs[i].Label = inputs[i].Name
+		}
+	}
+	if err := ValidateCustomTemplate(m, inputs); err != nil {
+		return err
+	}
+
+	customTemplateMutex.Lock()
+	defer customTemplateMutex.Unlock()
+
+	existing := models.GetCustomTemplateBySlug(m.Slug)
+	if m.ID != 0 {
+		byID := models.GetCustomTemplateByID(m.ID)
+		if byID.ID == 0 {
+			return errors.New("模板不存在")
+		}
+		if byID.Slug != m.Slug {
+			return errors.New("模板 ID 不能修改")
+		}
+	} else if existing.ID != 0 {
+		return fmt.Errorf("模板 %s 已存在", m.Slug)
+	}
+
+	m.ID, m.CreatedAt = existing.ID, existing.CreatedAt
+	m.Version = existing.Version + 1
+	m.Author = author
+	m.SetInputs(inputs)
+
+	path := CustomTemplateFile(m.Slug)
+	previous, _ := os.ReadFile(path)
+	content := encodeCustomTemplate(m)
+	if err := os.MkdirAll(CustomTemplateDir(), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("写入模板文件失败: %v", err)
+	}
+	if err := models.GetDbClient().Save(m).Error; err != nil {
+		return err
+	}
+	RecordRevision(path, string(previous), content, author, source)
+	return nil
+}
+
+// DeleteCustomTemplate 删除自定义模板，仍被站点使用的模板不能删除，历史版本保留
+func DeleteCustomTemplate(id uint) error {
+	customTemplateMutex.Lock()
+	defer customTemplateMutex.Unlock()
+
+	m := models.GetCustomTemplateByID(id)
+	if m.ID == 0 {
+		return errors.New("模板不存在")
+	}
+	if sites := models.GetSitesUsingTemplate(m.Slug); len(sites) > 0 {
+		var names []string
+		for _, site := range sites {
+			names = append(names, site.FileName)
+		}
+		return fmt.Errorf("模板正在被站点使用: %s", strings.Join(names, ", "))
+	}
+
+	if err := os.Remove(CustomTemplateFile(m.Slug)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return m.Remove()
+}
+
+// restoreCustomTemplate 把模板恢复到某个历史版本的文件内容
+func restoreCustomTemplate(path string, content string, author string, source string) error {
+	slug := strings.TrimSuffix(filepath.Base(path), ".tmpl")
+	restored, err := decodeCustomTemplate(slug, content)
+	if err != nil {
+		return err
+	}
+	restored.ID = models.GetCustomTemplateBySlug(slug).ID
+	return SaveCustomTemplate(restored, restored.GetInputs(), author, source)
+}
+
+// SyncCustomTemplates 启动时导入磁盘上新增或被修改过的模板文件，以磁盘为准
+func SyncCustomTemplates() {
+	entries, err := os.ReadDir(CustomTemplateDir())
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tmpl") {
+			continue
+		}
+		path := filepath.Join(CustomTemplateDir(), entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		slug := strings.TrimSuffix(entry.Name(), ".tmpl")
+		existing := models.GetCustomTemplateBySlug(slug)
+		if existing.ID != 0 && encodeCustomTemplate(&existing) == string(data) {
+			continue
+		}
+
+		m, err := decodeCustomTemplate(slug, string(data))
+		if err == nil {
+			m.ID = existing.ID
+			err = SaveCustomTemplate(m, m.GetInputs(), "uranus", models.RevisionSourceDisk)
+		}
+		if err != nil {
+			log.Printf("[TEMPLATE] Failed to import %s: %v", path, err)
+		} else {
+			log.Printf("[TEMPLATE] Imported %s", path)
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-acme/lego/v4/challenge"
+	"github.com/go-acme/lego/v4/challenge/dns01"
+	"github.com/go-acme/lego/v4/challenge/http01"
+	"github.com/go-acme/lego/v4/lego"
+	"github.com/go-acme/lego/v4/providers/dns/cloudns"
+	"github.com/go-acme/lego/v4/providers/dns/cloudxns"
+	"github.com/go-acme/lego/v4/providers/dns/digitalocean"
+	"github.com/go-acme/lego/v4/providers/dns/exec"
+	"github.com/go-acme/lego/v4/providers/dns/gandiv5"
+	"github.com/go-acme/lego/v4/providers/dns/godaddy"
+	"github.com/go-acme/lego/v4/providers/dns/hetzner"
+	"github.com/go-acme/lego/v4/providers/dns/httpreq"
+	"github.com/go-acme/lego/v4/providers/dns/namecheap"
+	"github.com/go-acme/lego/v4/providers/dns/pdns"
+	"github.com/go-acme/lego/v4/providers/dns/rfc2136"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"uranus/internal/models"
+)
+
+// DNSProviderField DNS 服务商需要的一项配置，对应 lego 读取的环境变量
+type DNSProviderField struct {
+	Env      string `json:"env"`
+	Label    string `json:"label"`
+	Required bool   `json:"required"`
+	Secret   bool   `json:"secret"` // 密钥不回显到页面
+}
+
+// DNSProvider 支持的 DNS 服务商
+type DNSProvider struct {
+	Name   string             `json:"name"`
+	Label  string             `json:"label"`
+	Fields []DNSProviderField `json:"fields"`
+	// 以 root 身份运行任意程序或请求任意地址，和终端一样需要单独授权才能保存
+	Privileged bool `json:"privileged"`
+	create     func() (challenge.Provider, error)
+}
+
+// dnsProviders 可以选择的 lego DNS provider，RFC2136 可以对接自建的 BIND/Knot
+var dnsProviders = []DNSProvider{
+	{
+		Name:  "rfc2136",
+		Label: "RFC2136 (BIND / Knot / PowerDNS)",
+		Fields: []DNSProviderField{
+			{Env: rfc2136.EnvNameserver, Label: "DNS 服务器 (host:port)", Required: true},
+			{Env: rfc2136.EnvTSIGKey, Label: "TSIG Key 名称"},
+			{Env: rfc2136.EnvTSIGSecret, Label: "TSIG Secret", Secret: true},
+			{Env: rfc2136.EnvTSIGAlgorithm, Label: "TSIG 算法，默认 hmac-md5.sig-alg.reg.int."},
+			{Env: rfc2136.EnvPropagationTimeout, Label: "等待生效超时 (秒)"},
+		},
+		create: func() (challenge.Provider, error) { return rfc2136.NewDNSProvider() },
+	},
+	{
+		Name:  "cloudns",
+		Label: "ClouDNS",
+		Fields: []DNSProviderField{
+			{Env: cloudns.EnvAuthID, Label: "Auth ID"},
+			{Env: cloudns.EnvSubAuthID, Label: "Sub Auth ID"},
+			{Env: cloudns.EnvAuthPassword, Label: "Auth Password", Required: true, Secret: true},
+		},
+		create: func() (challenge.Provider, error) { return cloudns.NewDNSProvider() },
+	},
+	{
+		Name:  "cloudxns",
+		Label: "CloudXNS",
+		Fields: []DNSProviderField{
+			{Env: cloudxns.EnvAPIKey, Label: "API Key", Required: true},
+			{Env: cloudxns.EnvSecretKey, Label: "Secret Key", Required: true, Secret: true},
+		},
+		create: func() (challenge.Provider, error) { return cloudxns.NewDNSProvider() },
+	},
+	{
+		Name:  "digitalocean",
+		Label: "DigitalOcean",
+		Fields: []DNSProviderField{
+			{Env: digitalocean.EnvAuthToken, Label: "Auth Token", Required: true, Secret: true},
+		},
+		create: func() (challenge.Provider, error) { return digitalocean.NewDNSProvider() },
+	},
+	{
+		Name:  "gandiv5",
+		Label: "Gandi LiveDNS",
+		Fields: []DNSProviderField{
+			{Env: gandiv5.EnvAPIKey, Label: "API Key", Required: true, Secret: true},
+		},
+		create: func() (challenge.Provider, error) { return gandiv5.NewDNSProvider() },
+	},
+	{
+		Name:  "godaddy",
+		Label: "GoDaddy",
+		Fields: []DNSProviderField{
+			{Env: godaddy.EnvAPIKey, Label: "API Key", Required: true},
+			{Env: godaddy.EnvAPISecret, Label: "API Secret", Required: true, Secret: true},
+		},
+		create: func() (challenge.Provider, error) { return godaddy.NewDNSProvider() },
+	},
+	{
+		Name:  "hetzner",
+		Label: "Hetzner",
+		Fields: []DNSProviderField{
+			{Env: hetzner.EnvAPIKey, Label: "API Key", Required: true, Secret: true},
+		},
+		create: func() (challenge.Provider, error) { return hetzner.NewDNSProvider() },
+	},
+	{
+		Name:  "namecheap",
+		Label: "Namecheap",
+		Fields: []DNSProviderField{
+			{Env: namecheap.EnvAPIUser, Label: "API User", Required: true},
+			{Env: namecheap.EnvAPIKey, Label: "API Key", Required: true, Secret: true},
+		},
+		create: func() (challenge.Provider, error) { return namecheap.NewDNSProvider() },
+	},
+	{
+		Name:  "pdns",
+		Label: "PowerDNS API",
+		Fields: []DNSProviderField{
+			{Env: pdns.EnvAPIURL, Label: "API URL", Required: true},
+			{Env: pdns.EnvAPIKey, Label: "API Key", Required: true, Secret: true},
+			{Env: pdns.EnvServerName, Label: "Server Name，默认 localhost"},
+		},
+		create: func() (challenge.Provider, error) { return pdns.NewDNSProvider() },
+	},
+	{
+		Name:       "httpreq",
+		Label:      "HTTP 请求 (自定义接口，需要终端权限)",
+		Privileged: true,
+		Fields: []DNSProviderField{
+			{Env: httpreq.EnvEndpoint, Label: "接口地址", Required: true},
+			{Env: httpreq.EnvMode, Label: "模式，留空或 RAW"},
+			{Env: httpreq.EnvUsername, Label: "用户名"},
+			{Env: httpreq.EnvPassword, Label: "密码", Secret: true},
+		},
+		create: func() (challenge.Provider, error) { return httpreq.NewDNSProvider() },
+	},
+	{
+		Name:       "exec",
+		Label:      "外部脚本 (需要终端权限)",
+		Privileged: true,
+		Fields: []DNSProviderField{
+			{Env: exec.EnvPath, Label: "脚本路径", Required: true},
+			{Env: exec.EnvMode, Label: "模式，留空或 RAW"},
+		},
+		create: func() (challenge.Provider, error) { return exec.NewDNSProvider() },
+	},
+}
+
+// dnsProviderEnvMutex lego 的 provider 在创建时从环境变量读取配置，
+// 创建期间临时设置环境变量，需要串行执行
+var dnsProviderEnvMutex sync.Mutex
+
+// DNSProviders 返回支持的 DNS 服务商
+func DNSProviders() []DNSProvider {
+	return dnsProviders
+}
+
+// GetDNSProvider 根据名称获取 DNS 服务商
+func GetDNSProvider(name string) (DNSProvider, bool) {
+	for _, p := range dnsProviders {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return DNSProvider{}, false
+}
+
+// IsPrivilegedDNSProvider 该服务商的凭据是否只有终端授权的用户可以保存
+func IsPrivilegedDNSProvider(name string) bool {
+	provider, ok := GetDNSProvider(name)
+	return ok && provider.Privileged
+}
+
+// NewDNSChallengeProvider 用保存的凭据创建 lego DNS provider，
+// 只使用凭据中的值，不会读到进程环境变量里的同名配置
+func NewDNSChallengeProvider(credential *models.DNSCredential) (challenge.Provider, error) {
+	provider, ok := GetDNSProvider(credential.Provider)
+	if !ok {
+		return nil, fmt.Errorf("不支持的 DNS 服务商: %s", credential.Provider)
+	}
+	values, err := DNSCredentialValues(credential)
+	if err != nil {
+		return nil, err
+	}
+
+	dnsProviderEnvMutex.Lock()
+	defer dnsProviderEnvMutex.Unlock()
+
+	previous := map[string]*string{}
+	for _, field := range provider.Fields {
+		for _, name := range []string{field.Env, field.Env + "_FILE"} {
+			if value, ok := os.LookupEnv(name); ok {
+				previous[name] = &value
+			} else {
+				previous[name] = nil
+			}
+			_ = os.Unsetenv(name)
+		}
+		if value := values[field.Env]; value != "" {
+			_ = os.Setenv(field.Env, value)
+		}
+	}
+	defer func() {
+		for name, value := range previous {
+			if value == nil {
+				_ = os.Unsetenv(name)
+			} else {
+				_ = os.Setenv(name, *value)
+			}
+		}
+	}()
+
+	return provider.create()
+}
+
+// DNSCredentialValues 解密并解析保存的凭据
+func DNSCredentialValues(credential *models.DNSCredential) (map[string]string, error) {
+	values := map[string]string{}
+	if credential.Values == "" {
+		return values, nil
+	}
+	data, err := decryptData(credential.Values)
+	if err != nil {
+		return nil, fmt.Errorf("读取 DNS 凭据 %s 失败: %v", credential.Name, err)
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// setDNSCredentialValues 加密保存凭据 (不写入数据库)
+func setDNSCredentialValues(credential *models.DNSCredential, values map[string]string) error {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	encrypted, err := encryptData(data)
+	if err != nil {
+		return err
+	}
+	credential.Values = encrypted
+	return nil
+}
+
+// MigrateDNSCredentials 加密升级前以明文 JSON 保存的凭据
+func MigrateDNSCredentials() {
+	for _, credential := range models.GetDNSCredentials() {
+		// 密文是 base64 编码，不会以 { 开头
+		if !strings.HasPrefix(credential.Values, "{") {
+			continue
+		}
+		values := map[string]string{}
+		if err := json.Unmarshal([]byte(credential.Values), &values); err != nil {
+			log.Printf("[DNS] Failed to parse credential %s: %v", credential.Name, err)
+			continue
+		}
+		if err := setDNSCredentialValues(&credential, values); err != nil {
+			log.Printf("[DNS] Failed to encrypt credential %s: %v", credential.Name, err)
+			continue
+		}
+		if err := models.GetDbClient().Model(&credential).Update("values", credential.Values).Error; err != nil {
+			log.Printf("[DNS] Failed to save credential %s: %v", credential.Name, err)
+			continue
+		}
+		log.Printf("[DNS] Encrypted credential %s", credential.Name)
+	}
+}
+
+// ValidateDNSCredential 检查必填项，并尝试创建 provider
+func ValidateDNSCredential(credential *models.DNSCredential) error {
+	if strings.TrimSpace(credential.Name) == "" {
+		return errors.New("请填写凭据名称")
+	}
+	provider, ok := GetDNSProvider(credential.Provider)
+	if !ok {
+		return fmt.Errorf("不支持的 DNS 服务商: %s", credential.Provider)
+	}
+	values, err := DNSCredentialValues(credential)
+	if err != nil {
+		return err
+	}
+	for _, field := range provider.Fields {
+		if field.Required && strings.TrimSpace(values[field.Env]) == "" {
+			return fmt.Errorf("请填写 %s", field.Label)
+		}
+	}
+	if _, err := NewDNSChallengeProvider(credential); err != nil {
+		return fmt.Errorf("DNS 凭据无效: %v", err)
+	}
+	return nil
+}
+
+// SaveDNSCredential 新建或修改 DNS 凭据，密钥留空时保留原来的值
+func SaveDNSCredential(credential *models.DNSCredential, values map[string]string) error {
+	provider, ok := GetDNSProvider(credential.Provider)
+	if !ok {
+		return fmt.Errorf("不支持的 DNS 服务商: %s", credential.Provider)
+	}
+	existing := models.GetDNSCredentialByID(credential.ID)
+	if credential.ID != 0 && existing.ID == 0 {
+		return errors.New("DNS 凭据不存在")
+	}
+	var sameName models.DNSCredential
+	models.GetDbClient().Find(&sameName, "name = ?", credential.Name)
+	if sameName.ID != 0 && sameName.ID != credential.ID {
+		return fmt.Errorf("凭据 %s 已存在", credential.Name)
+	}
+	previous, err := DNSCredentialValues(&existing)
+	if err != nil {
+		return err
+	}
+
+	saved := map[string]string{}
+	for _, field := range provider.Fields {
+		value := strings.TrimSpace(values[field.Env])
+		if value == "" && field.Secret && existing.Provider == credential.Provider {
+			value = previous[field.Env]
+		}
+		if value != "" {
+			saved[field.Env] = value
+		}
+	}
+	if err := setDNSCredentialValues(credential, saved); err != nil {
+		return err
+	}
+	credential.Resolvers = strings.Join(splitResolvers(credential.Resolvers), ",")
+	credential.CreatedAt = existing.CreatedAt
+
+	if err := ValidateDNSCredential(credential); err != nil {
+		return err
+	}
+	return models.GetDbClient().Save(credential).Error
+}
+
+// DeleteDNSCredential 删除 DNS 凭据，仍被证书使用时不能删除
+func DeleteDNSCredential(id uint) error {
+	credential := models.GetDNSCredentialByID(id)
+	if credential.ID == 0 {
+		return errors.New("DNS 凭据不存在")
+	}
+	if certs := models.GetCertsUsingDNSCredential(id); len(certs) > 0 {
+		var names []string
+		for _, cert := range certs {
+			names = append(names, cert.FileName)
+		}
+		return fmt.Errorf("凭据正在被证书使用: %s", strings.Join(names, ", "))
+	}
+	return credential.Remove()
+}
+
+// SetCertDNSCredential 设置证书的验证方式，id 为 0 时使用 HTTP-01，shared 表示共享证书
+func SetCertDNSCredential(configName string, shared bool, id uint) error {
+	if id != 0 && models.GetDNSCredentialByID(id).ID == 0 {
+		return errors.New("DNS 凭据不存在")
+	}
+	cert := models.GetCertByFilename(configName)
+	if shared {
+		cert = models.GetSharedCert(configName)
+	}
+	if cert.ID == 0 {
+		return errors.New("证书不存在")
+	}
+	return models.GetDbClient().Model(&cert).Update("dns_credential_id", id).Error
+}
+
+func splitResolvers(resolvers string) []string {
+	var result []string
+	for _, resolver := range strings.Split(resolvers, ",") {
+		if resolver = strings.TrimSpace(resolver); resolver != "" {
+			result = append(result, resolver)
+		}
+	}
+	return result
+}
+
+func hasWildcardDomain(domains []string) bool {
+	for _, domain := range domains {
+		if strings.HasPrefix(domain, "*.") {
+			return true
+		}
+	}
+	return false
+}
+
+// setChallengeProvider 根据证书的配置设置验证方式，默认 HTTP-01 使用 9999 端口，
+// 由站点模板中的 /.well-known location 转发
+func setChallengeProvider(client *lego.Client, cert *models.Cert, domains []string) error {
+	if cert.DNSCredentialID == 0 {
+		if hasWildcardDomain(domains) {
+			return errors.New("通配符证书需要使用 DNS-01 验证，请先为证书选择 DNS 凭据")
+		}
+		return client.Challenge.SetHTTP01Provider(http01.NewProviderServer("", http01Port))
+	}
+
+	credential := models.GetDNSCredentialByID(cert.DNSCredentialID)
+	if credential.ID == 0 {
+		return errors.New("证书使用的 DNS 凭据不存在")
+	}
+	provider, err := NewDNSChallengeProvider(&credential)
+	if err != nil {
+		return fmt.Errorf("创建 DNS provider 失败: %v", err)
+	}
+	var opts []dns01.ChallengeOption
+	if resolvers := splitResolvers(credential.Resolvers); len(resolvers) > 0 {
+		opts = append(opts, dns01.AddRecursiveNameservers(dns01.ParseNameservers(resolvers)))
+	}
+	return client.Challenge.SetDNS01Provider(provider, opts...)
+}
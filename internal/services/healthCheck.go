@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+	"uranus/internal/models"
+)
+
+// 后端健康状态
+const (
+	HealthUnknown = "unknown"
+	HealthUp      = "up"
+	HealthDown    = "down"
+)
+
+// MemberHealth 一个后端最近的健康检查结果
+type MemberHealth struct {
+	Status    string    `json:"status"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Latency   int64     `json:"latency"` // 毫秒
+	Error     string    `json:"error"`
+	Failures  int       `json:"failures"`  // 连续失败次数
+	Successes int       `json:"successes"` // 连续成功次数
+}
+
+// UpstreamMemberStatus 后端配置及健康状态
+type UpstreamMemberStatus struct {
+	models.UpstreamMember
+	Health MemberHealth `json:"health"`
+}
+
+// UpstreamPoolStatus 服务器池配置及各后端健康状态
+type UpstreamPoolStatus struct {
+	ID          uint                   `json:"id"`
+	Name        string                 `json:"name"`
+	Strategy    string                 `json:"strategy"`
+	HealthCheck string                 `json:"healthCheck"`
+	AutoDrain   bool                   `json:"autoDrain"`
+	Members     []UpstreamMemberStatus `json:"members"`
+}
+
+type healthCheckState struct {
+	mutex   sync.Mutex
+	members map[uint]*MemberHealth
+	running map[uint]bool
+}
+
+var healthChecker = &healthCheckState{
+	members: map[uint]*MemberHealth{},
+	running: map[uint]bool{},
+}
+
+// StartHealthChecks 按各服务器池的设置定期检查后端，ctx 取消时退出
+func StartHealthChecks(ctx context.Context) {
+	log.Println("[UPSTREAM] Health checker started")
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			healthChecker.tick()
+		}
+	}
+}
+
+// GetUpstreamStatus 返回所有服务器池及后端的健康状态
+func GetUpstreamStatus() []UpstreamPoolStatus {
+	pools := cachedUpstreamPools()
+	result := make([]UpstreamPoolStatus, 0, len(pools))
+
+	healthChecker.mutex.Lock()
+	defer healthChecker.mutex.Unlock()
+	for _, pool := range pools {
+		status := UpstreamPoolStatus{
+			ID:          pool.ID,
+			Name:        pool.Name,
+			Strategy:    pool.Strategy,
+			HealthCheck: pool.HealthCheck,
+			AutoDrain:   pool.AutoDrain,
+		}
+		for _, member := range pool.Members {
+			health := MemberHealth{Status: HealthUnknown}
+			if pool.HealthCheck != models.HealthCheckNone {
+				if state, ok := healthChecker.members[member.ID]; ok {
+					health = *state
+				}
+			}
+			status.Members = append(status.Members, UpstreamMemberStatus{UpstreamMember: member, Health: health})
+		}
+		result = append(result, status)
+	}
+	return result
+}
+
+func (h *healthCheckState) tick() {
+	now := time.Now()
+	for _, pool := range cachedUpstreamPools() {
+		if pool.HealthCheck == models.HealthCheckNone {
+			continue
+		}
+		interval := secondsOrDefault(pool.HealthInterval, 10)
+		for _, member := range pool.Members {
+			h.mutex.Lock()
+			state, ok := h.members[member.ID]
+			if !ok {
+				state = &MemberHealth{Status: HealthUnknown}
+				h.members[member.ID] = state
+			}
+			due := !h.running[member.ID] && now.Sub(state.CheckedAt) >= interval
+			if due {
+				h.running[member.ID] = true
+			}
+			h.mutex.Unlock()
+
+			if due {
+				go h.check(pool, member)
+			}
+		}
+	}
+}
+
+// check 检查一个后端并更新状态，开启自动摘除时根据连续失败/成功次数修改 upstream
+func (h *healthCheckState) check(pool models.UpstreamPool, member models.UpstreamMember) {
+	start := time.Now()
+	err := probeUpstreamMember(&pool, member.Address)
+	latency := time.Since(start)
+
+	h.mutex.Lock()
+	delete(h.running, member.ID)
+	state, ok := h.members[member.ID]
+	if !ok {
+		// 检查期间服务器池被删除
+		h.mutex.Unlock()
+		return
+	}
+	state.CheckedAt = time.Now()
+	state.Latency = latency.Milliseconds()
+	if err != nil {
+		state.Status = HealthDown
+		state.Error = err.Error()
+		state.Failures++
+		state.Successes = 0
+	} else {
+		state.Status = HealthUp
+		state.Error = ""
+		state.Successes++
+		state.Failures = 0
+	}
+	failures, successes := state.Failures, state.Successes
+	h.mutex.Unlock()
+
+	if !pool.AutoDrain || member.Down {
+		return
+	}
+	switch {
+	case !member.Drained && failures >= intOrDefault(pool.FailThreshold, 3):
+		if !h.hasOtherHealthyMember(&pool, member.ID) {
+			log.Printf("[UPSTREAM] %s/%s is unhealthy but is the last available member, not draining", pool.Name, member.Address)
+			return
+		}
+		log.Printf("[UPSTREAM] Draining %s/%s: %v", pool.Name, member.Address, err)
+		if err := setUpstreamMemberDrained(pool.ID, member.ID, true); err != nil {
+			log.Printf("[UPSTREAM] Failed to drain %s/%s: %v", pool.Name, member.Address, err)
+		}
+	case member.Drained && successes >= intOrDefault(pool.RiseThreshold, 2):
+		log.Printf("[UPSTREAM] Restoring %s/%s", pool.Name, member.Address)
+		if err := setUpstreamMemberDrained(pool.ID, member.ID, false); err != nil {
+			log.Printf("[UPSTREAM] Failed to restore %s/%s: %v", pool.Name, member.Address, err)
+		}
+	}
+}
+
+// hasOtherHealthyMember 摘除前确认池中还有其他可用的后端，避免全部下线
+func (h *healthCheckState) hasOtherHealthyMember(pool *models.UpstreamPool, memberID uint) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, member := range pool.Members {
+		if member.ID == memberID || member.IsDown() {
+			continue
+		}
+		if state, ok := h.members[member.ID]; ok && state.Status == HealthUp {
+			return true
+		}
+	}
+	return false
+}
+
+// forget 删除服务器池后清理健康状态
+func (h *healthCheckState) forget(pool *models.UpstreamPool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, member := range pool.Members {
+		delete(h.members, member.ID)
+	}
+}
+
+// probeUpstreamMember HTTP 检查要求状态码小于 400，TCP 检查只要求能建立连接
+func probeUpstreamMember(pool *models.UpstreamPool, address string) error {
+	timeout := secondsOrDefault(pool.HealthTimeout, 3)
+	switch pool.HealthCheck {
+	case models.HealthCheckTCP:
+		conn, err := net.DialTimeout("tcp", address, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case models.HealthCheckHTTP:
+		path := pool.HealthPath
+		if path == "" {
+			path = "/"
+		}
+		client := &http.Client{
+			Timeout: timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		response, err := client.Get("http://" + address + path)
+		if err != nil {
+			return err
+		}
+		_ = response.Body.Close()
+		if response.StatusCode >= 400 {
+			return fmt.Errorf("HTTP %d", response.StatusCode)
+		}
+		return nil
+	}
+	return errors.New("未开启健康检查")
+}
+
+func secondsOrDefault(seconds int, def int) time.Duration {
+	return time.Duration(intOrDefault(seconds, def)) * time.Second
+}
+
+func intOrDefault(value int, def int) int {
+	if value <= 0 {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/go-acme/lego/v4/certcrypto"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"uranus/internal/config"
+	"uranus/internal/models"
+)
+
+const (
+	// 内部 CA 根证书有效期
+	internalCARootValidity = 10 * 365 * 24 * time.Hour
+	// 内部 CA 签发的证书有效期，与 Let's Encrypt 一致，到期前 30 天自动续期
+	internalCALeafValidity = 90 * 24 * time.Hour
+)
+
+var internalCAMutex sync.Mutex
+
+// InternalCAInfo SSL 页面上展示的内部 CA 信息
+type InternalCAInfo struct {
+	Exists      bool      `json:"exists"`
+	CommonName  string    `json:"commonName"`
+	NotAfter    time.Time `json:"notAfter"`
+	Fingerprint string    `json:"fingerprint"` // SHA-256
+}
+
+// InternalCADir 内部 CA 根证书和私钥的保存目录，私钥加密保存
+func InternalCADir() string {
+	return filepath.Join(config.GetAppConfig().InstallPath, "internal-ca")
+}
+
+// InternalCARootFile 根证书文件，可以下载后安装到客户端的信任列表中
+func InternalCARootFile() string {
+	return filepath.Join(InternalCADir(), "root.crt")
+}
+
+func internalCAKeyFile() string {
+	return filepath.Join(InternalCADir(), "root.key")
+}
+
+// loadInternalCA 读取根证书和私钥，不存在时返回 os.ErrNotExist
+func loadInternalCA() (*x509.Certificate, crypto.Signer, error) {
+	certPEM, err := os.ReadFile(InternalCARootFile())
+	if err != nil {
+		return nil, nil, err
+	}
+	root, err := certcrypto.ParsePEMCertificate(certPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("内部 CA 根证书格式错误: %v", err)
+	}
+	encrypted, err := os.ReadFile(internalCAKeyFile())
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := decryptData(string(encrypted))
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取内部 CA 私钥失败: %v", err)
+	}
+	key, err := certcrypto.ParsePEMPrivateKey(keyPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("内部 CA 私钥类型不支持")
+	}
+	return root, signer, nil
+}
+
+// GetInternalCA 内部 CA 的状态
+func GetInternalCA() InternalCAInfo {
+	root, _, err := loadInternalCA()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[SSL] %v", err)
+		}
+		return InternalCAInfo{}
+	}
+	sum := sha256.Sum256(root.Raw)
+	return InternalCAInfo{
+		Exists:      true,
+		CommonName:  root.Subject.CommonName,
+		NotAfter:    root.NotAfter,
+		Fingerprint: strings.ToUpper(hex.EncodeToString(sum[:])),
+	}
+}
+
+func randomSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func subjectKeyID(public crypto.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil
+	}
+	sum := sha1.Sum(der)
+	return sum[:]
+}
+
+// CreateInternalCA 生成内部 CA 根证书，已经存在时不会覆盖，避免客户端已经安装的根证书失效
+func CreateInternalCA(commonName string) error {
+	internalCAMutex.Lock()
+	defer internalCAMutex.Unlock()
+	return createInternalCA(commonName)
+}
+
+func createInternalCA(commonName string) error {
+	if _, err := os.Stat(InternalCARootFile()); err == nil {
+		return errors.New("内部 CA 已经存在")
+	}
+	commonName = strings.TrimSpace(commonName)
+	if commonName == "" {
+		hostname, _ := os.Hostname()
+		commonName = strings.TrimSpace("Uranus Internal CA " + hostname)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := randomSerialNumber()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"Uranus"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(internalCARootValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		SubjectKeyId:          subjectKeyID(key.Public()),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return err
+	}
+	encrypted, err := encryptData(certcrypto.PEMEncode(key))
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(InternalCADir(), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(internalCAKeyFile(), []byte(encrypted), 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(InternalCARootFile(), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return err
+	}
+	log.Printf("[SSL] Created internal CA %s", commonName)
+	return nil
+}
+
+// issueInternalCertificate 使用内部 CA 签发证书，域名可以是主机名、通配符或 IP，
+// 第一次使用时自动生成根证书
+func issueInternalCertificate(cert *models.Cert, domains []string) (certPEM []byte, keyPEM []byte, err error) {
+	internalCAMutex.Lock()
+	defer internalCAMutex.Unlock()
+
+	root, rootKey, err := loadInternalCA()
+	if os.IsNotExist(err) {
+		if err = createInternalCA(""); err == nil {
+			root, rootKey, err = loadInternalCA()
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyType := DefaultKeyType
+	if cert.KeyType != "" {
+		keyType = cert.KeyType
+	}
+	certKeyType, ok := acmeKeyTypes[keyType]
+	if !ok {
+		return nil, nil, fmt.Errorf("不支持的私钥类型: %s", keyType)
+	}
+	key, err := certcrypto.GeneratePrivateKey(certKeyType)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer := key.(crypto.Signer)
+
+	serial, err := randomSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:   serial,
+		Subject:        pkix.Name{CommonName: domains[0]},
+		NotBefore:      now.Add(-time.Hour),
+		NotAfter:       now.Add(internalCALeafValidity),
+		KeyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		SubjectKeyId:   subjectKeyID(signer.Public()),
+		AuthorityKeyId: root.SubjectKeyId,
+	}
+	for _, domain := range domains {
+		if ip := net.ParseIP(domain); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, domain)
+		}
+	}
+	if template.NotAfter.After(root.NotAfter) {
+		template.NotAfter = root.NotAfter
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, root, signer.Public(), rootKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), certcrypto.PEMEncode(key), nil
+}
+
+// EnsureInternalCert 站点使用内部 CA 的证书，证书不存在或域名变化时重新签发
+func EnsureInternalCert(configName string, domains []string) error {
+	cert := models.GetCertByFilename(configName)
+	cert.FileName = configName
+	dir := CertDir(&cert)
+	if cert.InternalCA {
+		saved, err := os.ReadFile(filepath.Join(dir, "domains"))
+		_, statErr := os.Stat(filepath.Join(dir, "fullchain.cer"))
+		if err == nil && statErr == nil && string(saved) == strings.Join(domains, ",") {
+			return nil
+		}
+	}
+	cert.InternalCA = true
+	if err := models.GetDbClient().Save(&cert).Error; err != nil {
+		return err
+	}
+	return issueCertificate(&cert, domains)
+}
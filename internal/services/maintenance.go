@@ -0,0 +1,319 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"uranus/internal/config"
+	"uranus/internal/models"
+	"uranus/internal/nginxconf"
+)
+
+// MaintenanceFileName 维护模式白名单的 geo 配置，位于 http 层，放在站点目录下
+const MaintenanceFileName = "_maintenance.conf"
+
+// DefaultMaintenanceHTML 没有自定义页面时使用的维护页面
+const DefaultMaintenanceHTML = `<!DOCTYPE html>
+<html lang="zh">
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>系统维护中</title>
+    <style>
+        body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; background: #f9fafb; color: #111827; display: flex; align-items: center; justify-content: center; height: 100vh; margin: 0; }
+        div { text-align: center; }
+    </style>
+</head>
+<body>
+<div>
+    <h1>系统维护中</h1>
+    <p>我们正在进行系统维护，请稍后再访问。</p>
+</div>
+</body>
+</html>
+`
+
+var maintenanceMutex sync.Mutex
+
+// MaintenanceFile http 层 geo 配置文件路径
+func MaintenanceFile() string {
+	return filepath.Join(config.GetAppConfig().VhostPath, MaintenanceFileName)
+}
+
+// IsUranusConfFile 判断站点目录中的文件是否为 uranus 自己生成的配置 (不是网站)
+func IsUranusConfFile(name string) bool {
+	return IsUpstreamsFile(name) || filepath.Base(name) == MaintenanceFileName
+}
+
+func maintenanceDir() string {
+	return filepath.Join(config.GetAppConfig().InstallPath, "maintenance")
+}
+
+// maintenanceIncludePath 站点 server 块中 include 的维护配置
+func maintenanceIncludePath(fileName string) string {
+	return filepath.Join(maintenanceDir(), fileName+".conf")
+}
+
+func maintenancePagePath(fileName string) string {
+	return filepath.Join(maintenanceDir(), fileName+".html")
+}
+
+func maintenanceVariable(fileName string) string {
+	return "$uranus_maintenance_" + upstreamNameRegex.ReplaceAllString(fileName, "_")
+}
+
+// isMaintenanceInclude 判断指令是否为 uranus 添加的维护模式 include
+func isMaintenanceInclude(d *nginxconf.Directive) bool {
+	return d.Name == "include" && filepath.Dir(d.Arg(0)) == maintenanceDir()
+}
+
+// ValidateMaintenance 检查白名单和计划时间
+func ValidateMaintenance(m *models.Maintenance) error {
+	for _, entry := range m.AllowlistEntries() {
+		if net.ParseIP(entry) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(entry); err != nil {
+			return fmt.Errorf("白名单 %q 不是合法的 IP 或 CIDR", entry)
+		}
+	}
+	if m.StartAt != nil && m.EndAt != nil && !m.EndAt.After(*m.StartAt) {
+		return errors.New("结束时间必须晚于开始时间")
+	}
+	return nil
+}
+
+// SaveMaintenance 保存站点的维护模式设置，按当前时间生效，nginx -t 检测失败时不保存
+func SaveMaintenance(m *models.Maintenance, author string, source string) (*NginxTestResult, error) {
+	m.FileName = strings.TrimSuffix(filepath.Base(m.FileName), ".conf")
+	if err := ValidateMaintenance(m); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(m.HTML) == "" {
+		m.HTML = DefaultMaintenanceHTML
+	}
+
+	maintenanceMutex.Lock()
+	defer maintenanceMutex.Unlock()
+
+	existing := models.GetMaintenanceByFilename(m.FileName)
+	m.ID, m.CreatedAt, m.Active = existing.ID, existing.CreatedAt, existing.Active
+	return applyMaintenance(m, time.Now(), author, source)
+}
+
+// SetMaintenanceEnabled 一键开启或关闭维护模式，保留页面和白名单设置；
+// 开启时忽略尚未到达的开始时间和已经过去的结束时间
+func SetMaintenanceEnabled(fileName string, enabled bool, author string, source string) (*NginxTestResult, error) {
+	fileName = strings.TrimSuffix(filepath.Base(fileName), ".conf")
+
+	maintenanceMutex.Lock()
+	defer maintenanceMutex.Unlock()
+
+	m := models.GetMaintenanceByFilename(fileName)
+	m.FileName = fileName
+	m.Enabled = enabled
+	if enabled {
+		now := time.Now()
+		if m.StartAt != nil && now.Before(*m.StartAt) {
+			m.StartAt = nil
+		}
+		if m.EndAt != nil && !now.Before(*m.EndAt) {
+			m.EndAt = nil
+		}
+	}
+	if m.HTML == "" {
+		m.HTML = DefaultMaintenanceHTML
+	}
+	return applyMaintenance(&m, time.Now(), author, source)
+}
+
+// applyMaintenance 写入维护页面、site 文件中的 include、server 层配置和 geo 白名单，
+// 检测通过并重载后保存到数据库，调用方需持有 maintenanceMutex
+func applyMaintenance(m *models.Maintenance, now time.Time, author string, source string) (*NginxTestResult, error) {
+	active := m.ShouldBeActive(now)
+	sitePath := filepath.Join(config.GetAppConfig().VhostPath, m.FileName+".conf")
+	content, err := os.ReadFile(sitePath)
+	if err != nil {
+		return nil, errors.New("未找到站点配置文件: " + sitePath)
+	}
+
+	siteContent, err := setMaintenanceInclude(sitePath, content, m.FileName, m.Enabled)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(maintenanceDir(), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(maintenancePagePath(m.FileName), []byte(m.HTML), 0644); err != nil {
+		return nil, fmt.Errorf("写入维护页面失败: %v", err)
+	}
+
+	files := map[string][]byte{
+		MaintenanceFile(): []byte(renderMaintenanceGeo(m, active)),
+	}
+	if m.Enabled {
+		files[maintenanceIncludePath(m.FileName)] = []byte(renderMaintenanceInclude(m.FileName, active))
+	} else {
+		files[maintenanceIncludePath(m.FileName)] = nil
+	}
+	if siteContent != string(content) {
+		files[sitePath] = []byte(siteContent)
+	}
+
+	result, err := ApplyNginxFiles(files)
+	if err != nil || !result.OK {
+		return result, err
+	}
+	if siteContent != string(content) {
+		RecordRevision(sitePath, string(content), siteContent, author, source)
+	}
+	if m.Active != active {
+		log.Printf("[MAINTENANCE] %s: active=%v", m.FileName, active)
+	}
+
+	m.Active = active
+	return result, models.GetDbClient().Save(m).Error
+}
+
+// setMaintenanceInclude 在站点的每个 server 块开头添加或删除维护模式 include
+func setMaintenanceInclude(path string, content []byte, fileName string, present bool) (string, error) {
+	parsed, err := nginxconf.Parse(path, content)
+	if err != nil {
+		return "", err
+	}
+	includePath := maintenanceIncludePath(fileName)
+	for _, server := range nginxconf.Servers(parsed.Nodes, false) {
+		var existing *nginxconf.Directive
+		for _, include := range server.Directive.Find("include") {
+			if isMaintenanceInclude(include) {
+				existing = include
+			}
+		}
+		switch {
+		case present && existing == nil:
+			server.Directive.Prepend(nginxconf.NewDirective("include", includePath))
+		case !present && existing != nil:
+			server.Directive.Remove(existing)
+		}
+	}
+	return parsed.String(), nil
+}
+
+// renderMaintenanceInclude 生成 server 层的维护配置，未生效时只保留注释
+func renderMaintenanceInclude(fileName string, active bool) string {
+	conf := &nginxconf.Config{}
+	conf.Append(nginxconf.NewComment(" 由 uranus 生成的维护模式配置"))
+	if !active {
+		return conf.String()
+	}
+	conf.Append(
+		nginxconf.NewDirective("set", "$uranus_maintenance", maintenanceVariable(fileName)),
+		// 证书申请不受维护模式影响
+		nginxconf.NewBlock("if", []string{"($uri", "~", "^/\\.well-known/)"},
+			nginxconf.NewDirective("set", "$uranus_maintenance", "0"),
+		),
+		nginxconf.NewBlock("if", []string{"($uranus_maintenance)"},
+			nginxconf.NewDirective("return", "503"),
+		),
+		nginxconf.NewDirective("error_page", "503", "@uranus_maintenance"),
+		nginxconf.NewBlock("location", []string{"@uranus_maintenance"},
+			nginxconf.NewDirective("root", maintenanceDir()),
+			nginxconf.NewDirective("add_header", "Retry-After", "3600", "always"),
+			nginxconf.NewDirective("rewrite", "^", "/"+fileName+".html", "break"),
+		),
+	)
+	return conf.String()
+}
+
+// renderMaintenanceGeo 生成所有处于维护状态站点的白名单，current 使用传入的新状态
+func renderMaintenanceGeo(current *models.Maintenance, currentActive bool) string {
+	conf := &nginxconf.Config{}
+	conf.Append(nginxconf.NewComment(" 由 uranus 生成，请在网站维护模式中修改"))
+	for _, m := range models.GetMaintenances() {
+		if m.Active && m.FileName != current.FileName {
+			conf.Append(maintenanceGeoBlock(&m))
+		}
+	}
+	if currentActive {
+		conf.Append(maintenanceGeoBlock(current))
+	}
+	return conf.String()
+}
+
+func maintenanceGeoBlock(m *models.Maintenance) *nginxconf.Directive {
+	block := nginxconf.NewBlock("geo", []string{maintenanceVariable(m.FileName)},
+		nginxconf.NewDirective("default", "1"),
+	)
+	for _, entry := range m.AllowlistEntries() {
+		block.Append(nginxconf.NewDirective(entry, "0"))
+	}
+	return block
+}
+
+// RemoveMaintenance 删除站点时清理维护模式的文件和记录，由调用方重载 nginx
+func RemoveMaintenance(fileName string) {
+	maintenanceMutex.Lock()
+	defer maintenanceMutex.Unlock()
+
+	m := models.GetMaintenanceByFilename(fileName)
+	if m.ID == 0 {
+		return
+	}
+	_ = os.Remove(maintenanceIncludePath(m.FileName))
+	_ = os.Remove(maintenancePagePath(m.FileName))
+	if err := m.Remove(); err != nil {
+		log.Printf("[MAINTENANCE] Failed to remove %s: %v", m.FileName, err)
+	}
+	if m.Active {
+		m.Active = false
+		if err := os.WriteFile(MaintenanceFile(), []byte(renderMaintenanceGeo(&m, false)), 0644); err != nil {
+			log.Printf("[MAINTENANCE] Failed to write %s: %v", MaintenanceFile(), err)
+		}
+	}
+}
+
+// StartMaintenanceScheduler 按计划时间开启或结束维护模式
+func StartMaintenanceScheduler(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			syncMaintenance(time.Now())
+		}
+	}
+}
+
+func syncMaintenance(now time.Time) {
+	maintenanceMutex.Lock()
+	defer maintenanceMutex.Unlock()
+
+	for _, m := range models.GetMaintenances() {
+		m := m
+		expired := m.Enabled && m.EndAt != nil && !now.Before(*m.EndAt)
+		// 已停用的站点在重新启用前不处理
+		if (m.ShouldBeActive(now) == m.Active && !expired) || IsSiteDisabled(m.FileName) {
+			continue
+		}
+		// 结束时间已过，彻底关闭并移除 include
+		if expired {
+			m.Enabled = false
+		}
+		result, err := applyMaintenance(&m, now, "uranus", models.RevisionSourceSchedule)
+		if err != nil {
+			log.Printf("[MAINTENANCE] Failed to apply schedule of %s: %v", m.FileName, err)
+		} else if !result.OK {
+			log.Printf("[MAINTENANCE] Failed to apply schedule of %s: %s", m.FileName, result.Message())
+		}
+	}
+}
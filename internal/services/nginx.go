@@ -2,7 +2,6 @@ package services
 
 import (
 	"log"
-	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
@@ -87,7 +86,19 @@ func StartNginx() string {
 	return result
 }
 
+// ReloadNginx 先用 nginx -t 检测配置，检测通过后再重载
 func ReloadNginx() string {
+	nginxApplyMutex.Lock()
+	defer nginxApplyMutex.Unlock()
+
+	if result := TestNginx(); !result.OK {
+		return result.Message()
+	}
+	return reloadNginx()
+}
+
+// reloadNginx 直接重载 nginx，调用方负责检测配置
+func reloadNginx() string {
 	log.Println("[NGINX] Reloading configuration")
 	var result = "OK"
 
@@ -174,13 +185,20 @@ func getNginxConfPath() string {
 	return confPath
 }
 
-func SaveNginxConf(content string) string {
-	path := filepath.Join(getNginxConfPath(), "nginx.conf")
-	err := os.WriteFile(path, []byte(content), 0644)
+// NginxConfFile 返回 nginx.conf 的完整路径
+func NginxConfFile() string {
+	return filepath.Join(getNginxConfPath(), "nginx.conf")
+}
+
+// SaveNginxConf 保存 nginx.conf，检测失败时自动回滚
+func SaveNginxConf(content string, author string, source string) (*NginxTestResult, error) {
+	result, err := SaveConfFile(NginxConfFile(), content, author, source)
 	if err != nil {
 		log.Printf("[NGINX] Error saving configuration: %v", err)
-		return "Error saving configuration: " + err.Error()
+		return nil, err
+	}
+	if result.OK {
+		log.Println("[NGINX] Configuration saved successfully")
 	}
-	log.Println("[NGINX] Configuration saved successfully")
-	return ReloadNginx()
+	return result, nil
 }
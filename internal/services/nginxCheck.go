@@ -0,0 +1,258 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"uranus/internal/config"
+)
+
+// NginxTestIssue nginx -t 输出中的一条错误或警告
+type NginxTestIssue struct {
+	Level   string `json:"level"`
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// NginxTestResult nginx -t 的检测结果
+type NginxTestResult struct {
+	OK     bool             `json:"ok"`
+	Output string           `json:"output"`
+	Issues []NginxTestIssue `json:"issues"`
+}
+
+var (
+	// 同一时间只允许一个配置变更处于"写入-检测-提交/回滚"流程中
+	nginxApplyMutex sync.Mutex
+
+	// nginx: [emerg] unknown directive "foo" in /etc/nginx/conf.d/a.conf:12
+	nginxIssueRegex = regexp.MustCompile(`nginx: \[(\w+)\] (.*?)(?: in (\S+):(\d+))?$`)
+)
+
+// nginxBinary 返回 nginx 可执行文件路径，找不到时返回空字符串
+func nginxBinary() string {
+	if execPath := config.ReadNginxCompileInfo().NginxExec; execPath != "" {
+		if _, err := os.Stat(execPath); err == nil {
+			return execPath
+		}
+	}
+	if execPath, err := exec.LookPath("nginx"); err == nil {
+		return execPath
+	}
+	return ""
+}
+
+// TestNginx 使用 nginx -t 检测当前磁盘上的配置
+func TestNginx() *NginxTestResult {
+	binary := nginxBinary()
+	if binary == "" {
+		// 无法检测时不能当作检测通过，否则错误的配置会直接写入
+		log.Println("[NGINX] nginx binary not found, cannot test configuration")
+		return &NginxTestResult{OK: false, Output: "未找到 nginx 可执行文件，无法检测配置"}
+	}
+
+	args := []string{"-t"}
+	if confPath := config.ReadNginxCompileInfo().NginxConfPath; confPath != "" {
+		args = append(args, "-c", confPath)
+	}
+	out, err := exec.Command(binary, args...).CombinedOutput()
+
+	result := &NginxTestResult{
+		OK:     err == nil,
+		Output: strings.TrimSpace(string(out)),
+		Issues: parseNginxTestOutput(string(out)),
+	}
+	if !result.OK {
+		log.Printf("[NGINX] Configuration test failed: %s", result.Output)
+	}
+	return result
+}
+
+// parseNginxTestOutput 从 nginx -t 的输出中提取文件、行号和错误信息
+func parseNginxTestOutput(output string) []NginxTestIssue {
+	var issues []NginxTestIssue
+	for _, line := range strings.Split(output, "\n") {
+		matches := nginxIssueRegex.FindStringSubmatch(strings.TrimSpace(line))
+		if matches == nil {
+			continue
+		}
+		issue := NginxTestIssue{
+			Level:   matches[1],
+			Message: matches[2],
+			File:    matches[3],
+		}
+		if matches[4] != "" {
+			issue.Line, _ = strconv.Atoi(matches[4])
+		}
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+// Message 返回适合直接展示给用户的检测结果
+func (r *NginxTestResult) Message() string {
+	if r.OK {
+		return "OK"
+	}
+	return r.Output
+}
+
+// stagedFile 记录一个被替换的文件，用于回滚
+type stagedFile struct {
+	path    string
+	backup  string
+	mode    os.FileMode
+	existed bool
+}
+
+// ApplyNginxFiles 写入一组 nginx 相关文件并用 nginx -t 检测，内容为 nil 表示删除该文件，
+// 检测通过则重载 nginx，检测或重载失败时把所有文件恢复到写入前的状态
+func ApplyNginxFiles(files map[string][]byte) (*NginxTestResult, error) {
+	nginxApplyMutex.Lock()
+	defer nginxApplyMutex.Unlock()
+
+	staged, err := stageFiles(files)
+	if err != nil {
+		rollbackFiles(staged)
+		return nil, err
+	}
+
+	result := TestNginx()
+	if !result.OK {
+		rollbackFiles(staged)
+		return result, nil
+	}
+
+	// 重载失败时 nginx 仍在使用旧配置，恢复文件使磁盘与运行中的配置保持一致
+	if message := reloadNginx(); message != "OK" {
+		rollbackFiles(staged)
+		result.OK = false
+		result.Output = "重载 nginx 失败，已恢复修改前的配置: " + message
+		return result, nil
+	}
+	commitFiles(staged)
+	invalidateSiteDrift()
+	return result, nil
+}
+
+// ApplyNginxFile 写入单个文件，参见 ApplyNginxFiles
+func ApplyNginxFile(path string, content []byte) (*NginxTestResult, error) {
+	return ApplyNginxFiles(map[string][]byte{path: content})
+}
+
+// stagingDir 备份和临时文件所在目录。不能放在配置文件旁边，
+// 否则 include sites-enabled/*; 这样的配置会在 nginx -t 时把它们一起加载
+func stagingDir() string {
+	return filepath.Join(config.GetAppConfig().InstallPath, "staging")
+}
+
+// stagingPath 按原路径生成不会重名的文件名，不同目录下的同名文件互不影响
+func stagingPath(path string, suffix string) string {
+	sum := sha256.Sum256([]byte(filepath.Clean(path)))
+	return filepath.Join(stagingDir(), hex.EncodeToString(sum[:8])+"-"+filepath.Base(path)+suffix)
+}
+
+// stageFiles 把旧文件备份到 stagingDir 并写入新内容，内容为 nil 时删除文件
+func stageFiles(files map[string][]byte) ([]stagedFile, error) {
+	var staged []stagedFile
+	if err := os.MkdirAll(stagingDir(), 0700); err != nil {
+		return staged, fmt.Errorf("创建目录失败: %v", err)
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return staged, fmt.Errorf("创建目录失败: %v", err)
+		}
+
+		entry := stagedFile{path: path, mode: stagedFileMode(path)}
+		if old, err := os.ReadFile(path); err == nil {
+			entry.existed = true
+			entry.backup = stagingPath(path, ".bak")
+			if err := writeFileMode(entry.backup, old, entry.mode); err != nil {
+				return staged, fmt.Errorf("备份 %s 失败: %v", path, err)
+			}
+		}
+		staged = append(staged, entry)
+
+		if content == nil {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return staged, fmt.Errorf("删除 %s 失败: %v", path, err)
+			}
+			continue
+		}
+		if err := replaceFile(path, content, entry.mode); err != nil {
+			return staged, fmt.Errorf("写入 %s 失败: %v", path, err)
+		}
+	}
+	return staged, nil
+}
+
+// replaceFile 先写入 stagingDir 中的临时文件再 rename 到目标位置。
+// stagingDir 与目标不在同一个文件系统时 rename 会失败，此时直接写入目标文件
+func replaceFile(path string, content []byte, mode os.FileMode) error {
+	tmpPath := stagingPath(path, ".tmp")
+	if err := writeFileMode(tmpPath, content, mode); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err == nil {
+		return nil
+	}
+	_ = os.Remove(tmpPath)
+	return writeFileMode(path, content, mode)
+}
+
+// stagedFileMode 私钥文件始终只允许所有者读写，其他文件沿用原文件的权限，新文件为 0644
+func stagedFileMode(path string) os.FileMode {
+	if strings.HasSuffix(path, ".key") {
+		return 0600
+	}
+	if info, err := os.Stat(path); err == nil {
+		return info.Mode().Perm()
+	}
+	return 0644
+}
+
+// writeFileMode 按指定权限写入文件，os.WriteFile 不会修改已存在文件的权限，所以先删除残留的旧文件
+func writeFileMode(path string, content []byte, mode os.FileMode) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.WriteFile(path, content, mode)
+}
+
+// rollbackFiles 恢复被替换的文件，新建的文件直接删除
+func rollbackFiles(staged []stagedFile) {
+	for _, entry := range staged {
+		if entry.existed {
+			content, err := os.ReadFile(entry.backup)
+			if err == nil {
+				err = replaceFile(entry.path, content, entry.mode)
+			}
+			if err != nil {
+				log.Printf("[NGINX] Failed to restore %s: %v", entry.path, err)
+				continue
+			}
+			_ = os.Remove(entry.backup)
+		} else {
+			_ = os.Remove(entry.path)
+		}
+	}
+	log.Printf("[NGINX] Rolled back %d file(s)", len(staged))
+}
+
+// commitFiles 检测通过后清理备份文件
+func commitFiles(staged []stagedFile) {
+	for _, entry := range staged {
+		if entry.existed {
+			_ = os.Remove(entry.backup)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"uranus/internal/config"
+	"uranus/internal/models"
+	"uranus/internal/nginxconf"
+)
+
+// 检查结果，有 error 时不会向 CA 申请证书
+const (
+	CheckOK      = "ok"
+	CheckWarning = "warning"
+	CheckError   = "error"
+)
+
+// 证书的验证方式
+const (
+	ChallengeHTTP01   = "http-01"
+	ChallengeDNS01    = "dns-01"
+	ChallengeInternal = "internal"
+)
+
+const (
+	// HTTP-01 验证使用的本地端口，由 /.well-known location 转发
+	http01Port          = "9999"
+	readinessDNSTimeout = 5 * time.Second
+)
+
+// ReadinessCheck 一项检查的结果
+type ReadinessCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// DomainReadiness 一个域名的检查结果
+type DomainReadiness struct {
+	Domain    string           `json:"domain"`
+	Addresses []string         `json:"addresses"`
+	Ready     bool             `json:"ready"`
+	Checks    []ReadinessCheck `json:"checks"`
+}
+
+// ReadinessReport 申请证书前的检查报告，Checks 为端口、DNS 凭据等与域名无关的检查
+type ReadinessReport struct {
+	ConfigName string            `json:"configName"`
+	Shared     bool              `json:"shared"`
+	Challenge  string            `json:"challenge"`
+	IP         string            `json:"ip"`
+	Ready      bool              `json:"ready"`
+	Checks     []ReadinessCheck  `json:"checks"`
+	Domains    []DomainReadiness `json:"domains"`
+	CheckedAt  time.Time         `json:"checkedAt"`
+}
+
+// ReadinessError 检查没有通过，Report 中有每个域名的结果
+type ReadinessError struct {
+	Report *ReadinessReport
+}
+
+func (e *ReadinessError) Error() string {
+	lines := []string{"申请证书前检查没有通过:"}
+	for _, check := range e.Report.Checks {
+		if check.Status == CheckError {
+			lines = append(lines, "- "+check.Message)
+		}
+	}
+	for _, domain := range e.Report.Domains {
+		for _, check := range domain.Checks {
+			if check.Status == CheckError {
+				lines = append(lines, fmt.Sprintf("- %s: %s", domain.Domain, check.Message))
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *ReadinessReport) add(status string, name string, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, ReadinessCheck{Name: name, Status: status, Message: fmt.Sprintf(format, args...)})
+}
+
+func (d *DomainReadiness) add(status string, name string, format string, args ...interface{}) {
+	d.Checks = append(d.Checks, ReadinessCheck{Name: name, Status: status, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *ReadinessReport) finish() *ReadinessReport {
+	r.Ready = true
+	for _, check := range r.Checks {
+		if check.Status == CheckError {
+			r.Ready = false
+		}
+	}
+	for i := range r.Domains {
+		domain := &r.Domains[i]
+		domain.Ready = true
+		for _, check := range domain.Checks {
+			if check.Status == CheckError {
+				domain.Ready = false
+				r.Ready = false
+			}
+		}
+	}
+	return r
+}
+
+// CheckCertReadiness 检查证书能否申请，configName 为站点名或共享证书名称，domains 为空时使用证书保存的域名，
+// testDNS 为 true 时使用 DNS 凭据创建并删除一条 TXT 记录，确认凭据可用
+func CheckCertReadiness(configName string, shared bool, domains []string, testDNS bool) (*ReadinessReport, error) {
+	cert, err := findManagedCert(configName, shared)
+	if err != nil && shared {
+		return nil, err
+	}
+	// 站点第一次申请证书时还没有记录
+	cert.FileName = configName
+	if len(domains) == 0 {
+		domains = savedCertDomains(&cert)
+	}
+	if len(domains) == 0 {
+		return nil, errors.New("没有需要申请证书的域名")
+	}
+	return checkReadiness(&cert, domains, testDNS), nil
+}
+
+// savedCertDomains 证书上次申请时保存的域名
+func savedCertDomains(cert *models.Cert) []string {
+	data, err := os.ReadFile(filepath.Join(CertDir(cert), "domains"))
+	if err != nil {
+		data = []byte(cert.Domains)
+	}
+	var domains []string
+	for _, domain := range strings.Split(string(data), ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+func checkReadiness(cert *models.Cert, domains []string, testDNS bool) *ReadinessReport {
+	report := &ReadinessReport{
+		ConfigName: cert.FileName,
+		Shared:     cert.Shared,
+		Challenge:  ChallengeHTTP01,
+		IP:         config.GetAppConfig().IP,
+		CheckedAt:  time.Now(),
+	}
+	for _, domain := range domains {
+		report.Domains = append(report.Domains, DomainReadiness{Domain: domain})
+	}
+
+	switch {
+	case cert.InternalCA:
+		// 内部 CA 直接签发，不需要验证域名
+		report.Challenge = ChallengeInternal
+		report.add(CheckOK, "issuer", "使用内部 CA 签发，不需要验证域名")
+	case cert.DNSCredentialID != 0:
+		report.Challenge = ChallengeDNS01
+		checkDNSCredential(report, cert, testDNS)
+		for i := range report.Domains {
+			checkDomainAddress(&report.Domains[i], report.IP, false)
+		}
+	default:
+		checkHTTP01Port(report)
+		sites := httpServers()
+		for i := range report.Domains {
+			domain := &report.Domains[i]
+			if strings.HasPrefix(domain.Domain, "*.") {
+				domain.add(CheckError, "challenge", "通配符证书需要使用 DNS-01 验证，请先为证书选择 DNS 凭据")
+				continue
+			}
+			checkDomainAddress(domain, report.IP, true)
+			checkWellKnown(domain, sites)
+		}
+	}
+	return report.finish()
+}
+
+// checkDomainAddress 检查域名的 A/AAAA 记录是否指向本机，HTTP-01 验证时不指向本机为错误，
+// DNS-01 验证不需要解析到本机，只提示
+func checkDomainAddress(domain *DomainReadiness, ip string, required bool) {
+	status := CheckWarning
+	if required {
+		status = CheckError
+	}
+	name := strings.TrimPrefix(domain.Domain, "*.")
+	ctx, cancel := context.WithTimeout(context.Background(), readinessDNSTimeout)
+	defer cancel()
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, name)
+	if err != nil || len(addresses) == 0 {
+		domain.add(status, "dns", "域名没有 A/AAAA 记录: %v", err)
+		return
+	}
+
+	local := net.ParseIP(ip)
+	var v4, v6 []string
+	matchV4, matchV6 := false, false
+	for _, address := range addresses {
+		domain.Addresses = append(domain.Addresses, address.IP.String())
+		if address.IP.To4() != nil {
+			v4 = append(v4, address.IP.String())
+			matchV4 = matchV4 || address.IP.Equal(local)
+		} else {
+			v6 = append(v6, address.IP.String())
+			matchV6 = matchV6 || address.IP.Equal(local)
+		}
+	}
+	switch {
+	case local == nil:
+		domain.add(CheckWarning, "dns", "没有配置本机 IP，无法确认解析结果: %s", strings.Join(domain.Addresses, ", "))
+	case local.To4() != nil && len(v4) == 0:
+		domain.add(status, "dns", "域名没有 A 记录，本机 IP 为 %s", ip)
+	case local.To4() != nil && !matchV4:
+		domain.add(status, "dns", "A 记录 %s 没有指向本机 IP %s", strings.Join(v4, ", "), ip)
+	case local.To4() == nil && !matchV6:
+		domain.add(status, "dns", "AAAA 记录 %s 没有指向本机 IP %s", strings.Join(v6, ", "), ip)
+	default:
+		domain.add(CheckOK, "dns", "解析到 %s", strings.Join(domain.Addresses, ", "))
+	}
+	// CA 会优先通过 IPv6 访问，AAAA 记录指向其他服务器时验证会失败
+	if local != nil && local.To4() != nil && len(v6) > 0 {
+		domain.add(CheckWarning, "dns", "域名有 AAAA 记录 %s，CA 会优先通过 IPv6 验证，请确认指向本机", strings.Join(v6, ", "))
+	}
+}
+
+// checkHTTP01Port 检查 HTTP-01 验证使用的端口是否空闲
+func checkHTTP01Port(report *ReadinessReport) {
+	listener, err := net.Listen("tcp", ":"+http01Port)
+	if err != nil {
+		report.add(CheckError, "port", "端口 %s 被占用，无法响应 HTTP-01 验证: %v", http01Port, err)
+		return
+	}
+	_ = listener.Close()
+	report.add(CheckOK, "port", "端口 %s 空闲", http01Port)
+}
+
+// checkDNSCredential 检查 DNS 凭据，testDNS 为 true 时实际创建并删除验证记录
+func checkDNSCredential(report *ReadinessReport, cert *models.Cert, testDNS bool) {
+	credential := models.GetDNSCredentialByID(cert.DNSCredentialID)
+	if credential.ID == 0 {
+		report.add(CheckError, "credential", "证书使用的 DNS 凭据不存在")
+		return
+	}
+	provider, err := NewDNSChallengeProvider(&credential)
+	if err != nil {
+		report.add(CheckError, "credential", "DNS 凭据 %s 配置错误: %v", credential.Name, err)
+		return
+	}
+	if !testDNS {
+		report.add(CheckOK, "credential", "使用 DNS 凭据 %s，没有测试写入 TXT 记录", credential.Name)
+		return
+	}
+
+	// 通配符和主域名使用同一条 _acme-challenge 记录，只测试一次
+	tested := map[string]bool{}
+	for i := range report.Domains {
+		domain := &report.Domains[i]
+		name := strings.TrimPrefix(domain.Domain, "*.")
+		if tested[name] {
+			continue
+		}
+		tested[name] = true
+		keyAuth := "uranus-readiness-check"
+		if err := provider.Present(name, "", keyAuth); err != nil {
+			domain.add(CheckError, "credential", "DNS 凭据 %s 无法创建验证记录: %v", credential.Name, err)
+			continue
+		}
+		if err := provider.CleanUp(name, "", keyAuth); err != nil {
+			domain.add(CheckWarning, "credential", "验证记录已创建，但删除失败，请手动删除 _acme-challenge.%s: %v", name, err)
+			continue
+		}
+		domain.add(CheckOK, "credential", "DNS 凭据 %s 可以创建验证记录", credential.Name)
+	}
+}
+
+// httpServer 站点配置中监听 HTTP 的 server 块
+type httpServer struct {
+	site      string
+	names     []string
+	wellKnown bool
+}
+
+// httpServers 读取所有启用的站点配置，找出监听 HTTP 的 server 块
+func httpServers() []httpServer {
+	var servers []httpServer
+	for _, path := range siteFiles() {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		parsed, err := nginxconf.Parse(path, content)
+		if err != nil {
+			continue
+		}
+		for _, server := range nginxconf.Servers(parsed.Nodes, false) {
+			if !servesHTTP(server) {
+				continue
+			}
+			item := httpServer{site: siteFileName(path), names: server.ServerNames}
+			for _, location := range server.Directive.Find("location") {
+				if isWellKnownLocation(location) {
+					item.wellKnown = true
+				}
+			}
+			servers = append(servers, item)
+		}
+	}
+	return servers
+}
+
+// servesHTTP 没有 listen 时默认监听 80 端口
+func servesHTTP(server *nginxconf.Server) bool {
+	if len(server.Listen) == 0 {
+		return true
+	}
+	for _, listen := range server.Listen {
+		if !strings.Contains(" "+listen+" ", " ssl ") {
+			return true
+		}
+	}
+	return false
+}
+
+func serverNameMatches(pattern string, domain string) bool {
+	pattern, domain = strings.ToLower(pattern), strings.ToLower(domain)
+	switch {
+	case pattern == domain:
+		return true
+	case strings.HasPrefix(pattern, "*."):
+		return strings.HasSuffix(domain, pattern[1:])
+	case strings.HasPrefix(pattern, "."):
+		return domain == pattern[1:] || strings.HasSuffix(domain, pattern)
+	}
+	return false
+}
+
+// checkWellKnown 检查域名的 HTTP server 是否把 /.well-known 转发到验证端口
+func checkWellKnown(domain *DomainReadiness, servers []httpServer) {
+	var missing []string
+	for _, server := range servers {
+		for _, name := range server.names {
+			if !serverNameMatches(name, domain.Domain) {
+				continue
+			}
+			if server.wellKnown {
+				domain.add(CheckOK, "well-known", "站点 %s 已配置 /.well-known 转发", server.site)
+				return
+			}
+			missing = append(missing, server.site)
+		}
+	}
+	if len(missing) > 0 {
+		domain.add(CheckError, "well-known", "站点 %s 的 HTTP server 没有把 /.well-known 转发到 127.0.0.1:%s", strings.Join(missing, ", "), http01Port)
+		return
+	}
+	domain.add(CheckError, "well-known", "没有找到 server_name 包含该域名的 HTTP 站点")
+}
@@ -0,0 +1,304 @@
+package services
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"uranus/internal/config"
+	"uranus/internal/models"
+	"uranus/internal/nginxconf"
+
+	"github.com/go-acme/lego/v4/certcrypto"
+)
+
+// SiteDrift 数据库记录与磁盘上配置文件不一致的字段
+type SiteDrift struct {
+	FileName string `json:"fileName"`
+	Field    string `json:"field"`
+	Database string `json:"database"`
+	Disk     string `json:"disk"`
+}
+
+// ReconcileReport 站点导入/同步结果
+type ReconcileReport struct {
+	Scanned int         `json:"scanned"`
+	Created []string    `json:"created"`
+	Updated []string    `json:"updated"`
+	Drift   []SiteDrift `json:"drift"`
+	Orphans []string    `json:"orphans"` // 数据库中有记录但磁盘上没有配置文件
+	Errors  []string    `json:"errors"`
+}
+
+// DriftByFile 按配置文件名汇总不一致的字段
+func (r *ReconcileReport) DriftByFile() map[string][]string {
+	result := map[string][]string{}
+	for _, drift := range r.Drift {
+		result[drift.FileName] = append(result[drift.FileName], drift.Field)
+	}
+	return result
+}
+
+var reconcileMutex sync.Mutex
+
+// 站点列表页显示的差异缓存，避免每次打开页面都解析所有配置文件
+const siteDriftCacheTTL = time.Minute
+
+var (
+	siteDriftCache     map[string][]string
+	siteDriftCacheTime time.Time
+	siteDriftCacheLock sync.Mutex
+)
+
+// SiteDriftByFile 按配置文件名汇总的差异，一分钟内重复调用直接返回上次的结果
+func SiteDriftByFile() map[string][]string {
+	siteDriftCacheLock.Lock()
+	if siteDriftCache != nil && time.Since(siteDriftCacheTime) < siteDriftCacheTTL {
+		defer siteDriftCacheLock.Unlock()
+		return siteDriftCache
+	}
+	siteDriftCacheLock.Unlock()
+	return ReconcileSites(false).DriftByFile()
+}
+
+// invalidateSiteDrift 站点配置或记录变化后丢弃缓存的差异
+func invalidateSiteDrift() {
+	siteDriftCacheLock.Lock()
+	siteDriftCache = nil
+	siteDriftCacheLock.Unlock()
+}
+
+func storeSiteDrift(drift map[string][]string) {
+	siteDriftCacheLock.Lock()
+	siteDriftCache = drift
+	siteDriftCacheTime = time.Now()
+	siteDriftCacheLock.Unlock()
+}
+
+// siteDirs 返回需要扫描的站点目录: VhostPath 以及 nginx 目录下的 sites-enabled
+func siteDirs() []string {
+	dirs := []string{config.GetAppConfig().VhostPath}
+	if confPath := config.ReadNginxCompileInfo().NginxConfPath; confPath != "" {
+		sitesEnabled := filepath.Join(filepath.Dir(confPath), "sites-enabled")
+		if info, err := os.Stat(sitesEnabled); err == nil && info.IsDir() {
+			dirs = append(dirs, sitesEnabled)
+		}
+	}
+	return dirs
+}
+
+// siteFiles 列出站点目录中的配置文件，VhostPath 只包含 .conf 文件，
+// sites-enabled 中的文件 (通常是软链接) 不要求扩展名，nginx 同样会加载它们
+func siteFiles() []string {
+	var files []string
+	for i, dir := range siteDirs() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			log.Printf("[SITES] Failed to read %s: %v", dir, err)
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || IsUranusConfFile(entry.Name()) {
+				continue
+			}
+			if i == 0 && !strings.HasSuffix(entry.Name(), ".conf") {
+				continue
+			}
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return files
+}
+
+// siteFileName 由配置文件路径得到 Cert.FileName
+func siteFileName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ".conf")
+}
+
+// inSiteDirs 判断文件是否直接位于给定的目录中
+func inSiteDirs(path string, dirs []string) bool {
+	dir := filepath.Dir(filepath.Clean(path))
+	for _, siteDir := range dirs {
+		if dir == filepath.Clean(siteDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// ImportedSitePath 返回从 sites-enabled 导入的站点的配置文件路径 (Cert.FilePath)，
+// VhostPath 中存在同名配置或站点不是从 sites-enabled 导入时返回空字符串
+func ImportedSitePath(fileName string) string {
+	name := strings.TrimSuffix(fileName, ".conf")
+	if _, err := os.Stat(filepath.Join(config.GetAppConfig().VhostPath, name+".conf")); err == nil {
+		return ""
+	}
+	cert := models.GetCertByFilename(name)
+	if cert.FilePath == "" || !inSiteDirs(cert.FilePath, siteDirs()[1:]) {
+		return ""
+	}
+	if _, err := os.Stat(cert.FilePath); err != nil {
+		return ""
+	}
+	return cert.FilePath
+}
+
+// ImportedSiteFiles 列出已经导入的 sites-enabled 站点配置文件
+func ImportedSiteFiles() []os.FileInfo {
+	var files []os.FileInfo
+	for _, path := range siteFiles() {
+		if !inSiteDirs(path, siteDirs()[1:]) || ImportedSitePath(siteFileName(path)) != path {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			files = append(files, info)
+		}
+	}
+	return files
+}
+
+// ReconcileSites 扫描站点目录，对比数据库中的记录；
+// apply 为 true 时以磁盘为准创建或更新 Cert 记录，否则只报告差异
+func ReconcileSites(apply bool) *ReconcileReport {
+	reconcileMutex.Lock()
+	defer reconcileMutex.Unlock()
+
+	report := &ReconcileReport{}
+	onDisk := map[string]bool{}
+
+	for _, path := range siteFiles() {
+		// sites-enabled 中没有扩展名的文件按文件名导入，编辑时写回原文件，见 ImportedSitePath
+		fileName := siteFileName(path)
+		if onDisk[fileName] {
+			// 与 VhostPath 中的文件重名，以 VhostPath 为准
+			continue
+		}
+		onDisk[fileName] = true
+		report.Scanned++
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			report.Errors = append(report.Errors, path+": "+err.Error())
+			continue
+		}
+		parsed, err := nginxconf.Parse(path, content)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+		info := nginxconf.Summarize(parsed)
+
+		cert := models.GetCertByFilename(fileName)
+		drift := siteDrift(fileName, &cert, info)
+		if cert.ID != 0 {
+			report.Drift = append(report.Drift, drift...)
+		}
+		if !apply || (cert.ID != 0 && len(drift) == 0 && cert.FilePath == path) {
+			continue
+		}
+
+		isNew := cert.ID == 0
+		cert.FileName = fileName
+		FillCertFromSiteInfo(&cert, path, string(content), info)
+		if err := models.GetDbClient().Save(&cert).Error; err != nil {
+			report.Errors = append(report.Errors, fileName+": "+err.Error())
+			continue
+		}
+		if isNew {
+			report.Created = append(report.Created, fileName)
+		} else {
+			report.Updated = append(report.Updated, fileName)
+		}
+	}
+
+	// 已停用的站点保留数据库记录，不算作孤立记录
+	for _, info := range DisabledSiteFiles() {
+		onDisk[siteFileName(info.Name())] = true
+	}
+
+	for _, cert := range models.GetCertificates() {
+		if !cert.Shared && !onDisk[cert.FileName] {
+			report.Orphans = append(report.Orphans, cert.FileName)
+		}
+	}
+	sort.Strings(report.Orphans)
+
+	if apply {
+		invalidateSiteDrift()
+		log.Printf("[SITES] Reconcile finished: scanned %d, created %d, updated %d, orphans %d",
+			report.Scanned, len(report.Created), len(report.Updated), len(report.Orphans))
+	} else {
+		storeSiteDrift(report.DriftByFile())
+	}
+	return report
+}
+
+// FillCertFromSiteInfo 用配置文件中解析出的信息更新 Cert 记录 (不保存)
+func FillCertFromSiteInfo(cert *models.Cert, path string, content string, info *nginxconf.SiteInfo) {
+	cert.FilePath = path
+	cert.Content = content
+	cert.Domains = strings.Join(info.Domains, ",")
+	cert.Proxy = info.Proxy
+	cert.Listen = strings.Join(info.Listen, ",")
+	cert.SSLCertificate = info.SSLCertificate
+	cert.SSLCertificateKey = info.SSLCertificateKey
+	// 只有 uranus 自己管理的证书才记录过期时间，避免续期任务覆盖手动配置的证书
+	managedCert := filepath.Join(config.GetAppConfig().SSLPath, cert.FileName, "fullchain.cer")
+	if filepath.Clean(info.SSLCertificate) == managedCert {
+		if notAfter, ok := readCertificateNotAfter(info.SSLCertificate); ok {
+			cert.NotAfter = notAfter
+		}
+	}
+}
+
+// siteDrift 比较数据库记录与配置文件中解析出的信息
+func siteDrift(fileName string, cert *models.Cert, info *nginxconf.SiteInfo) []SiteDrift {
+	var drift []SiteDrift
+	compare := func(field, database, disk string) {
+		if database != disk {
+			drift = append(drift, SiteDrift{FileName: fileName, Field: field, Database: database, Disk: disk})
+		}
+	}
+
+	compare("domains", normalizeList(cert.Domains), normalizeList(strings.Join(info.Domains, ",")))
+	compare("proxy", cert.Proxy, info.Proxy)
+	if cert.SSLCertificate != "" || info.SSLCertificate != "" {
+		compare("sslCertificate", cert.SSLCertificate, info.SSLCertificate)
+	}
+	// 数据库认为有证书，但配置文件没有启用 SSL
+	if !cert.NotAfter.IsZero() && !info.SSL {
+		compare("ssl", "enabled", "disabled")
+	}
+	return drift
+}
+
+// normalizeList 去掉空白并排序逗号分隔的列表，便于比较
+func normalizeList(value string) string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// readCertificateNotAfter 读取证书文件的过期时间
+func readCertificateNotAfter(path string) (notAfter time.Time, ok bool) {
+	if path == "" {
+		return notAfter, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return notAfter, false
+	}
+	certificate, err := certcrypto.ParsePEMCertificate(data)
+	if err != nil {
+		return notAfter, false
+	}
+	return certificate.NotAfter, true
+}
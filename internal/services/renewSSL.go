@@ -1,55 +1,187 @@
 package services
 
 import (
-	"crypto/tls"
-	"crypto/x509"
-	"github.com/robfig/cron/v3"
-	"io"
+	"context"
+	"github.com/go-acme/lego/v4/certcrypto"
 	"log"
-	"net/http"
-	"strings"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
 	"time"
+	"uranus/internal/config"
 	"uranus/internal/models"
 )
 
-func GetCertificateInfo(domain string) *x509.Certificate {
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+const (
+	// 每小时检查一次需要续期的证书
+	renewalCheckInterval = time.Hour
+	// 续期失败后的重试间隔，每次失败翻倍，最长一天
+	renewalBackoffBase = 30 * time.Minute
+	renewalBackoffMax  = 24 * time.Hour
+	// 重新查询 ARI 的间隔
+	ariPollInterval = 6 * time.Hour
+)
+
+var (
+	renewalMutex sync.Mutex
+	// 上传的证书到期提醒，每天提醒一次
+	uploadWarnedAt = map[uint]time.Time{}
+)
+
+// RenewalWindow 证书到期前多久开始续期，未配置时为 30 天
+func RenewalWindow() time.Duration {
+	days := config.GetAppConfig().RenewBeforeDays
+	if days <= 0 {
+		return CertExpiryWarning
 	}
-	client := &http.Client{Transport: transport}
-	response, err := client.Get("https://" + domain)
-	if err != nil {
-		log.Printf("证书获取失败: %v", domain)
-		return nil
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// renewalBackoff 第 failures 次失败后等待的时间，指数增长并加入随机抖动，避免同时重试
+func renewalBackoff(failures int) time.Duration {
+	backoff := renewalBackoffBase
+	for i := 1; i < failures && backoff < renewalBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > renewalBackoffMax {
+		backoff = renewalBackoffMax
 	}
-	defer func(Body io.ReadCloser) {
-		_ = Body.Close()
-	}(response.Body)
-	return response.TLS.PeerCertificates[0]
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
 }
 
-func RenewSSL() {
-	// 每天 00:05 进行检测
-	spec := "5 0 * * *"
-	c := cron.New()
-	_, _ = c.AddFunc(spec, func() {
-		for _, cert := range models.GetCertificates() {
-			var need2Renew = false
-			if cert.NotAfter.Unix() != -62135596800 {
-				if cert.NotAfter.Sub(time.Now()) < time.Hour*24*30 {
-					log.Printf("%v => 需要续期\n", cert.Domains)
-					need2Renew = true
-				} else {
-					log.Printf("%v => 证书续期时间: %v\n", cert.Domains, cert.NotAfter.Format("2006-01-02 15:04:05"))
-				}
-			}
-			if need2Renew {
-				_ = IssueCert(strings.Split(cert.Domains, ","), cert.FileName)
-				ReloadNginx()
+// StartRenewalScheduler 定时检查证书，在续期窗口或 CA 建议的时间内自动续期，失败后按指数退避重试
+func StartRenewalScheduler(ctx context.Context) {
+	// 启动一分钟后第一次检查，等待站点导入完成
+	timer := time.NewTimer(time.Minute)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			checkRenewals(time.Now())
+			timer.Reset(renewalCheckInterval)
+		}
+	}
+}
+
+func checkRenewals(now time.Time) {
+	renewalMutex.Lock()
+	defer renewalMutex.Unlock()
+
+	for _, cert := range models.GetCertificates() {
+		cert := cert
+		// 上传的证书不能自动续期，到期前每天提醒
+		if cert.Uploaded {
+			if time.Until(cert.NotAfter) < CertExpiryWarning && now.Sub(uploadWarnedAt[cert.ID]) > 24*time.Hour {
+				log.Printf("[SSL] 上传的证书 %s (%v) 将于 %v 到期，请上传新证书\n", cert.FileName, cert.Domains, cert.NotAfter.Format("2006-01-02"))
+				uploadWarnedAt[cert.ID] = now
 			}
+			continue
+		}
+		// 没有签发成功的证书和已吊销的证书需要手动签发
+		if cert.NotAfter.IsZero() || cert.RevokedAt != nil {
+			continue
+		}
+		// 已停用的站点无法完成 HTTP 验证，启用后再续期，DNS-01 验证和内部 CA 不受影响
+		if !cert.Shared && IsSiteDisabled(cert.FileName) && cert.DNSCredentialID == 0 && !cert.InternalCA {
+			continue
+		}
+		if !cert.InternalCA {
+			refreshRenewalInfo(&cert, now)
+		}
+		if trigger := renewalTrigger(&cert, now); trigger != "" {
+			renewCertificate(&cert, trigger)
+		}
+	}
+}
+
+// renewalTrigger 证书需要续期时返回触发原因，CA 提供了 ARI 时使用建议的时间，否则使用配置的续期窗口
+func renewalTrigger(cert *models.Cert, now time.Time) string {
+	switch {
+	case cert.NextRenewAt != nil:
+		if now.Before(*cert.NextRenewAt) {
+			return ""
 		}
-	})
-	go c.Start()
-	defer c.Stop()
-	select {}
+		return models.RenewalTriggerRetry
+	case cert.RenewAt != nil:
+		if now.Before(*cert.RenewAt) {
+			return ""
+		}
+		return models.RenewalTriggerARI
+	case cert.NotAfter.Sub(now) < RenewalWindow():
+		return models.RenewalTriggerWindow
+	}
+	return ""
+}
+
+// refreshRenewalInfo 查询 CA 建议的续期窗口，在窗口内随机选择续期时间，查询失败时继续使用上次的结果
+func refreshRenewalInfo(cert *models.Cert, now time.Time) {
+	if cert.ARICheckedAt != nil && now.Sub(*cert.ARICheckedAt) < ariPollInterval {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(CertDir(cert), "fullchain.cer"))
+	if err != nil {
+		return
+	}
+	leaf, err := certcrypto.ParsePEMCertificate(data)
+	if err != nil {
+		return
+	}
+	issuer, err := resolveACMEIssuer(cert)
+	if err != nil {
+		return
+	}
+	window, err := fetchRenewalInfo(issuer, leaf)
+	if err != nil {
+		log.Printf("[SSL] Failed to fetch renewal information of %s: %v", cert.FileName, err)
+		return
+	}
+
+	cert.ARICheckedAt = &now
+	switch {
+	case window == nil:
+		cert.RenewAt = nil
+	case cert.RenewAt != nil && !cert.RenewAt.Before(window.Start) && !cert.RenewAt.After(window.End):
+		// 已经选择的时间仍在窗口内
+	default:
+		renewAt := window.Start.Add(time.Duration(rand.Int63n(int64(window.End.Sub(window.Start)) + 1)))
+		cert.RenewAt = &renewAt
+		log.Printf("[SSL] Certificate %s will be renewed at %s as suggested by the CA", cert.FileName, renewAt.Format("2006-01-02 15:04"))
+	}
+	models.GetDbClient().Model(cert).Select("RenewAt", "ARICheckedAt").Updates(cert)
+}
+
+// renewCertificate 续期并保存结果，新证书经过检查和 nginx -t 后才会替换旧证书并 reload
+func renewCertificate(cert *models.Cert, trigger string) {
+	start := time.Now()
+	attempt := &models.RenewalAttempt{
+		FileName: cert.FileName,
+		Shared:   cert.Shared,
+		Attempt:  cert.RenewFailures + 1,
+		Trigger:  trigger,
+		NotAfter: cert.NotAfter,
+	}
+	log.Printf("[SSL] Renewing certificate %s (%v), attempt %d", cert.FileName, cert.Domains, attempt.Attempt)
+
+	err := issueCertificate(cert, nil)
+	attempt.Duration = time.Since(start).Milliseconds()
+	if err == nil {
+		attempt.Outcome = models.RenewalOutcomeSuccess
+		notAfter := cert.NotAfter
+		attempt.NewNotAfter = &notAfter
+	} else {
+		attempt.Outcome = models.RenewalOutcomeFailed
+		attempt.Error = err.Error()
+		next := time.Now().Add(renewalBackoff(attempt.Attempt))
+		attempt.NextRetryAt = &next
+		cert.RenewFailures = attempt.Attempt
+		cert.NextRenewAt = &next
+		models.GetDbClient().Model(cert).Select("RenewFailures", "NextRenewAt").Updates(cert)
+		log.Printf("[SSL] Failed to renew certificate %s: %v, retry at %s", cert.FileName, err, next.Format("2006-01-02 15:04"))
+	}
+	if dbErr := models.GetDbClient().Create(attempt).Error; dbErr != nil {
+		log.Printf("[SSL] Failed to save renewal attempt: %v", dbErr)
+	}
 }
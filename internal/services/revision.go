@@ -0,0 +1,110 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"uranus/internal/config"
+	"uranus/internal/models"
+	"uranus/internal/tools"
+)
+
+// SaveConfFile 保存 nginx.conf 或站点配置，检测通过后记录一个历史版本。
+// 只能写入 uranus 管理的配置文件，见 IsManagedConfFile
+func SaveConfFile(path string, content string, author string, source string) (*NginxTestResult, error) {
+	if !IsManagedConfFile(path) {
+		return nil, fmt.Errorf("不允许写入 %s", path)
+	}
+	previous, _ := os.ReadFile(path)
+
+	result, err := ApplyNginxFile(linkTarget(path), []byte(content))
+	if err != nil || !result.OK {
+		return result, err
+	}
+
+	RecordRevision(path, string(previous), content, author, source)
+	return result, nil
+}
+
+// RecordRevision 记录一次配置变更，previous 为写入前磁盘上的内容
+func RecordRevision(path string, previous string, content string, author string, source string) {
+	latest := models.GetLatestRevision(path)
+
+	// 第一次记录时把磁盘上原有的内容作为基线版本，便于回滚
+	if latest.ID == 0 && previous != "" {
+		latest = models.Revision{
+			FilePath: path,
+			Content:  previous,
+			Author:   "system",
+			Source:   models.RevisionSourceDisk,
+		}
+		if err := models.GetDbClient().Create(&latest).Error; err != nil {
+			log.Printf("[REVISION] Failed to save baseline of %s: %v", path, err)
+		}
+	}
+
+	if latest.ID != 0 && latest.Content == content {
+		return
+	}
+
+	revision := models.Revision{
+		FilePath: path,
+		Content:  content,
+		Diff:     tools.UnifiedDiff(path, path, latest.Content, content),
+		Author:   author,
+		Source:   source,
+	}
+	if err := models.GetDbClient().Create(&revision).Error; err != nil {
+		log.Printf("[REVISION] Failed to save revision of %s: %v", path, err)
+	}
+}
+
+// RestoreRevision 将文件恢复到指定的历史版本，恢复本身也会作为新版本记录
+func RestoreRevision(id uint, author string, source string) (*NginxTestResult, error) {
+	revision := models.GetRevisionByID(id)
+	if revision.ID == 0 {
+		return nil, errors.New("历史版本不存在")
+	}
+	// 自定义模板不是 nginx 配置，不需要检测和重载
+	if IsCustomTemplateFile(revision.FilePath) {
+		if err := restoreCustomTemplate(revision.FilePath, revision.Content, author, source); err != nil {
+			return nil, err
+		}
+		return &NginxTestResult{OK: true}, nil
+	}
+	if !IsManagedConfFile(revision.FilePath) {
+		return nil, errors.New("不允许恢复该文件")
+	}
+	return SaveConfFile(revision.FilePath, revision.Content, author, source)
+}
+
+// IsManagedConfFile 判断路径是否为 uranus 管理的配置文件 (nginx.conf、站点目录、stream 目录或 sites-enabled 下的文件)
+func IsManagedConfFile(path string) bool {
+	cleanPath := filepath.Clean(path)
+	if cleanPath == filepath.Clean(NginxConfFile()) {
+		return true
+	}
+	for _, dir := range []string{config.GetAppConfig().VhostPath, StreamDir()} {
+		if strings.HasPrefix(cleanPath, filepath.Clean(dir)+string(filepath.Separator)) {
+			return true
+		}
+	}
+	// 从 sites-enabled 导入的站点
+	return inSiteDirs(cleanPath, siteDirs()[1:])
+}
+
+// linkTarget 返回写入配置时实际修改的文件: sites-enabled 中的软链接写入 nginx 目录下的链接目标，
+// 保留软链接本身
+func linkTarget(path string) string {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil || resolved == filepath.Clean(path) {
+		return path
+	}
+	if strings.HasPrefix(resolved, filepath.Dir(NginxConfFile())+string(filepath.Separator)) {
+		return resolved
+	}
+	return path
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"uranus/internal/config"
+)
+
+var (
+	dataKey      []byte
+	dataKeyMutex sync.Mutex
+)
+
+// DataKeyFile 加密数据目录中敏感文件使用的密钥，首次使用时随机生成，只有 root 可读
+func DataKeyFile() string {
+	return filepath.Join(config.GetAppConfig().InstallPath, "secret.key")
+}
+
+func loadDataKey() ([]byte, error) {
+	dataKeyMutex.Lock()
+	defer dataKeyMutex.Unlock()
+	if dataKey != nil {
+		return dataKey, nil
+	}
+
+	path := DataKeyFile()
+	key, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, key, 0600); err != nil {
+			return nil, fmt.Errorf("写入密钥文件失败: %v", err)
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("密钥文件 %s 已损坏", path)
+	}
+	dataKey = key
+	return dataKey, nil
+}
+
+// encryptData 使用 AES-256-GCM 加密，返回 base64 编码的 nonce+密文
+func encryptData(plain []byte) (string, error) {
+	key, err := loadDataKey()
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, nil)), nil
+}
+
+// decryptData 解密 encryptData 的结果
+func decryptData(encoded string) ([]byte, error) {
+	key, err := loadDataKey()
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("密文长度不正确")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("解密失败，密钥文件可能已更换")
+	}
+	return plain, nil
+}
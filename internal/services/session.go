@@ -0,0 +1,136 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+	"uranus/internal/config"
+	"uranus/internal/models"
+)
+
+const (
+	// 未配置时的会话超时
+	defaultSessionIdle   = 2 * time.Hour
+	defaultSessionMaxAge = 24 * time.Hour
+	// 最后活动时间最多每分钟更新一次，避免每个请求都写数据库
+	sessionTouchInterval = time.Minute
+)
+
+// ErrSessionExpired 会话不存在、被吊销或已经超时
+var ErrSessionExpired = errors.New("会话已过期，请重新登录")
+
+// SessionIdleTimeout 会话空闲多久后失效
+func SessionIdleTimeout() time.Duration {
+	minutes := config.GetAppConfig().SessionIdleMinutes
+	if minutes <= 0 {
+		return defaultSessionIdle
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// SessionMaxAge 登录后会话最长有效时间，同时是 Cookie 的有效期
+func SessionMaxAge() time.Duration {
+	hours := config.GetAppConfig().SessionMaxHours
+	if hours <= 0 {
+		return defaultSessionMaxAge
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// CreateSession 登录成功后创建会话，返回保存到 Cookie 中的令牌
+func CreateSession(user models.User, ip string, userAgent string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw)
+	now := time.Now()
+	session := models.Session{
+		TokenHash:  hashToken(token),
+		UserID:     user.ID,
+		Username:   user.Username,
+		IP:         ip,
+		UserAgent:  userAgent,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(SessionMaxAge()),
+	}
+	db := models.GetDbClient()
+	if err := db.Create(&session).Error; err != nil {
+		return "", err
+	}
+	// 顺便清理已经超时的会话
+	db.Unscoped().Where("expires_at < ? OR last_seen_at < ?", now, now.Add(-SessionIdleTimeout())).
+		Delete(&models.Session{})
+	return token, nil
+}
+
+// ValidateSession 检查会话是否有效并更新最后活动时间，超时的会话会被删除
+func ValidateSession(token string) (models.Session, error) {
+	if token == "" {
+		return models.Session{}, ErrSessionExpired
+	}
+	session := models.GetSessionByHash(hashToken(token))
+	if session.ID == 0 {
+		return session, ErrSessionExpired
+	}
+	now := time.Now()
+	db := models.GetDbClient()
+	if now.After(session.ExpiresAt) || now.Sub(session.LastSeenAt) > SessionIdleTimeout() {
+		db.Unscoped().Delete(&session)
+		return models.Session{}, ErrSessionExpired
+	}
+	if now.Sub(session.LastSeenAt) > sessionTouchInterval {
+		db.Model(&session).Update("last_seen_at", now)
+	}
+	return session, nil
+}
+
+// GetActiveSessions 所有未超时的会话
+func GetActiveSessions() []models.Session {
+	idleSince := time.Now().Add(-SessionIdleTimeout())
+	var active []models.Session
+	for _, session := range models.GetSessions() {
+		if session.LastSeenAt.After(idleSince) {
+			active = append(active, session)
+		}
+	}
+	return active
+}
+
+// IsCurrentSession 会话是否属于 Cookie 中的令牌
+func IsCurrentSession(session models.Session, token string) bool {
+	return token != "" && session.TokenHash == hashToken(token)
+}
+
+// RevokeSession 管理员吊销会话，对应的用户下次请求时需要重新登录
+func RevokeSession(id uint) error {
+	var session models.Session
+	models.GetDbClient().Where("id = ?", id).Find(&session)
+	if session.ID == 0 {
+		return errors.New("会话不存在")
+	}
+	if err := models.GetDbClient().Unscoped().Delete(&session).Error; err != nil {
+		return err
+	}
+	log.Printf("[SESSION] Revoked session of %s from %s", session.Username, session.IP)
+	return nil
+}
+
+// RevokeSessionToken 退出登录时删除当前会话
+func RevokeSessionToken(token string) {
+	if token == "" {
+		return
+	}
+	models.GetDbClient().Unscoped().Where("token_hash = ?", hashToken(token)).Delete(&models.Session{})
+}
+
+// RevokeUserSessions 删除用户的所有会话，exceptToken 对应的当前会话除外
+func RevokeUserSessions(userID uint, exceptToken string) error {
+	exceptHash := ""
+	if exceptToken != "" {
+		exceptHash = hashToken(exceptToken)
+	}
+	return models.RemoveUserSessions(userID, exceptHash)
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"uranus/internal/config"
+)
+
+// sessionKeyPair Cookie 的签名密钥和加密密钥
+type sessionKeyPair struct {
+	Auth       []byte    `json:"auth"`
+	Encryption []byte    `json:"encryption"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type sessionKeyState struct {
+	mutex   sync.Mutex
+	pairs   []sessionKeyPair // 最新的在前
+	handler func([][]byte)
+}
+
+var sessionKeys = &sessionKeyState{}
+
+// SessionKeysFile 会话 Cookie 的密钥，首次启动时随机生成，只有 root 可读
+func SessionKeysFile() string {
+	return filepath.Join(config.GetAppConfig().InstallPath, "session.keys")
+}
+
+func newSessionKeyPair() (sessionKeyPair, error) {
+	pair := sessionKeyPair{Auth: make([]byte, 64), Encryption: make([]byte, 32), CreatedAt: time.Now()}
+	if _, err := rand.Read(pair.Auth); err != nil {
+		return pair, err
+	}
+	if _, err := rand.Read(pair.Encryption); err != nil {
+		return pair, err
+	}
+	return pair, nil
+}
+
+func writeSessionKeys(pairs []sessionKeyPair) error {
+	data, err := json.Marshal(pairs)
+	if err != nil {
+		return err
+	}
+	path := SessionKeysFile()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("写入会话密钥文件失败: %v", err)
+	}
+	return nil
+}
+
+// load 读取密钥文件，不存在时生成。调用者需要持有锁
+func (s *sessionKeyState) load() error {
+	if s.pairs != nil {
+		return nil
+	}
+	path := SessionKeysFile()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		pair, err := newSessionKeyPair()
+		if err != nil {
+			return err
+		}
+		if err := writeSessionKeys([]sessionKeyPair{pair}); err != nil {
+			return err
+		}
+		log.Printf("[SESSION] Generated session keys at %s", path)
+		s.pairs = []sessionKeyPair{pair}
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var pairs []sessionKeyPair
+	if err := json.Unmarshal(data, &pairs); err != nil || len(pairs) == 0 {
+		return fmt.Errorf("会话密钥文件 %s 已损坏", path)
+	}
+	for _, pair := range pairs {
+		if len(pair.Auth) < 32 || len(pair.Encryption) != 32 {
+			return fmt.Errorf("会话密钥文件 %s 已损坏", path)
+		}
+	}
+	s.pairs = pairs
+	return nil
+}
+
+func (s *sessionKeyState) keyPairs() [][]byte {
+	keyPairs := make([][]byte, 0, len(s.pairs)*2)
+	for _, pair := range s.pairs {
+		keyPairs = append(keyPairs, pair.Auth, pair.Encryption)
+	}
+	return keyPairs
+}
+
+// SessionKeyPairs 创建 Cookie 存储使用的密钥，第一对用于签名和加密，其余只用于验证轮换前的 Cookie
+func SessionKeyPairs() ([][]byte, error) {
+	sessionKeys.mutex.Lock()
+	defer sessionKeys.mutex.Unlock()
+	if err := sessionKeys.load(); err != nil {
+		return nil, err
+	}
+	return sessionKeys.keyPairs(), nil
+}
+
+// SessionKeysCreatedAt 当前密钥的生成时间
+func SessionKeysCreatedAt() time.Time {
+	sessionKeys.mutex.Lock()
+	defer sessionKeys.mutex.Unlock()
+	if sessionKeys.load() != nil {
+		return time.Time{}
+	}
+	return sessionKeys.pairs[0].CreatedAt
+}
+
+// SetSessionKeysHandler 密钥轮换后通知 Cookie 存储更换密钥
+func SetSessionKeysHandler(handler func([][]byte)) {
+	sessionKeys.mutex.Lock()
+	defer sessionKeys.mutex.Unlock()
+	sessionKeys.handler = handler
+}
+
+// RotateSessionKeys 生成新的密钥，之后的 Cookie 使用新密钥。
+// 旧密钥签发的 Cookie 在有效期内仍然可以验证，不会让已登录的用户掉线
+func RotateSessionKeys() error {
+	sessionKeys.mutex.Lock()
+	defer sessionKeys.mutex.Unlock()
+	if err := sessionKeys.load(); err != nil {
+		return err
+	}
+	pair, err := newSessionKeyPair()
+	if err != nil {
+		return err
+	}
+	pairs := []sessionKeyPair{pair}
+	// 旧密钥在下一对密钥生成时停止签发，之后最多再使用 SessionMaxAge
+	retiredAt := pair.CreatedAt
+	for _, old := range sessionKeys.pairs {
+		if time.Since(retiredAt) < SessionMaxAge() {
+			pairs = append(pairs, old)
+		}
+		retiredAt = old.CreatedAt
+	}
+	if err := writeSessionKeys(pairs); err != nil {
+		return err
+	}
+	sessionKeys.pairs = pairs
+	log.Printf("[SESSION] Rotated session keys, %d previous key(s) kept for verification", len(pairs)-1)
+	if sessionKeys.handler != nil {
+		sessionKeys.handler(sessionKeys.keyPairs())
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"uranus/internal/config"
+	"uranus/internal/models"
+)
+
+var sharedCertNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// SharedCertDir 共享证书的目录，每个证书一个子目录，与站点证书目录 SSLPath/configName 分开
+func SharedCertDir() string {
+	return filepath.Join(config.GetAppConfig().SSLPath, "_shared")
+}
+
+// CertDir 证书文件 fullchain.cer、private.key 所在的目录
+func CertDir(cert *models.Cert) string {
+	if cert.Shared {
+		return filepath.Join(SharedCertDir(), cert.FileName)
+	}
+	return filepath.Join(config.GetAppConfig().SSLPath, cert.FileName)
+}
+
+// SharedCertDependents 配置文件引用了共享证书的站点
+func SharedCertDependents(cert *models.Cert) []string {
+	var sites []string
+	for _, site := range models.GetCertsUsingCertDir(CertDir(cert)) {
+		sites = append(sites, site.FileName)
+	}
+	sort.Strings(sites)
+	return sites
+}
+
+// CreateSharedCert 新建共享证书并立即申请，通配符域名必须使用 DNS-01 验证或内部 CA，
+// serverID 为 0 时使用默认 CA，keyType 为空时使用 CA 的私钥类型
+func CreateSharedCert(name string, domains []string, credentialID uint, serverID uint, internalCA bool, keyType string) error {
+	name = strings.TrimSpace(name)
+	if !sharedCertNameRegex.MatchString(name) {
+		return errors.New("证书名称只能包含字母、数字、点、下划线和横线")
+	}
+	if len(domains) == 0 {
+		return errors.New("请填写域名")
+	}
+	if hasWildcardDomain(domains) && credentialID == 0 && !internalCA {
+		return errors.New("通配符证书需要使用 DNS-01 验证，请选择 DNS 凭据")
+	}
+	if credentialID != 0 && models.GetDNSCredentialByID(credentialID).ID == 0 {
+		return errors.New("DNS 凭据不存在")
+	}
+	if serverID != 0 && models.GetACMEServerByID(serverID).ID == 0 {
+		return errors.New("ACME 服务器不存在")
+	}
+	if _, ok := acmeKeyTypes[keyType]; keyType != "" && !ok {
+		return fmt.Errorf("不支持的私钥类型: %s", keyType)
+	}
+	if models.GetSharedCert(name).ID != 0 {
+		return fmt.Errorf("共享证书 %s 已存在", name)
+	}
+
+	cert := models.Cert{
+		FileName:        name,
+		Domains:         strings.Join(domains, ","),
+		DNSCredentialID: credentialID,
+		ACMEServerID:    serverID,
+		InternalCA:      internalCA,
+		KeyType:         keyType,
+		Shared:          true,
+	}
+	if err := models.GetDbClient().Save(&cert).Error; err != nil {
+		return err
+	}
+	if err := issueCertificate(&cert, domains); err != nil {
+		return fmt.Errorf("证书已创建，但申请失败，可以刷新后在列表中重新申请: %v", err)
+	}
+	return nil
+}
+
+// RenewSharedCert 续签共享证书，所有引用它的站点只 reload 一次
+func RenewSharedCert(name string) error {
+	cert := models.GetSharedCert(name)
+	if cert.ID == 0 {
+		return errors.New("共享证书不存在")
+	}
+	return issueCertificate(&cert, nil)
+}
+
+// DeleteSharedCert 删除共享证书，仍被站点引用时不能删除
+func DeleteSharedCert(name string) error {
+	cert := models.GetSharedCert(name)
+	if cert.ID == 0 {
+		return errors.New("共享证书不存在")
+	}
+	if sites := SharedCertDependents(&cert); len(sites) > 0 {
+		return fmt.Errorf("证书正在被站点使用: %s", strings.Join(sites, ", "))
+	}
+	if err := os.RemoveAll(CertDir(&cert)); err != nil {
+		log.Printf("[SSL] Failed to remove shared certificate files: %v", err)
+	}
+	return cert.Remove()
+}
@@ -0,0 +1,584 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"uranus/internal/config"
+	"uranus/internal/models"
+	"uranus/internal/nginxconf"
+)
+
+// 生成配置时统一设置的请求头，从已有配置导入时跳过
+var defaultProxyHeaders = []models.SiteHeader{
+	{Name: "Host", Value: "$host"},
+	{Name: "X-Real-IP", Value: "$remote_addr"},
+	{Name: "X-Forwarded-For", Value: "$proxy_add_x_forwarded_for"},
+	{Name: "X-Forwarded-Proto", Value: "$scheme"},
+}
+
+var upstreamNameRegex = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// ValidateSiteSpec 检查表单数据是否完整
+func ValidateSiteSpec(spec *models.SiteSpec) error {
+	if len(spec.Domains) == 0 {
+		return errors.New("至少需要一个域名")
+	}
+	if len(spec.Locations) == 0 {
+		return errors.New("至少需要一个 location")
+	}
+	for _, location := range spec.Locations {
+		if location.Path == "" {
+			return errors.New("location 路径不能为空")
+		}
+		if location.Pool != "" {
+			if pool := models.GetUpstreamPoolByName(location.Pool); pool.ID == 0 {
+				return fmt.Errorf("location %s 使用的服务器池 %s 不存在", location.Path, location.Pool)
+			}
+		} else if len(location.Upstreams) == 0 {
+			return fmt.Errorf("location %s 没有反代地址", location.Path)
+		} else if _, err := upstreamScheme(location.Upstreams); err != nil {
+			return fmt.Errorf("location %s 的%v", location.Path, err)
+		}
+	}
+	for _, redirect := range spec.Redirects {
+		if redirect.From == "" || redirect.To == "" {
+			return errors.New("跳转规则不完整")
+		}
+	}
+	return nil
+}
+
+// RenderSite 根据 SiteSpec 生成站点配置文件内容
+func RenderSite(fileName string, spec *models.SiteSpec) (string, error) {
+	if err := ValidateSiteSpec(spec); err != nil {
+		return "", err
+	}
+
+	conf := &nginxconf.Config{}
+	if siteUsesWebSocket(spec) {
+		conf.Append(nginxconf.NewBlock("map", []string{"$http_upgrade", "$connection_upgrade"},
+			nginxconf.NewDirective("default", "upgrade"),
+			nginxconf.NewDirective("", "close"),
+		))
+	}
+
+	// 多个后端地址时生成 upstream 块
+	proxyTargets := make([]string, len(spec.Locations))
+	for i, location := range spec.Locations {
+		if location.Pool != "" {
+			proxyTargets[i] = "http://" + location.Pool
+			continue
+		}
+		if len(location.Upstreams) == 1 {
+			proxyTargets[i] = location.Upstreams[0]
+			continue
+		}
+		// upstream 中的 server 不能带协议，后端使用 https 时由 proxy_pass 指定
+		scheme, _ := upstreamScheme(location.Upstreams)
+		name := siteUpstreamName(fileName, i)
+		upstream := nginxconf.NewBlock("upstream", []string{name})
+		for _, target := range location.Upstreams {
+			upstream.Append(nginxconf.NewDirective("server", stripScheme(target)))
+		}
+		conf.Append(upstream)
+		proxyTargets[i] = scheme + "://" + name
+	}
+
+	httpServer := nginxconf.NewBlock("server", nil,
+		nginxconf.NewDirective("listen", "80"),
+		nginxconf.NewDirective("listen", "[::]:80"),
+		nginxconf.NewDirective("server_name", spec.Domains...),
+	)
+
+	if spec.SSL {
+		certificate, key := siteCertificatePaths(fileName, spec)
+		httpsServer := nginxconf.NewBlock("server", nil,
+			nginxconf.NewDirective("listen", "443", "ssl", "http2"),
+			nginxconf.NewDirective("listen", "[::]:443", "ssl", "http2"),
+			nginxconf.NewDirective("server_name", spec.Domains...),
+			nginxconf.NewDirective("ssl_certificate", certificate),
+			nginxconf.NewDirective("ssl_certificate_key", key),
+		)
+		if spec.HSTS {
+			httpsServer.Append(nginxconf.NewDirective("add_header", "Strict-Transport-Security", "max-age=31536000; includeSubDomains", "always"))
+		}
+		if err := appendSiteBody(httpsServer, spec, proxyTargets); err != nil {
+			return "", err
+		}
+
+		if spec.ForceHTTPS {
+			httpServer.Append(
+				wellKnownLocation(),
+				nginxconf.NewBlock("location", []string{"/"},
+					nginxconf.NewDirective("return", "301", "https://$host$request_uri"),
+				),
+			)
+		} else if err := appendSiteBody(httpServer, spec, proxyTargets); err != nil {
+			return "", err
+		}
+		conf.Append(httpServer, httpsServer)
+	} else {
+		if err := appendSiteBody(httpServer, spec, proxyTargets); err != nil {
+			return "", err
+		}
+		conf.Append(httpServer)
+	}
+
+	// 维护模式开启时保留 server 块中的 include
+	if maintenance := models.GetMaintenanceByFilename(fileName); maintenance.Enabled {
+		for _, server := range conf.Find("server") {
+			server.Prepend(nginxconf.NewDirective("include", maintenanceIncludePath(fileName)))
+		}
+	}
+
+	return conf.String(), nil
+}
+
+// appendSiteBody 添加 server 块中的通用部分
+func appendSiteBody(server *nginxconf.Directive, spec *models.SiteSpec, proxyTargets []string) error {
+	if spec.ClientMaxBodySize != "" {
+		server.Append(nginxconf.NewDirective("client_max_body_size", spec.ClientMaxBodySize))
+	}
+
+	for _, redirect := range spec.Redirects {
+		code := redirect.Code
+		if code == 0 {
+			code = 301
+		}
+		server.Append(nginxconf.NewBlock("location", []string{"=", redirect.From},
+			nginxconf.NewDirective("return", strconv.Itoa(code), redirect.To),
+		))
+	}
+
+	for i, location := range spec.Locations {
+		block := nginxconf.NewBlock("location", []string{location.Path})
+		for _, header := range defaultProxyHeaders {
+			block.Append(nginxconf.NewDirective("proxy_set_header", header.Name, header.Value))
+		}
+		for _, header := range location.Headers {
+			block.Append(nginxconf.NewDirective("proxy_set_header", header.Name, header.Value))
+		}
+		block.Append(nginxconf.NewDirective("proxy_pass", proxyTargets[i]))
+		if location.WebSocket {
+			block.Append(
+				nginxconf.NewDirective("proxy_http_version", "1.1"),
+				nginxconf.NewDirective("proxy_set_header", "Upgrade", "$http_upgrade"),
+				nginxconf.NewDirective("proxy_set_header", "Connection", "$connection_upgrade"),
+			)
+		}
+		for _, timeout := range [][2]string{
+			{"proxy_connect_timeout", location.ConnectTimeout},
+			{"proxy_read_timeout", location.ReadTimeout},
+			{"proxy_send_timeout", location.SendTimeout},
+		} {
+			if timeout[1] != "" {
+				block.Append(nginxconf.NewDirective(timeout[0], timeout[1]))
+			}
+		}
+		if err := appendSnippet(block, location.Snippet); err != nil {
+			return fmt.Errorf("location %s: %v", location.Path, err)
+		}
+		server.Append(block)
+	}
+
+	server.Append(wellKnownLocation())
+	return appendSnippet(server, spec.Snippet)
+}
+
+// appendSnippet 解析自定义片段并添加到块中，片段必须是合法的 nginx 配置
+func appendSnippet(block *nginxconf.Directive, snippet string) error {
+	if strings.TrimSpace(snippet) == "" {
+		return nil
+	}
+	parsed, err := nginxconf.Parse("snippet", []byte(snippet))
+	if err != nil {
+		return fmt.Errorf("自定义片段错误: %v", err)
+	}
+	nginxconf.ResetFormatting(parsed.Nodes)
+	block.Append(parsed.Nodes...)
+	return nil
+}
+
+// wellKnownLocation 证书申请使用的 location
+func wellKnownLocation() *nginxconf.Directive {
+	return nginxconf.NewBlock("location", []string{"/.well-known"},
+		nginxconf.NewDirective("proxy_set_header", "Host", "$host"),
+		nginxconf.NewDirective("proxy_pass", "http://127.0.0.1:9999"),
+	)
+}
+
+func siteUsesWebSocket(spec *models.SiteSpec) bool {
+	for _, location := range spec.Locations {
+		if location.WebSocket {
+			return true
+		}
+	}
+	return false
+}
+
+// siteUpstreamName 站点内多个后端生成的 upstream 名称。upstream 名称在 http 块中全局唯一，
+// 文件名中的 _ 写成 __，其他字母数字以外的字符写成 _ 加两位十六进制，
+// 避免 a-b、a_b 和 a.b 这样的站点生成相同的名称
+func siteUpstreamName(fileName string, index int) string {
+	var name strings.Builder
+	for _, b := range []byte(fileName) {
+		switch {
+		case b == '_':
+			name.WriteString("__")
+		case b < 0x80 && !upstreamNameRegex.Match([]byte{b}):
+			name.WriteByte(b)
+		default:
+			fmt.Fprintf(&name, "_%02x", b)
+		}
+	}
+	return name.String() + "_" + strconv.Itoa(index)
+}
+
+// siteCertificatePaths 未指定证书路径时使用 uranus 管理的证书
+func siteCertificatePaths(fileName string, spec *models.SiteSpec) (string, string) {
+	certificate, key := spec.SSLCertificate, spec.SSLCertificateKey
+	sslPath := config.GetAppConfig().SSLPath
+	if certificate == "" {
+		certificate = filepath.Join(sslPath, fileName, "fullchain.cer")
+	}
+	if key == "" {
+		key = filepath.Join(sslPath, fileName, "private.key")
+	}
+	return certificate, key
+}
+
+// splitScheme 拆分反代地址的协议和地址，没有写协议时为 http
+func splitScheme(target string) (string, string) {
+	scheme := "http"
+	if index := strings.Index(target, "://"); index >= 0 {
+		scheme, target = strings.ToLower(target[:index]), target[index+3:]
+	}
+	return scheme, strings.TrimSuffix(target, "/")
+}
+
+func stripScheme(target string) string {
+	_, address := splitScheme(target)
+	return address
+}
+
+// upstreamScheme 多个反代地址合并为 upstream 后只能使用同一个协议
+func upstreamScheme(targets []string) (string, error) {
+	scheme := ""
+	for _, target := range targets {
+		current, _ := splitScheme(target)
+		if current != "http" && current != "https" {
+			if len(targets) > 1 {
+				return "", fmt.Errorf("反代地址 %s 使用了不支持的协议", target)
+			}
+			continue
+		}
+		if scheme != "" && scheme != current {
+			return "", errors.New("反代地址不能混用 http 和 https")
+		}
+		scheme = current
+	}
+	if scheme == "" {
+		scheme = "http"
+	}
+	return scheme, nil
+}
+
+// SpecFromConf 将手动编辑的配置转换为 SiteSpec，
+// 无法识别的指令放入自定义片段，无法表示的结构返回错误
+func SpecFromConf(fileName string, content []byte) (*models.SiteSpec, error) {
+	parsed, err := nginxconf.Parse(fileName, content)
+	if err != nil {
+		return nil, err
+	}
+
+	upstreams := map[string][]string{}
+	var httpServer, httpsServer *nginxconf.Directive
+	for _, node := range parsed.Nodes {
+		d, ok := node.(*nginxconf.Directive)
+		if !ok {
+			continue
+		}
+		switch {
+		case d.Name == "map" && d.Arg(1) == "$connection_upgrade":
+		case d.Name == "upstream" && d.IsBlock():
+			for _, server := range d.Find("server") {
+				upstreams[d.Arg(0)] = append(upstreams[d.Arg(0)], server.Arg(0))
+			}
+		case d.Name == "server" && d.IsBlock():
+			if isSSLServer(d) {
+				if httpsServer != nil {
+					return nil, unsupported(d, "多个 HTTPS server 块")
+				}
+				httpsServer = d
+			} else {
+				if httpServer != nil {
+					return nil, unsupported(d, "多个 HTTP server 块")
+				}
+				httpServer = d
+			}
+		default:
+			return nil, unsupported(d, "顶层指令 "+d.Name)
+		}
+	}
+	if httpServer == nil && httpsServer == nil {
+		return nil, errors.New("没有找到 server 块")
+	}
+
+	spec := &models.SiteSpec{}
+	body := httpServer
+	if httpsServer != nil {
+		spec.SSL = true
+		body = httpsServer
+		if httpServer == nil || redirectsToHTTPS(httpServer) {
+			spec.ForceHTTPS = true
+		}
+		if cert := httpsServer.FindOne("ssl_certificate"); cert != nil {
+			spec.SSLCertificate = cert.Arg(0)
+		}
+		if key := httpsServer.FindOne("ssl_certificate_key"); key != nil {
+			spec.SSLCertificateKey = key.Arg(0)
+		}
+		managedCert, managedKey := siteCertificatePaths(fileName, &models.SiteSpec{})
+		if spec.SSLCertificate == managedCert && spec.SSLCertificateKey == managedKey {
+			spec.SSLCertificate, spec.SSLCertificateKey = "", ""
+		}
+	}
+
+	var snippet []nginxconf.Node
+	for _, node := range body.Block {
+		d, ok := node.(*nginxconf.Directive)
+		if !ok {
+			continue
+		}
+		switch d.Name {
+		case "listen", "ssl_certificate", "ssl_certificate_key":
+		case "include":
+			if !isMaintenanceInclude(d) {
+				snippet = append(snippet, d)
+			}
+		case "server_name":
+			spec.Domains = append(spec.Domains, d.Args...)
+		case "client_max_body_size":
+			spec.ClientMaxBodySize = d.Arg(0)
+		case "add_header":
+			if strings.EqualFold(d.Arg(0), "Strict-Transport-Security") {
+				spec.HSTS = true
+			} else {
+				snippet = append(snippet, d)
+			}
+		case "rewrite":
+			// 模板中 HTTP 跳转 HTTPS 的写法
+			if !(httpsServer == nil && strings.HasPrefix(d.Arg(1), "https://")) {
+				snippet = append(snippet, d)
+			}
+		case "location":
+			if !d.IsBlock() {
+				return nil, unsupported(d, "location")
+			}
+			if isWellKnownLocation(d) {
+				continue
+			}
+			if redirect, ok := redirectFromLocation(d); ok {
+				spec.Redirects = append(spec.Redirects, redirect)
+				continue
+			}
+			location, err := locationFromConf(d, upstreams)
+			if err != nil {
+				return nil, err
+			}
+			spec.Locations = append(spec.Locations, location)
+		default:
+			snippet = append(snippet, d)
+		}
+	}
+	if len(snippet) > 0 {
+		spec.Snippet = nginxconf.Format(snippet)
+	}
+
+	if err := ValidateSiteSpec(spec); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// locationFromConf 从 location 块中读取反代设置
+func locationFromConf(d *nginxconf.Directive, upstreams map[string][]string) (models.SiteLocation, error) {
+	location := models.SiteLocation{Path: strings.Join(d.Args, " ")}
+	var snippet []nginxconf.Node
+
+	for _, node := range d.Block {
+		child, ok := node.(*nginxconf.Directive)
+		if !ok {
+			continue
+		}
+		switch child.Name {
+		case "proxy_pass":
+			target := child.Arg(0)
+			scheme, address := splitScheme(target)
+			if servers, ok := upstreams[address]; ok {
+				// upstream 中的 server 使用 proxy_pass 的协议
+				for _, server := range servers {
+					location.Upstreams = append(location.Upstreams, scheme+"://"+server)
+				}
+			} else if pool, ok := IsUpstreamPoolTarget(target); ok {
+				location.Pool = pool
+			} else {
+				location.Upstreams = append(location.Upstreams, target)
+			}
+		case "proxy_http_version":
+		case "proxy_set_header":
+			name, value := child.Arg(0), child.Arg(1)
+			switch {
+			case strings.EqualFold(name, "Upgrade") || strings.EqualFold(name, "Connection"):
+				location.WebSocket = true
+			case isDefaultProxyHeader(name):
+			default:
+				location.Headers = append(location.Headers, models.SiteHeader{Name: name, Value: value})
+			}
+		case "proxy_connect_timeout":
+			location.ConnectTimeout = child.Arg(0)
+		case "proxy_read_timeout":
+			location.ReadTimeout = child.Arg(0)
+		case "proxy_send_timeout":
+			location.SendTimeout = child.Arg(0)
+		default:
+			snippet = append(snippet, child)
+		}
+	}
+	if len(location.Upstreams) == 0 && location.Pool == "" {
+		return location, unsupported(d, "location "+location.Path+" 没有 proxy_pass")
+	}
+	if len(snippet) > 0 {
+		location.Snippet = nginxconf.Format(snippet)
+	}
+	return location, nil
+}
+
+// isDefaultProxyHeader 生成配置时会自动添加的请求头，包括旧模板中的写法
+func isDefaultProxyHeader(name string) bool {
+	switch strings.ToLower(name) {
+	case "host", "x-real-ip", "x-real_ip", "x-forwarded-for", "x-forwarded-proto":
+		return true
+	}
+	return false
+}
+
+func isSSLServer(server *nginxconf.Directive) bool {
+	for _, listen := range server.Find("listen") {
+		for i, arg := range listen.Args {
+			if i > 0 && arg == "ssl" {
+				return true
+			}
+		}
+	}
+	return server.FindOne("ssl_certificate") != nil
+}
+
+func isWellKnownLocation(d *nginxconf.Directive) bool {
+	if d.Arg(0) != "/.well-known" {
+		return false
+	}
+	proxy := d.FindOne("proxy_pass")
+	return proxy != nil && strings.HasSuffix(proxy.Arg(0), ":9999")
+}
+
+// redirectsToHTTPS 判断 HTTP server 是否只做 HTTPS 跳转
+func redirectsToHTTPS(server *nginxconf.Directive) bool {
+	for _, rewrite := range server.Find("rewrite") {
+		if strings.HasPrefix(rewrite.Arg(1), "https://") {
+			return true
+		}
+	}
+	for _, location := range server.Find("location") {
+		if location.Arg(0) != "/" {
+			continue
+		}
+		if ret := location.FindOne("return"); ret != nil && strings.HasPrefix(ret.Arg(1), "https://") {
+			return true
+		}
+	}
+	return false
+}
+
+// redirectFromLocation 识别 location = /from { return 301 /to; }
+func redirectFromLocation(d *nginxconf.Directive) (models.SiteRedirect, bool) {
+	if len(d.Args) != 2 || d.Args[0] != "=" || len(d.Block) != 1 {
+		return models.SiteRedirect{}, false
+	}
+	ret, ok := d.Block[0].(*nginxconf.Directive)
+	if !ok || ret.Name != "return" || len(ret.Args) != 2 {
+		return models.SiteRedirect{}, false
+	}
+	code, err := strconv.Atoi(ret.Arg(0))
+	if err != nil {
+		return models.SiteRedirect{}, false
+	}
+	return models.SiteRedirect{From: d.Args[1], To: ret.Args[1], Code: code}, true
+}
+
+func unsupported(d *nginxconf.Directive, what string) error {
+	return fmt.Errorf("第 %d 行: 表单模式不支持%s", d.Position.Line, what)
+}
+
+// SaveSiteSpec 生成并保存表单模式的站点配置
+func SaveSiteSpec(fileName string, spec *models.SiteSpec, author string, source string) (*NginxTestResult, string, error) {
+	content, err := RenderSite(fileName, spec)
+	if err != nil {
+		return nil, "", err
+	}
+
+	filePath := filepath.Join(config.GetAppConfig().VhostPath, fileName+".conf")
+	result, err := SaveConfFile(filePath, content, author, source)
+	if err != nil || !result.OK {
+		return result, content, err
+	}
+
+	site := models.GetSiteByFilename(fileName)
+	site.FileName = fileName
+	site.Mode = models.SiteModeForm
+	if err := site.SetSiteSpec(spec); err != nil {
+		return result, content, err
+	}
+	if err := models.GetDbClient().Save(&site).Error; err != nil {
+		return result, content, err
+	}
+
+	cert := models.GetCertByFilename(fileName)
+	cert.FileName = fileName
+	if parsed, err := nginxconf.Parse(filePath, []byte(content)); err == nil {
+		FillCertFromSiteInfo(&cert, filePath, content, nginxconf.Summarize(parsed))
+	}
+	models.GetDbClient().Save(&cert)
+	return result, content, nil
+}
+
+// SetSiteMode 切换站点编辑模式，切换到表单模式时配置文件必须能被完整识别
+func SetSiteMode(fileName string, mode string, content []byte) (*models.SiteSpec, error) {
+	site := models.GetSiteByFilename(fileName)
+	site.FileName = fileName
+
+	switch mode {
+	case models.SiteModeRaw:
+		site.Mode = models.SiteModeRaw
+	case models.SiteModeForm:
+		spec, err := SpecFromConf(fileName, content)
+		if err != nil {
+			return nil, err
+		}
+		site.Mode = models.SiteModeForm
+		if err := site.SetSiteSpec(spec); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("未知的编辑模式: " + mode)
+	}
+
+	if err := models.GetDbClient().Save(&site).Error; err != nil {
+		return nil, err
+	}
+	return site.GetSiteSpec()
+}
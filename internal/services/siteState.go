@@ -0,0 +1,85 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"uranus/internal/config"
+)
+
+// DisabledSitesDir 停用的站点配置移动到此目录，不在 nginx 的 include 路径中，
+// 证书和数据库记录保持不变
+func DisabledSitesDir() string {
+	return filepath.Join(config.GetAppConfig().InstallPath, "sites-disabled")
+}
+
+// siteConfFileName 统一为带 .conf 后缀的文件名
+func siteConfFileName(fileName string) string {
+	fileName = filepath.Base(fileName)
+	if !strings.HasSuffix(fileName, ".conf") {
+		fileName += ".conf"
+	}
+	return fileName
+}
+
+// IsSiteDisabled 判断站点是否已停用
+func IsSiteDisabled(fileName string) bool {
+	_, err := os.Stat(filepath.Join(DisabledSitesDir(), siteConfFileName(fileName)))
+	return err == nil
+}
+
+// DisabledSiteFiles 列出已停用站点的配置文件
+func DisabledSiteFiles() []os.FileInfo {
+	entries, err := os.ReadDir(DisabledSitesDir())
+	if err != nil {
+		return nil
+	}
+	var files []os.FileInfo
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".conf") {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			files = append(files, info)
+		}
+	}
+	return files
+}
+
+// DisableSite 停用站点: 将配置文件移出站点目录并重载 nginx
+func DisableSite(fileName string) (*NginxTestResult, error) {
+	return moveSiteFile(fileName, config.GetAppConfig().VhostPath, DisabledSitesDir())
+}
+
+// EnableSite 启用站点: 将配置文件移回站点目录，nginx -t 检测通过后重载
+func EnableSite(fileName string) (*NginxTestResult, error) {
+	return moveSiteFile(fileName, DisabledSitesDir(), config.GetAppConfig().VhostPath)
+}
+
+func moveSiteFile(fileName string, fromDir string, toDir string) (*NginxTestResult, error) {
+	name := siteConfFileName(fileName)
+	if name == "default.conf" || IsUranusConfFile(name) {
+		return nil, errors.New("不能停用该配置")
+	}
+
+	from := filepath.Join(fromDir, name)
+	to := filepath.Join(toDir, name)
+	content, err := os.ReadFile(from)
+	if err != nil {
+		return nil, errors.New("未找到配置文件: " + from)
+	}
+	if _, err := os.Stat(to); err == nil {
+		return nil, errors.New("目标文件已存在: " + to)
+	}
+
+	result, err := ApplyNginxFiles(map[string][]byte{
+		from: nil,
+		to:   content,
+	})
+	if err == nil && result.OK {
+		log.Printf("[SITES] Moved %s to %s", from, to)
+	}
+	return result, err
+}
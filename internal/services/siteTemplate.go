@@ -0,0 +1,386 @@
+package services
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+	"uranus/internal/config"
+	"uranus/internal/models"
+	"uranus/internal/nginxconf"
+)
+
+//go:embed template/*.conf template/partials.tmpl
+var templateFS embed.FS
+
+// 模板参数类型
+const (
+	TemplateInputDomains = "domains" // 域名列表，对应 .Domains / .Domain
+	TemplateInputURL     = "url"     // 带协议的地址，如 http://localhost:3000
+	TemplateInputAddress = "address" // host:port 或 unix:/path
+	TemplateInputPath    = "path"    // 绝对路径
+	TemplateInputPort    = "port"
+	TemplateInputSelect  = "select"
+	TemplateInputBool    = "bool"
+	TemplateInputText    = "text"
+)
+
+// SiteTemplate 新建站点时可以选择的配置模板
+type SiteTemplate struct {
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Stream      bool                   `json:"stream"` // TCP/UDP 代理，配置写入 StreamDir
+	Inputs      []models.TemplateInput `json:"inputs"`
+	Content     string                 `json:"content"`
+	SSLContent  string                 `json:"sslContent,omitempty"` // 为空时使用 Content，模板中通过 .SSL 判断
+	BuiltIn     bool                   `json:"builtIn"`              // 内置模板只读
+	Version     int                    `json:"version"`
+}
+
+// TemplateData 渲染模板时可以使用的数据
+type TemplateData struct {
+	ConfigName string
+	Domains    []string
+	Domain     string // 空格分隔的域名，用于 server_name
+	Proxy      string
+	SSL        bool
+	SSLPath    string
+	CertDir    string // 证书所在目录，默认 SSLPath/ConfigName，使用共享证书时为共享证书目录
+	Params     map[string]string
+}
+
+// DefaultSiteTemplate 未指定模板时使用的反向代理模板
+const DefaultSiteTemplate = "proxy"
+
+var domainsInput = models.TemplateInput{Name: "domains", Label: "域名", Type: TemplateInputDomains, Required: true}
+
+func rootInput(placeholder string) models.TemplateInput {
+	return models.TemplateInput{Name: "root", Label: "网站目录", Type: TemplateInputPath, Default: "/var/www/html", Placeholder: placeholder, Required: true}
+}
+
+var builtinTemplates = []SiteTemplate{
+	{
+		ID:          "proxy",
+		BuiltIn:     true,
+		Name:        "反向代理",
+		Description: "反向代理到后端服务，支持 websocket",
+		Inputs: []models.TemplateInput{
+			domainsInput,
+			{Name: "proxy", Label: "反代地址", Type: TemplateInputURL, Default: "http://localhost:3000", Required: true},
+		},
+		Content:    mustReadTemplate("http.conf"),
+		SSLContent: mustReadTemplate("https.conf"),
+	},
+	{
+		ID:          "static",
+		BuiltIn:     true,
+		Name:        "静态网站",
+		Description: "直接提供目录中的静态文件",
+		Inputs: []models.TemplateInput{
+			domainsInput,
+			rootInput("/var/www/example"),
+			{Name: "index", Label: "首页文件", Type: TemplateInputText, Default: "index.html index.htm", Required: true},
+		},
+		Content: mustReadTemplate("static.conf"),
+	},
+	{
+		ID:          "php",
+		BuiltIn:     true,
+		Name:        "PHP-FPM",
+		Description: "通过 fastcgi 把 .php 请求交给 PHP-FPM 处理",
+		Inputs: []models.TemplateInput{
+			domainsInput,
+			rootInput("/var/www/example"),
+			{Name: "fastcgi", Label: "PHP-FPM 地址", Type: TemplateInputAddress, Default: "unix:/run/php/php-fpm.sock", Placeholder: "127.0.0.1:9000", Required: true},
+			{Name: "index", Label: "首页文件", Type: TemplateInputText, Default: "index.php index.html", Required: true},
+		},
+		Content: mustReadTemplate("php.conf"),
+	},
+	{
+		ID:          "redirect",
+		BuiltIn:     true,
+		Name:        "域名跳转",
+		Description: "把所有请求永久跳转到另一个域名",
+		Inputs: []models.TemplateInput{
+			domainsInput,
+			{Name: "target", Label: "跳转地址", Type: TemplateInputURL, Placeholder: "https://example.com", Required: true},
+			{Name: "code", Label: "状态码", Type: TemplateInputSelect, Default: "301", Options: []string{"301", "308", "302", "307"}, Required: true},
+			{Name: "keepPath", Label: "保留请求路径", Type: TemplateInputBool, Default: "true"},
+		},
+		Content: mustReadTemplate("redirect.conf"),
+	},
+	{
+		ID:          "spa",
+		BuiltIn:     true,
+		Name:        "单页应用",
+		Description: "前端路由找不到文件时返回 index.html，可选把 API 路径反代到后端",
+		Inputs: []models.TemplateInput{
+			domainsInput,
+			rootInput("/var/www/example/dist"),
+			{Name: "apiPath", Label: "API 路径", Type: TemplateInputPath, Placeholder: "/api/"},
+			{Name: "proxy", Label: "API 反代地址", Type: TemplateInputURL, Placeholder: "http://localhost:3000"},
+		},
+		Content: mustReadTemplate("spa.conf"),
+	},
+	{
+		ID:          "grpc",
+		BuiltIn:     true,
+		Name:        "gRPC 代理",
+		Description: "通过 HTTP/2 代理 gRPC 服务，建议申请证书后使用",
+		Inputs: []models.TemplateInput{
+			domainsInput,
+			{Name: "backend", Label: "gRPC 地址", Type: TemplateInputURL, Default: "grpc://127.0.0.1:50051", Required: true},
+			{Name: "timeout", Label: "超时时间", Type: TemplateInputText, Default: "300s", Required: true},
+		},
+		Content: mustReadTemplate("grpc.conf"),
+	},
+	{
+		ID:          "stream",
+		BuiltIn:     true,
+		Name:        "TCP/UDP 代理",
+		Description: "nginx stream 模块的四层代理，配置放在单独的 stream 目录中",
+		Stream:      true,
+		Inputs: []models.TemplateInput{
+			{Name: "port", Label: "监听端口", Type: TemplateInputPort, Required: true},
+			{Name: "protocol", Label: "协议", Type: TemplateInputSelect, Default: "tcp", Options: []string{"tcp", "udp", "tcp+udp"}, Required: true},
+			{Name: "backend", Label: "后端地址", Type: TemplateInputAddress, Placeholder: "127.0.0.1:3306", Required: true},
+			{Name: "timeout", Label: "空闲超时", Type: TemplateInputText, Default: "10m", Required: true},
+		},
+		Content: mustReadTemplate("stream.conf"),
+	},
+}
+
+var templatePartials = mustReadTemplate("partials.tmpl")
+
+func mustReadTemplate(name string) string {
+	content, err := templateFS.ReadFile("template/" + name)
+	if err != nil {
+		panic(err)
+	}
+	return string(content)
+}
+
+// SiteTemplates 返回模板目录: 内置模板在前，自定义模板在后
+func SiteTemplates() []SiteTemplate {
+	templates := append([]SiteTemplate{}, builtinTemplates...)
+	for _, custom := range models.GetCustomTemplates() {
+		templates = append(templates, customSiteTemplate(&custom))
+	}
+	return templates
+}
+
+// GetSiteTemplate 根据 ID 查找内置或自定义模板
+func GetSiteTemplate(id string) (*SiteTemplate, error) {
+	if id == "" {
+		id = DefaultSiteTemplate
+	}
+	for i := range builtinTemplates {
+		if builtinTemplates[i].ID == id {
+			return &builtinTemplates[i], nil
+		}
+	}
+	if custom := models.GetCustomTemplateBySlug(id); custom.ID != 0 {
+		t := customSiteTemplate(&custom)
+		return &t, nil
+	}
+	return nil, fmt.Errorf("未找到模板 %s", id)
+}
+
+// isBuiltinTemplate 判断 ID 是否为内置模板
+func isBuiltinTemplate(id string) bool {
+	for _, t := range builtinTemplates {
+		if t.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSiteTemplate 解析模板内容，模板中可以使用 partials.tmpl 中定义的 server 和 acme 片段
+func parseSiteTemplate(id string, content string) (*template.Template, error) {
+	tmpl, err := template.New("partials").Option("missingkey=zero").Parse(templatePartials)
+	if err == nil {
+		tmpl, err = tmpl.New(id).Parse(content)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("模板 %s 语法错误: %v", id, err)
+	}
+	return tmpl, nil
+}
+
+// Render 校验参数并生成配置文件内容
+func (t *SiteTemplate) Render(data TemplateData) (string, error) {
+	if t.Stream {
+		data.SSL = false
+	}
+	if data.Params == nil {
+		data.Params = map[string]string{}
+	}
+	data.SSLPath = config.GetAppConfig().SSLPath
+	if data.CertDir == "" {
+		data.CertDir = path.Join(data.SSLPath, data.ConfigName)
+	}
+	data.Domain = strings.Join(data.Domains, " ")
+
+	for _, input := range t.Inputs {
+		value := templateInputValue(input, &data)
+		if err := validateTemplateInput(input, value, data.Domains); err != nil {
+			return "", err
+		}
+		if input.Type == TemplateInputBool && value != "" {
+			enabled, _ := strconv.ParseBool(value)
+			data.Params[input.Name] = strconv.FormatBool(enabled)
+		}
+	}
+
+	content := t.Content
+	if data.SSL && t.SSLContent != "" {
+		content = t.SSLContent
+	}
+	tmpl, err := parseSiteTemplate(t.ID, content)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("生成配置出错: %v", err)
+	}
+
+	// 只检查语法，完整的检测在保存时由 nginx -t 完成
+	if _, err := nginxconf.Parse(data.ConfigName+".conf", out.Bytes()); err != nil {
+		return "", fmt.Errorf("生成的配置无法解析: %v", err)
+	}
+	return out.String(), nil
+}
+
+// Preview 使用示例参数生成配置，用于编辑模板时检查效果
+func (t *SiteTemplate) Preview(ssl bool) (string, error) {
+	data := TemplateData{ConfigName: "example", SSL: ssl, Params: map[string]string{}}
+	for _, input := range t.Inputs {
+		value := input.Default
+		if value == "" {
+			value = input.Placeholder
+		}
+		if value == "" {
+			value = templateInputSample(input)
+		}
+		switch input.Name {
+		case "domains":
+			data.Domains = strings.Fields(strings.ReplaceAll(value, ",", " "))
+		case "proxy":
+			data.Proxy = value
+		default:
+			data.Params[input.Name] = value
+		}
+	}
+	return t.Render(data)
+}
+
+// templateInputSample 没有默认值时按类型给出示例值
+func templateInputSample(input models.TemplateInput) string {
+	switch input.Type {
+	case TemplateInputDomains:
+		return "example.com"
+	case TemplateInputURL:
+		return "http://127.0.0.1:3000"
+	case TemplateInputAddress:
+		return "127.0.0.1:3000"
+	case TemplateInputPath:
+		return "/var/www/html"
+	case TemplateInputPort:
+		return "8080"
+	case TemplateInputSelect:
+		if len(input.Options) > 0 {
+			return input.Options[0]
+		}
+	case TemplateInputBool:
+		return "false"
+	case TemplateInputText:
+		return "example"
+	}
+	return ""
+}
+
+// templateInputValue 取出参数的值，未填写时使用默认值
+func templateInputValue(input models.TemplateInput, data *TemplateData) string {
+	switch input.Name {
+	case "domains":
+		return strings.Join(data.Domains, " ")
+	case "proxy":
+		if data.Proxy == "" {
+			data.Proxy = input.Default
+		}
+		return data.Proxy
+	}
+	value := strings.TrimSpace(data.Params[input.Name])
+	if value == "" {
+		value = input.Default
+	}
+	data.Params[input.Name] = value
+	return value
+}
+
+func validateTemplateInput(input models.TemplateInput, value string, domains []string) error {
+	if value == "" {
+		if input.Required {
+			return fmt.Errorf("请填写%s", input.Label)
+		}
+		return nil
+	}
+	// 参数直接写入配置文件，不允许出现能结束指令或块的字符
+	if strings.ContainsAny(value, ";{}#\"'\r\n") {
+		return fmt.Errorf("%s 包含非法字符", input.Label)
+	}
+
+	invalid := fmt.Errorf("%s 格式不正确: %s", input.Label, value)
+	switch input.Type {
+	case TemplateInputDomains:
+		for _, domain := range domains {
+			if domain == "" || strings.ContainsAny(domain, " \t/") {
+				return fmt.Errorf("域名 %q 格式不正确", domain)
+			}
+		}
+	case TemplateInputURL:
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			return invalid
+		}
+	case TemplateInputAddress:
+		if strings.HasPrefix(value, "unix:/") {
+			return nil
+		}
+		if _, port, err := net.SplitHostPort(value); err != nil || !validPort(port) {
+			return invalid
+		}
+	case TemplateInputPath:
+		if !path.IsAbs(value) || strings.ContainsAny(value, " \t") {
+			return invalid
+		}
+	case TemplateInputPort:
+		if !validPort(value) {
+			return invalid
+		}
+	case TemplateInputSelect:
+		for _, option := range input.Options {
+			if value == option {
+				return nil
+			}
+		}
+		return invalid
+	case TemplateInputBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return invalid
+		}
+	}
+	return nil
+}
+
+func validPort(value string) bool {
+	port, err := strconv.Atoi(value)
+	return err == nil && port > 0 && port < 65536
+}
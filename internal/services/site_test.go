@@ -0,0 +1,30 @@
+package services
+
+import "testing"
+
+func TestSiteUpstreamName(t *testing.T) {
+	tests := []struct {
+		fileName string
+		index    int
+		want     string
+	}{
+		{"example", 0, "example_0"},
+		{"a_b", 1, "a__b_1"},
+		{"a-b", 1, "a_2db_1"},
+		{"a.b", 1, "a_2eb_1"},
+		{"api.example.com", 2, "api_2eexample_2ecom_2"},
+	}
+	seen := map[string]string{}
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			got := siteUpstreamName(tt.fileName, tt.index)
+			if got != tt.want {
+				t.Errorf("siteUpstreamName(%q, %d) = %s, want %s", tt.fileName, tt.index, got, tt.want)
+			}
+			if other, ok := seen[got]; ok {
+				t.Errorf("%q and %q both use upstream %s", tt.fileName, other, got)
+			}
+			seen[got] = tt.fileName
+		})
+	}
+}
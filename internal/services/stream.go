@@ -0,0 +1,144 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"uranus/internal/config"
+	"uranus/internal/nginxconf"
+)
+
+// ErrStreamUnsupported nginx 没有编译 stream 模块
+var ErrStreamUnsupported = errors.New("当前 nginx 没有编译 stream 模块 (--with-stream)，无法使用 TCP/UDP 代理")
+
+// StreamDir TCP/UDP 代理的配置目录，由 nginx.conf 中的 stream 块 include，
+// 不能放在 http 层 include 的站点目录中
+func StreamDir() string {
+	return filepath.Join(config.GetAppConfig().InstallPath, "streams")
+}
+
+// IsStreamSite 判断站点是否为 TCP/UDP 代理
+func IsStreamSite(fileName string) bool {
+	_, err := os.Stat(filepath.Join(StreamDir(), siteConfFileName(fileName)))
+	return err == nil
+}
+
+// StreamSiteFiles 列出 TCP/UDP 代理的配置文件
+func StreamSiteFiles() []os.FileInfo {
+	entries, err := os.ReadDir(StreamDir())
+	if err != nil {
+		return nil
+	}
+	var files []os.FileInfo
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".conf") {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			files = append(files, info)
+		}
+	}
+	return files
+}
+
+// SiteConfPath 返回站点配置文件的路径，TCP/UDP 代理位于 StreamDir，
+// 从 sites-enabled 导入的站点使用原来的文件
+func SiteConfPath(fileName string) string {
+	name := siteConfFileName(fileName)
+	if IsStreamSite(name) {
+		return filepath.Join(StreamDir(), name)
+	}
+	if path := ImportedSitePath(name); path != "" {
+		return path
+	}
+	return filepath.Join(config.GetAppConfig().VhostPath, name)
+}
+
+// streamSupported 根据 nginx -V 判断是否编译了 stream 模块，无法获取编译参数时交给 nginx -t 判断
+func streamSupported() bool {
+	nci := config.ReadNginxCompileInfo()
+	if nci == nil || len(nci.Params) == 0 {
+		return true
+	}
+	for _, param := range nci.Params {
+		if strings.HasPrefix(strings.TrimSpace(param), "with-stream") {
+			return true
+		}
+	}
+	return false
+}
+
+// streamIncludeConf 在 nginx.conf 中添加 include StreamDir 的 stream 块，已存在时返回 nil
+func streamIncludeConf() ([]byte, error) {
+	path := NginxConfFile()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := nginxconf.Parse(path, content)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := filepath.Join(StreamDir(), "*.conf")
+	streams := parsed.Find("stream")
+	for _, stream := range streams {
+		for _, include := range stream.Find("include") {
+			if include.Arg(0) == pattern {
+				return nil, nil
+			}
+		}
+	}
+
+	include := nginxconf.NewDirective("include", pattern)
+	if len(streams) > 0 {
+		streams[0].Append(include)
+	} else {
+		parsed.Append(
+			nginxconf.NewComment(" TCP/UDP 代理，由 uranus 管理"),
+			nginxconf.NewBlock("stream", nil, include),
+		)
+	}
+	return parsed.Bytes(), nil
+}
+
+// SaveStreamSite 保存 TCP/UDP 代理配置，需要时同时在 nginx.conf 中添加 stream 块，
+// 两个文件一起通过 nginx -t 检测
+func SaveStreamSite(fileName string, content string, author string, source string) (*NginxTestResult, error) {
+	if !streamSupported() {
+		return nil, ErrStreamUnsupported
+	}
+	name := siteConfFileName(fileName)
+	if _, err := os.Stat(filepath.Join(config.GetAppConfig().VhostPath, name)); err == nil {
+		return nil, errors.New("已存在同名的网站配置: " + name)
+	}
+	if err := os.MkdirAll(StreamDir(), 0755); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(StreamDir(), name)
+	files := map[string][]byte{path: []byte(content)}
+	nginxConf, err := streamIncludeConf()
+	if err != nil {
+		return nil, err
+	}
+	if nginxConf != nil {
+		files[NginxConfFile()] = nginxConf
+	}
+
+	previous, _ := os.ReadFile(path)
+	previousNginxConf, _ := os.ReadFile(NginxConfFile())
+	result, err := ApplyNginxFiles(files)
+	if err != nil || !result.OK {
+		return result, err
+	}
+
+	RecordRevision(path, string(previous), content, author, source)
+	if nginxConf != nil {
+		log.Printf("[STREAM] Added stream include to %s", NginxConfFile())
+		RecordRevision(NginxConfFile(), string(previousNginxConf), string(nginxConf), author, source)
+	}
+	return result, nil
+}
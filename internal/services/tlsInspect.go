@@ -0,0 +1,359 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-acme/lego/v4/certcrypto"
+	"golang.org/x/crypto/ocsp"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"uranus/internal/models"
+)
+
+const (
+	// 定期检查 nginx 实际返回的证书
+	tlsInspectInterval = 10 * time.Minute
+	tlsDialTimeout     = 5 * time.Second
+	// 没有配置 listen 地址时连接本机 nginx
+	defaultTLSAddress = "127.0.0.1:443"
+)
+
+// 证书漂移类型: nginx 返回的证书与磁盘上的证书不一致
+const (
+	DriftStale    = "stale"    // 磁盘上已经是新证书，nginx 还没有 reload
+	DriftMismatch = "mismatch" // 返回的证书不是站点配置的证书或不包含域名
+	DriftExpired  = "expired"  // 返回的证书已经过期
+)
+
+// TLSChainCert 握手时返回的证书链中的一个证书
+type TLSChainCert struct {
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	Serial      string    `json:"serial"`
+	DNSNames    []string  `json:"dnsNames"`
+	NotBefore   time.Time `json:"notBefore"`
+	NotAfter    time.Time `json:"notAfter"`
+	Fingerprint string    `json:"fingerprint"` // SHA-256
+}
+
+// TLSInspection 使用 SNI 连接 nginx 后得到的握手信息，以及与磁盘证书的比较结果
+type TLSInspection struct {
+	Domain     string         `json:"domain"`
+	Address    string         `json:"address"`
+	ConfigName string         `json:"configName"`
+	CheckedAt  time.Time      `json:"checkedAt"`
+	Error      string         `json:"error"`
+	Protocol   string         `json:"protocol"`
+	Cipher     string         `json:"cipher"`
+	ALPN       string         `json:"alpn"`
+	Chain      []TLSChainCert `json:"chain"`
+	// 证书链是否被系统或内部 CA 信任
+	Trusted     bool   `json:"trusted"`
+	TrustError  string `json:"trustError"`
+	OCSPStapled bool   `json:"ocspStapled"`
+	// good、revoked、unknown 或 invalid，没有 OCSP 装订时为空
+	OCSPStatus     string     `json:"ocspStatus"`
+	OCSPNextUpdate *time.Time `json:"ocspNextUpdate"`
+	// 磁盘上的证书，站点配置中 ssl_certificate 指向的文件
+	DiskCertificate string     `json:"diskCertificate"`
+	DiskSerial      string     `json:"diskSerial"`
+	DiskNotAfter    *time.Time `json:"diskNotAfter"`
+	Drift           string     `json:"drift"`
+	DriftMessage    string     `json:"driftMessage"`
+}
+
+type tlsInspectState struct {
+	mutex   sync.Mutex
+	results map[string]TLSInspection // key: 站点名/域名
+	handler func(TLSInspection)
+}
+
+var tlsInspector = &tlsInspectState{results: map[string]TLSInspection{}}
+
+// SetTLSDriftHandler 设置证书漂移的告警处理，例如通过 MQTT 通知控制中心
+func SetTLSDriftHandler(handler func(TLSInspection)) {
+	tlsInspector.mutex.Lock()
+	defer tlsInspector.mutex.Unlock()
+	tlsInspector.handler = handler
+}
+
+func chainCert(certificate *x509.Certificate) TLSChainCert {
+	sum := sha256.Sum256(certificate.Raw)
+	return TLSChainCert{
+		Subject:     certificate.Subject.CommonName,
+		Issuer:      certificate.Issuer.CommonName,
+		Serial:      certSerial(certificate.SerialNumber.Bytes()),
+		DNSNames:    certificate.DNSNames,
+		NotBefore:   certificate.NotBefore,
+		NotAfter:    certificate.NotAfter,
+		Fingerprint: strings.ToUpper(hex.EncodeToString(sum[:])),
+	}
+}
+
+// InspectTLS 使用 SNI 连接 address，记录协议、加密套件、证书链和 OCSP 装订，
+// address 为空时连接本机 443 端口
+func InspectTLS(domain string, address string) TLSInspection {
+	result, _ := inspectTLS(domain, address)
+	return result
+}
+
+// inspectTLS 返回检查结果和 nginx 返回的叶子证书，握手失败时证书为 nil
+func inspectTLS(domain string, address string) (TLSInspection, *x509.Certificate) {
+	if address == "" {
+		address = defaultTLSAddress
+	}
+	result := TLSInspection{Domain: domain, Address: address, CheckedAt: time.Now()}
+	if domain == "" {
+		result.Error = "请填写域名"
+		return result, nil
+	}
+
+	// 只获取证书链，信任和域名在握手后单独检查，证书有问题时也能看到返回了什么
+	dialer := &net.Dialer{Timeout: tlsDialTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", address, &tls.Config{
+		ServerName:         domain,
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h2", "http/1.1"},
+	})
+	if err != nil {
+		result.Error = fmt.Sprintf("TLS 握手失败: %v", err)
+		return result, nil
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	result.Protocol = tls.VersionName(state.Version)
+	result.Cipher = tls.CipherSuiteName(state.CipherSuite)
+	result.ALPN = state.NegotiatedProtocol
+	if len(state.PeerCertificates) == 0 {
+		result.Error = "服务器没有返回证书"
+		return result, nil
+	}
+	for _, certificate := range state.PeerCertificates {
+		result.Chain = append(result.Chain, chainCert(certificate))
+	}
+
+	leaf := state.PeerCertificates[0]
+	options := x509.VerifyOptions{DNSName: domain, Intermediates: x509.NewCertPool()}
+	for _, certificate := range state.PeerCertificates[1:] {
+		options.Intermediates.AddCert(certificate)
+	}
+	// 内部 CA 签发的证书使用内部根证书验证
+	if root, _, err := loadInternalCA(); err == nil {
+		if pool, err := x509.SystemCertPool(); err == nil && pool != nil {
+			pool.AddCert(root)
+			options.Roots = pool
+		}
+	}
+	if _, err := leaf.Verify(options); err != nil {
+		result.TrustError = err.Error()
+	} else {
+		result.Trusted = true
+	}
+
+	if len(state.OCSPResponse) > 0 {
+		result.OCSPStapled = true
+		var issuer *x509.Certificate
+		if len(state.PeerCertificates) > 1 {
+			issuer = state.PeerCertificates[1]
+		}
+		response, err := ocsp.ParseResponseForCert(state.OCSPResponse, leaf, issuer)
+		switch {
+		case err != nil:
+			result.OCSPStatus = "invalid"
+		case response.Status == ocsp.Good:
+			result.OCSPStatus = "good"
+		case response.Status == ocsp.Revoked:
+			result.OCSPStatus = "revoked"
+		default:
+			result.OCSPStatus = "unknown"
+		}
+		if err == nil && !response.NextUpdate.IsZero() {
+			result.OCSPNextUpdate = &response.NextUpdate
+		}
+	}
+	return result, leaf
+}
+
+// compareWithDisk 比较 nginx 返回的证书和磁盘上的证书，设置 Drift
+func compareWithDisk(result *TLSInspection, certFile string, served *x509.Certificate) {
+	result.DiskCertificate = certFile
+	switch {
+	case time.Now().After(served.NotAfter):
+		result.Drift = DriftExpired
+		result.DriftMessage = fmt.Sprintf("返回的证书已于 %s 过期", served.NotAfter.Format("2006-01-02"))
+	case served.VerifyHostname(result.Domain) != nil:
+		result.Drift = DriftMismatch
+		result.DriftMessage = fmt.Sprintf("返回的证书 (%s) 不包含域名 %s", served.Subject.CommonName, result.Domain)
+	}
+
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return
+	}
+	disk, err := certcrypto.ParsePEMCertificate(data)
+	if err != nil {
+		return
+	}
+	result.DiskSerial = certSerial(disk.SerialNumber.Bytes())
+	result.DiskNotAfter = &disk.NotAfter
+	if bytes.Equal(disk.Raw, served.Raw) {
+		return
+	}
+	if disk.NotAfter.After(served.NotAfter) {
+		result.Drift = DriftStale
+		result.DriftMessage = fmt.Sprintf("磁盘上的证书 %s 到期，nginx 仍在使用 %s 到期的旧证书，需要 reload",
+			disk.NotAfter.Format("2006-01-02"), served.NotAfter.Format("2006-01-02"))
+		return
+	}
+	if result.Drift == "" {
+		result.Drift = DriftMismatch
+		result.DriftMessage = fmt.Sprintf("返回的证书 (序列号 %s) 与 %s 不一致", certSerial(served.SerialNumber.Bytes()), certFile)
+	}
+}
+
+// tlsAddressFromListen 从站点的 listen 配置中找到 HTTPS 端口，通配地址连接本机
+func tlsAddressFromListen(listen string) string {
+	for _, item := range strings.Split(listen, ",") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+		ssl := false
+		for _, field := range fields[1:] {
+			if field == "ssl" {
+				ssl = true
+			}
+		}
+		if !ssl {
+			continue
+		}
+		host, port, err := net.SplitHostPort(fields[0])
+		if err != nil {
+			host, port = "", fields[0]
+		}
+		if host == "" || host == "*" || host == "0.0.0.0" || host == "[::]" || host == "::" {
+			host = "127.0.0.1"
+		}
+		return net.JoinHostPort(strings.Trim(host, "[]"), port)
+	}
+	return defaultTLSAddress
+}
+
+// SiteTLSAddress 检查站点证书时连接的地址
+func SiteTLSAddress(cert *models.Cert) string {
+	return tlsAddressFromListen(cert.Listen)
+}
+
+// inspectableDomain 通配符、正则和默认 server_name 无法通过 SNI 检查
+func inspectableDomain(domain string) bool {
+	return domain != "" && domain != "_" && domain != "localhost" &&
+		!strings.ContainsAny(domain, "*~")
+}
+
+// InspectSite 检查站点的每个域名，并与 ssl_certificate 指向的证书比较
+func InspectSite(cert *models.Cert) []TLSInspection {
+	var results []TLSInspection
+	address := SiteTLSAddress(cert)
+	for _, domain := range strings.Split(cert.Domains, ",") {
+		domain = strings.TrimSpace(domain)
+		if !inspectableDomain(domain) {
+			continue
+		}
+		result, served := inspectTLS(domain, address)
+		result.ConfigName = cert.FileName
+		if served != nil {
+			compareWithDisk(&result, cert.SSLCertificate, served)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// StartTLSInspection 定期检查所有启用 HTTPS 的站点，发现证书漂移时告警
+func StartTLSInspection(ctx context.Context) {
+	// 启动两分钟后第一次检查，等待 nginx 和站点导入完成
+	timer := time.NewTimer(2 * time.Minute)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			InspectAllSites()
+			timer.Reset(tlsInspectInterval)
+		}
+	}
+}
+
+// InspectAllSites 立即检查所有启用 HTTPS 的站点，返回最新结果
+func InspectAllSites() []TLSInspection {
+	results := map[string]TLSInspection{}
+	for _, cert := range models.GetCertificates() {
+		cert := cert
+		if cert.Shared || cert.SSLCertificate == "" || IsSiteDisabled(cert.FileName) {
+			continue
+		}
+		for _, result := range InspectSite(&cert) {
+			results[result.ConfigName+"/"+result.Domain] = result
+		}
+	}
+
+	tlsInspector.mutex.Lock()
+	previous := tlsInspector.results
+	tlsInspector.results = results
+	handler := tlsInspector.handler
+	tlsInspector.mutex.Unlock()
+
+	// 只在出现新的漂移或漂移类型变化时告警，避免每次检查都重复告警
+	for key, result := range results {
+		if result.Drift == "" {
+			if previous[key].Drift != "" {
+				log.Printf("[TLS] Certificate drift of %s (%s) resolved", result.Domain, result.ConfigName)
+			}
+			continue
+		}
+		if previous[key].Drift == result.Drift {
+			continue
+		}
+		log.Printf("[TLS] Certificate drift of %s (%s): %s", result.Domain, result.ConfigName, result.DriftMessage)
+		if handler != nil {
+			handler(result)
+		}
+	}
+	return GetTLSInspections()
+}
+
+// GetTLSInspections 最近一次检查的结果，有漂移和连接失败的排在前面
+func GetTLSInspections() []TLSInspection {
+	tlsInspector.mutex.Lock()
+	defer tlsInspector.mutex.Unlock()
+	results := make([]TLSInspection, 0, len(tlsInspector.results))
+	for _, result := range tlsInspector.results {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if (a.Drift != "") != (b.Drift != "") {
+			return a.Drift != ""
+		}
+		if (a.Error != "") != (b.Error != "") {
+			return a.Error != ""
+		}
+		if a.ConfigName != b.ConfigName {
+			return a.ConfigName < b.ConfigName
+		}
+		return a.Domain < b.Domain
+	})
+	return results
+}
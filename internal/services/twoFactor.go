@@ -0,0 +1,339 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+	"uranus/internal/config"
+	"uranus/internal/models"
+)
+
+const (
+	// RFC 6238 默认参数，常见的验证器应用都支持
+	totpPeriod = 30
+	totpDigits = 6
+	// 允许前后各一个时间步的时钟误差
+	totpSkew          = 1
+	totpIssuer        = "Uranus"
+	recoveryCodeCount = 10
+	// TrustedDeviceDuration 记住设备的有效期
+	TrustedDeviceDuration = 30 * 24 * time.Hour
+	// 验证码连续错误这么多次后锁定一段时间
+	maxSecondFactorFailures = 5
+	secondFactorLockout     = 15 * time.Minute
+)
+
+// ErrSecondFactorLocked 验证码错误次数过多，暂时不能登录
+var ErrSecondFactorLocked = errors.New("验证失败次数过多，请稍后再试")
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TwoFactorRequired 配置要求所有用户启用两步验证
+func TwoFactorRequired() bool {
+	return config.GetAppConfig().Require2FA
+}
+
+// totpCode 计算某个时间步的验证码 (RFC 4226 HOTP，HMAC-SHA1)
+func totpCode(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// verifyTOTP 检查验证码，返回匹配的时间步。lastStep 之前 (含) 的验证码已经用过
+func verifyTOTP(secret []byte, code string, now time.Time, lastStep int64) (int64, bool) {
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpURI 验证器应用扫描的 otpauth:// 链接
+func totpURI(username string, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", totpIssuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(totpDigits))
+	values.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(totpIssuer + ":" + username)
+	return "otpauth://totp/" + label + "?" + values.Encode()
+}
+
+func userTOTPSecret(user *models.User) ([]byte, error) {
+	if user.TOTPSecret == "" {
+		return nil, errors.New("没有设置两步验证")
+	}
+	encoded, err := decryptData(user.TOTPSecret)
+	if err != nil {
+		return nil, err
+	}
+	return base32NoPadding.DecodeString(string(encoded))
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeRecoveryCode 恢复码不区分大小写，忽略分隔符和空格
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func checkUserPassword(user *models.User, password string) error {
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return errors.New("密码错误")
+	}
+	return nil
+}
+
+// BeginTOTPEnrollment 生成新的 TOTP 密钥，输入验证码确认之前不会启用
+func BeginTOTPEnrollment(userID uint) (string, string, error) {
+	user := models.GetUserByID(userID)
+	if user.ID == 0 {
+		return "", "", errors.New("用户不存在")
+	}
+	if user.TOTPEnabled {
+		return "", "", errors.New("两步验证已经启用")
+	}
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	secret := base32NoPadding.EncodeToString(raw)
+	encrypted, err := encryptData([]byte(secret))
+	if err != nil {
+		return "", "", err
+	}
+	if err := models.GetDbClient().Model(&user).Update("totp_secret", encrypted).Error; err != nil {
+		return "", "", err
+	}
+	return secret, totpURI(user.Username, secret), nil
+}
+
+// EnableTOTP 用验证器应用生成的验证码确认密钥并启用两步验证，返回新的恢复码
+func EnableTOTP(userID uint, code string) ([]string, error) {
+	user := models.GetUserByID(userID)
+	if user.ID == 0 {
+		return nil, errors.New("用户不存在")
+	}
+	if user.TOTPEnabled {
+		return nil, errors.New("两步验证已经启用")
+	}
+	secret, err := userTOTPSecret(&user)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := verifyTOTP(secret, strings.TrimSpace(code), time.Now(), 0)
+	if !ok {
+		return nil, errors.New("验证码错误，请检查手机时间是否准确")
+	}
+	if err := models.GetDbClient().Model(&user).
+		Updates(map[string]interface{}{"totp_enabled": true, "totp_last_step": step}).Error; err != nil {
+		return nil, err
+	}
+	log.Printf("[USER] Enabled two-factor authentication for %s", user.Username)
+	return generateRecoveryCodes(user.ID)
+}
+
+// generateRecoveryCodes 生成新的恢复码，之前的恢复码全部失效
+func generateRecoveryCodes(userID uint) ([]string, error) {
+	db := models.GetDbClient()
+	if err := db.Unscoped().Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 8)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := base32NoPadding.EncodeToString(raw)[:12]
+		codes = append(codes, code[:4]+"-"+code[4:8]+"-"+code[8:])
+		record := models.RecoveryCode{UserID: userID, CodeHash: hashToken(code)}
+		if err := db.Create(&record).Error; err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，需要验证密码
+func RegenerateRecoveryCodes(userID uint, password string) ([]string, error) {
+	user := models.GetUserByID(userID)
+	if user.ID == 0 || !user.TOTPEnabled {
+		return nil, errors.New("没有启用两步验证")
+	}
+	if err := checkUserPassword(&user, password); err != nil {
+		return nil, err
+	}
+	return generateRecoveryCodes(user.ID)
+}
+
+// DisableTOTP 用户停用自己的两步验证，需要验证密码。配置要求两步验证时不能停用
+func DisableTOTP(userID uint, password string) error {
+	if TwoFactorRequired() {
+		return errors.New("系统要求所有用户启用两步验证")
+	}
+	user := models.GetUserByID(userID)
+	if user.ID == 0 {
+		return errors.New("用户不存在")
+	}
+	if err := checkUserPassword(&user, password); err != nil {
+		return err
+	}
+	return resetTOTP(&user)
+}
+
+// ResetUserTOTP 管理员为丢失手机的用户关闭两步验证，用户可以重新设置
+func ResetUserTOTP(id uint) error {
+	user := models.GetUserByID(id)
+	if user.ID == 0 {
+		return errors.New("用户不存在")
+	}
+	return resetTOTP(&user)
+}
+
+func resetTOTP(user *models.User) error {
+	if err := models.GetDbClient().Model(user).
+		Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "totp_last_step": 0,
+			"totp_failures": 0, "totp_locked_until": nil}).Error; err != nil {
+		return err
+	}
+	if err := models.RemoveTwoFactorData(user.ID); err != nil {
+		return err
+	}
+	log.Printf("[USER] Disabled two-factor authentication for %s", user.Username)
+	return nil
+}
+
+// VerifySecondFactor 登录时检查验证码或恢复码，恢复码使用后失效。
+// 连续错误 maxSecondFactorFailures 次后锁定 secondFactorLockout
+func VerifySecondFactor(userID uint, code string) error {
+	user := models.GetUserByID(userID)
+	if user.ID == 0 || !user.TOTPEnabled {
+		return errors.New("没有启用两步验证")
+	}
+	if user.TOTPLockedUntil != nil && time.Now().Before(*user.TOTPLockedUntil) {
+		return ErrSecondFactorLocked
+	}
+	if err := checkSecondFactor(&user, strings.TrimSpace(code)); err != nil {
+		return recordSecondFactorFailure(&user, err)
+	}
+	if user.TOTPFailures != 0 || user.TOTPLockedUntil != nil {
+		models.GetDbClient().Model(&user).Updates(map[string]interface{}{"totp_failures": 0, "totp_locked_until": nil})
+	}
+	return nil
+}
+
+func checkSecondFactor(user *models.User, code string) error {
+	if len(code) == totpDigits && strings.Trim(code, "0123456789") == "" {
+		secret, err := userTOTPSecret(user)
+		if err != nil {
+			return err
+		}
+		step, ok := verifyTOTP(secret, code, time.Now(), user.TOTPLastStep)
+		if !ok {
+			return errors.New("验证码错误")
+		}
+		// 只在时间步增大时更新，两个并发请求不能使用同一个验证码
+		result := models.GetDbClient().Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).Update("totp_last_step", step)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return errors.New("验证码已经使用过")
+		}
+		return nil
+	}
+
+	now := time.Now()
+	result := models.GetDbClient().Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashToken(normalizeRecoveryCode(code))).
+		Update("used_at", &now)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return errors.New("验证码或恢复码错误")
+	}
+	log.Printf("[USER] User %s signed in with a recovery code", user.Username)
+	return nil
+}
+
+// recordSecondFactorFailure 在数据库中累加错误次数，达到上限时锁定
+func recordSecondFactorFailure(user *models.User, cause error) error {
+	db := models.GetDbClient()
+	db.Model(&models.User{}).Where("id = ?", user.ID).
+		Update("totp_failures", gorm.Expr("totp_failures + 1"))
+	var failures int
+	db.Model(&models.User{}).Where("id = ?", user.ID).Select("totp_failures").Scan(&failures)
+	if failures < maxSecondFactorFailures {
+		return cause
+	}
+	lockedUntil := time.Now().Add(secondFactorLockout)
+	db.Model(&models.User{}).Where("id = ?", user.ID).
+		Updates(map[string]interface{}{"totp_failures": 0, "totp_locked_until": &lockedUntil})
+	log.Printf("[USER] Locked two-factor login of %s after %d failures", user.Username, failures)
+	return ErrSecondFactorLocked
+}
+
+// TrustDevice 记住当前设备，返回保存到 Cookie 中的令牌
+func TrustDevice(userID uint, userAgent string, ip string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw)
+	device := models.TrustedDevice{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		UserAgent: userAgent,
+		IP:        ip,
+		ExpiresAt: time.Now().Add(TrustedDeviceDuration),
+	}
+	if err := models.GetDbClient().Create(&device).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// IsTrustedDevice 检查 Cookie 中的令牌是否是该用户记住的未过期设备
+func IsTrustedDevice(userID uint, token string) bool {
+	if token == "" {
+		return false
+	}
+	device := models.GetTrustedDeviceByHash(hashToken(token))
+	if device.ID == 0 || device.UserID != userID || time.Now().After(device.ExpiresAt) {
+		return false
+	}
+	now := time.Now()
+	models.GetDbClient().Model(&device).Update("last_used_at", &now)
+	return true
+}
+
+// ForgetTrustedDevices 删除用户记住的所有设备，之后登录都需要验证码
+func ForgetTrustedDevices(userID uint) error {
+	return models.GetDbClient().Unscoped().Where("user_id = ?", userID).Delete(&models.TrustedDevice{}).Error
+}
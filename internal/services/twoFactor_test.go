@@ -0,0 +1,68 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录 B 的 SHA-1 密钥
+var rfc6238Secret = []byte("12345678901234567890")
+
+// TestTOTPCode RFC 6238 附录 B 的 SHA-1 测试向量，验证码取 8 位结果的后 6 位
+func TestTOTPCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		t.Run(time.Unix(tt.unix, 0).UTC().Format(time.RFC3339), func(t *testing.T) {
+			if got := totpCode(rfc6238Secret, tt.unix/totpPeriod); got != tt.want {
+				t.Errorf("totpCode = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+	tests := []struct {
+		name     string
+		step     int64  // 生成验证码的时间步
+		code     string // 留空时使用 step 的验证码
+		lastStep int64
+		ok       bool
+	}{
+		{"current step", current, "", 0, true},
+		{"previous step", current - 1, "", 0, true},
+		{"next step", current + 1, "", 0, true},
+		{"two steps behind", current - 2, "", 0, false},
+		{"two steps ahead", current + 2, "", 0, false},
+		{"reused step", current, "", current, false},
+		{"earlier than last step", current - 1, "", current, false},
+		{"after last step", current + 1, "", current, true},
+		{"wrong code", current, "123456", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := tt.code
+			if code == "" {
+				code = totpCode(rfc6238Secret, tt.step)
+			}
+			step, ok := verifyTOTP(rfc6238Secret, code, now, tt.lastStep)
+			if ok != tt.ok {
+				t.Fatalf("verifyTOTP ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && step != tt.step {
+				t.Errorf("verifyTOTP step = %d, want %d", step, tt.step)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/go-acme/lego/v4/certcrypto"
+	"log"
+	"path/filepath"
+	"software.sslmate.com/src/go-pkcs12"
+	"strings"
+	"time"
+	"uranus/internal/models"
+)
+
+// CertExpiryWarning 证书到期前多久开始续期或提醒
+const CertExpiryWarning = 30 * 24 * time.Hour
+
+// ParseCertificatePEM 解析 PEM 格式的证书和证书链，证书文件中可以已经包含证书链
+func ParseCertificatePEM(certPEM []byte, chainPEM []byte) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	for _, data := range [][]byte{certPEM, chainPEM} {
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			certificate, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("证书格式错误: %v", err)
+			}
+			certificates = append(certificates, certificate)
+		}
+	}
+	if len(certificates) == 0 {
+		return nil, errors.New("没有找到 PEM 格式的证书")
+	}
+	return certificates, nil
+}
+
+// ParsePrivateKeyPEM 解析 PEM 格式的私钥，支持 PKCS#1、PKCS#8 和 EC 私钥
+func ParsePrivateKeyPEM(keyPEM []byte) (crypto.PrivateKey, error) {
+	for data := keyPEM; ; {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("没有找到 PEM 格式的私钥")
+		}
+		if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			if x509.IsEncryptedPEMBlock(block) {
+				return nil, errors.New("不支持加密的私钥，请先解密")
+			}
+			return parsePrivateKey(block.Bytes)
+		}
+	}
+}
+
+// parsePrivateKey PKCS#12 中的私钥类型都是 PRIVATE KEY，需要依次尝试各种格式
+func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, errors.New("私钥格式错误")
+	}
+	switch key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+		return key, nil
+	}
+	return nil, errors.New("只支持 RSA 和 ECDSA 私钥")
+}
+
+// ParsePKCS12 解析 PKCS#12 (.pfx/.p12) 文件中的证书、证书链和私钥
+func ParsePKCS12(data []byte, password string) ([]*x509.Certificate, crypto.PrivateKey, error) {
+	key, certificate, caCerts, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取 PKCS#12 文件失败，请检查密码: %v", err)
+	}
+	if certificate == nil || key == nil {
+		return nil, nil, errors.New("PKCS#12 文件中没有证书或私钥")
+	}
+	switch key.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+	default:
+		return nil, nil, errors.New("只支持 RSA 和 ECDSA 私钥")
+	}
+	return append([]*x509.Certificate{certificate}, caCerts...), key, nil
+}
+
+// publicKeyMatches 证书的公钥是否与私钥匹配
+func publicKeyMatches(certificate *x509.Certificate, key crypto.PrivateKey) bool {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return false
+	}
+	public, ok := certificate.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && public.Equal(signer.Public())
+}
+
+// orderCertificateChain 找到与私钥匹配的证书放在最前面，其余作为证书链
+func orderCertificateChain(certificates []*x509.Certificate, key crypto.PrivateKey) ([]*x509.Certificate, error) {
+	for i, certificate := range certificates {
+		if publicKeyMatches(certificate, key) {
+			chain := []*x509.Certificate{certificate}
+			chain = append(chain, certificates[:i]...)
+			return append(chain, certificates[i+1:]...), nil
+		}
+	}
+	return nil, errors.New("私钥与证书不匹配")
+}
+
+// certificateDomains 证书中的域名和 IP，没有 SAN 时使用 CN
+func certificateDomains(certificate *x509.Certificate) []string {
+	domains := append([]string{}, certificate.DNSNames...)
+	for _, ip := range certificate.IPAddresses {
+		domains = append(domains, ip.String())
+	}
+	if len(domains) == 0 && certificate.Subject.CommonName != "" {
+		domains = append(domains, certificate.Subject.CommonName)
+	}
+	return domains
+}
+
+// UploadCert 保存上传的证书，作为共享证书供站点引用，同名的上传证书会被替换，
+// 引用它的站点在 nginx -t 通过后一起生效
+func UploadCert(name string, certificates []*x509.Certificate, key crypto.PrivateKey) error {
+	name = strings.TrimSpace(name)
+	if !sharedCertNameRegex.MatchString(name) {
+		return errors.New("证书名称只能包含字母、数字、点、下划线和横线")
+	}
+	chain, err := orderCertificateChain(certificates, key)
+	if err != nil {
+		return err
+	}
+	leaf := chain[0]
+	if time.Now().After(leaf.NotAfter) {
+		return fmt.Errorf("证书已于 %s 过期", leaf.NotAfter.Format("2006-01-02"))
+	}
+	domains := certificateDomains(leaf)
+	if len(domains) == 0 {
+		return errors.New("证书中没有域名")
+	}
+
+	cert := models.GetSharedCert(name)
+	if cert.ID != 0 && !cert.Uploaded {
+		return fmt.Errorf("共享证书 %s 已存在，并且由 ACME 签发", name)
+	}
+
+	var fullchain bytes.Buffer
+	for _, certificate := range chain {
+		_ = pem.Encode(&fullchain, &pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})
+	}
+	cert.FileName = name
+	cert.Shared = true
+	cert.Uploaded = true
+	dir := CertDir(&cert)
+	result, err := ApplyNginxFiles(map[string][]byte{
+		filepath.Join(dir, "fullchain.cer"): fullchain.Bytes(),
+		filepath.Join(dir, "private.key"):   certcrypto.PEMEncode(key),
+		filepath.Join(dir, "domains"):       []byte(strings.Join(domains, ",")),
+	})
+	if err != nil {
+		return err
+	}
+	if !result.OK {
+		return fmt.Errorf("nginx 配置检测失败: %s", result.Output)
+	}
+
+	cert.Domains = strings.Join(domains, ",")
+	cert.NotAfter = leaf.NotAfter
+	cert.Issuer = leaf.Issuer.CommonName
+	if cert.Issuer == "" && len(leaf.Issuer.Organization) > 0 {
+		cert.Issuer = leaf.Issuer.Organization[0]
+	}
+	if err := models.GetDbClient().Save(&cert).Error; err != nil {
+		return err
+	}
+	log.Printf("[SSL] Uploaded certificate %s for %s, expires at %s", name, cert.Domains, leaf.NotAfter.Format("2006-01-02"))
+	return nil
+}
+
+// ExpiringCerts 即将到期或已经过期的证书，上传的证书不会自动续期，需要人工处理
+func ExpiringCerts() []models.Cert {
+	var certs []models.Cert
+	for _, cert := range models.GetCertificates() {
+		if !cert.NotAfter.IsZero() && time.Until(cert.NotAfter) < CertExpiryWarning {
+			certs = append(certs, cert)
+		}
+	}
+	return certs
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"uranus/internal/config"
+	"uranus/internal/models"
+	"uranus/internal/nginxconf"
+)
+
+// UpstreamsFileName 所有服务器池写入站点目录下的同一个文件，不在网站列表中显示
+const UpstreamsFileName = "_upstreams.conf"
+
+var upstreamPoolNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]*$`)
+
+// upstreamsMutex 保证数据库与 upstream 文件同时更新
+var upstreamsMutex sync.Mutex
+
+// 健康检查每秒都要读取服务器池，缓存在内存中，修改数据库后丢弃
+var (
+	upstreamPoolsCache       []models.UpstreamPool
+	upstreamPoolsCacheLoaded bool
+	upstreamPoolsCacheLock   sync.Mutex
+)
+
+// cachedUpstreamPools 返回缓存的服务器池，调用方不能修改返回的内容
+func cachedUpstreamPools() []models.UpstreamPool {
+	upstreamPoolsCacheLock.Lock()
+	defer upstreamPoolsCacheLock.Unlock()
+	if !upstreamPoolsCacheLoaded {
+		upstreamPoolsCache = models.GetUpstreamPools()
+		upstreamPoolsCacheLoaded = true
+	}
+	return upstreamPoolsCache
+}
+
+// invalidateUpstreamPools 服务器池或后端状态保存后重新从数据库读取
+func invalidateUpstreamPools() {
+	upstreamPoolsCacheLock.Lock()
+	upstreamPoolsCache = nil
+	upstreamPoolsCacheLoaded = false
+	upstreamPoolsCacheLock.Unlock()
+}
+
+// UpstreamsFile upstream 配置文件路径
+func UpstreamsFile() string {
+	return filepath.Join(config.GetAppConfig().VhostPath, UpstreamsFileName)
+}
+
+// IsUpstreamsFile 判断文件名是否为 uranus 生成的 upstream 文件
+func IsUpstreamsFile(name string) bool {
+	return filepath.Base(name) == UpstreamsFileName
+}
+
+// ValidateUpstreamPool 检查服务器池设置
+func ValidateUpstreamPool(pool *models.UpstreamPool) error {
+	if !upstreamPoolNameRegex.MatchString(pool.Name) {
+		return errors.New("服务器池名称只能包含字母、数字、下划线、点和横线")
+	}
+	switch pool.Strategy {
+	case models.UpstreamRoundRobin, models.UpstreamLeastConn, models.UpstreamIPHash:
+	case models.UpstreamHash:
+		if pool.HashKey == "" {
+			return errors.New("hash 策略需要指定 key")
+		}
+	default:
+		return errors.New("未知的负载均衡策略: " + pool.Strategy)
+	}
+	switch pool.HealthCheck {
+	case models.HealthCheckNone, models.HealthCheckHTTP, models.HealthCheckTCP:
+	default:
+		return errors.New("未知的健康检查方式: " + pool.HealthCheck)
+	}
+	if pool.AutoDrain && pool.HealthCheck == models.HealthCheckNone {
+		return errors.New("自动摘除需要开启健康检查")
+	}
+	if len(pool.Members) == 0 {
+		return errors.New("服务器池至少需要一个后端")
+	}
+
+	addresses := map[string]bool{}
+	for _, member := range pool.Members {
+		if _, _, err := net.SplitHostPort(member.Address); err != nil {
+			return fmt.Errorf("后端地址 %q 格式应为 host:port", member.Address)
+		}
+		if addresses[member.Address] {
+			return fmt.Errorf("后端地址 %s 重复", member.Address)
+		}
+		addresses[member.Address] = true
+		if member.Weight < 0 || member.MaxFails < 0 {
+			return fmt.Errorf("后端 %s 的 weight/max_fails 不能为负数", member.Address)
+		}
+		// nginx 的 ip_hash 和 hash 不支持 backup 参数
+		if member.Backup && (pool.Strategy == models.UpstreamIPHash || pool.Strategy == models.UpstreamHash) {
+			return fmt.Errorf("%s 策略不支持备用服务器", pool.Strategy)
+		}
+	}
+	return nil
+}
+
+// RenderUpstreams 生成所有服务器池的 upstream 配置
+func RenderUpstreams(pools []models.UpstreamPool) string {
+	conf := &nginxconf.Config{}
+	conf.Append(nginxconf.NewComment(" 由 uranus 生成，请在负载均衡页面修改"))
+	for _, pool := range pools {
+		block := nginxconf.NewBlock("upstream", []string{pool.Name})
+		switch pool.Strategy {
+		case models.UpstreamLeastConn, models.UpstreamIPHash:
+			block.Append(nginxconf.NewDirective(pool.Strategy))
+		case models.UpstreamHash:
+			block.Append(nginxconf.NewDirective("hash", pool.HashKey, "consistent"))
+		}
+		for _, member := range pool.Members {
+			args := []string{member.Address}
+			if member.Weight > 0 && member.Weight != 1 {
+				args = append(args, "weight="+strconv.Itoa(member.Weight))
+			}
+			if member.MaxFails > 0 {
+				args = append(args, "max_fails="+strconv.Itoa(member.MaxFails))
+			}
+			if member.FailTimeout != "" {
+				args = append(args, "fail_timeout="+member.FailTimeout)
+			}
+			if member.Backup {
+				args = append(args, "backup")
+			}
+			if member.IsDown() {
+				args = append(args, "down")
+			}
+			block.Append(nginxconf.NewDirective("server", args...))
+		}
+		conf.Append(block)
+	}
+	return conf.String()
+}
+
+// writeUpstreams 将服务器池写入 upstream 文件并检测，调用方需持有 upstreamsMutex
+func writeUpstreams(pools []models.UpstreamPool, author string, source string) (*NginxTestResult, error) {
+	return SaveConfFile(UpstreamsFile(), RenderUpstreams(pools), author, source)
+}
+
+// SaveUpstreamPool 保存服务器池，nginx -t 检测通过后才写入数据库
+func SaveUpstreamPool(pool *models.UpstreamPool, author string, source string) (*NginxTestResult, error) {
+	if err := ValidateUpstreamPool(pool); err != nil {
+		return nil, err
+	}
+
+	upstreamsMutex.Lock()
+	defer upstreamsMutex.Unlock()
+
+	if existing := models.GetUpstreamPoolByName(pool.Name); existing.ID != 0 && existing.ID != pool.ID {
+		return nil, errors.New("服务器池 " + pool.Name + " 已存在")
+	}
+
+	// 保留健康检查的摘除状态
+	previous := models.GetUpstreamPoolByID(pool.ID)
+	drained := map[string]bool{}
+	for _, member := range previous.Members {
+		drained[member.Address] = member.Drained
+	}
+	for i := range pool.Members {
+		pool.Members[i].Drained = pool.AutoDrain && drained[pool.Members[i].Address]
+	}
+
+	pools := models.GetUpstreamPools()
+	replaced := false
+	for i := range pools {
+		if pool.ID != 0 && pools[i].ID == pool.ID {
+			pools[i] = *pool
+			replaced = true
+		}
+	}
+	if !replaced {
+		pools = append(pools, *pool)
+	}
+
+	result, err := writeUpstreams(pools, author, source)
+	if err != nil || !result.OK {
+		return result, err
+	}
+	// 成员整体替换后 ID 会变化，重新开始健康检查
+	healthChecker.forget(&previous)
+	defer invalidateUpstreamPools()
+	return result, pool.Save()
+}
+
+// DeleteUpstreamPool 删除服务器池，仍被站点引用时 nginx -t 会失败并回滚
+func DeleteUpstreamPool(id uint, author string, source string) (*NginxTestResult, error) {
+	upstreamsMutex.Lock()
+	defer upstreamsMutex.Unlock()
+
+	pool := models.GetUpstreamPoolByID(id)
+	if pool.ID == 0 {
+		return nil, errors.New("服务器池不存在")
+	}
+
+	var pools []models.UpstreamPool
+	for _, p := range models.GetUpstreamPools() {
+		if p.ID != id {
+			pools = append(pools, p)
+		}
+	}
+	result, err := writeUpstreams(pools, author, source)
+	if err != nil || !result.OK {
+		return result, err
+	}
+	healthChecker.forget(&pool)
+	defer invalidateUpstreamPools()
+	return result, pool.Remove()
+}
+
+// setUpstreamMemberDrained 健康检查摘除或恢复后端，检测失败时不修改数据库。
+// 自动摘除不记录历史版本，避免后端反复上下线时淹没人工修改的记录
+func setUpstreamMemberDrained(poolID uint, memberID uint, drained bool) error {
+	upstreamsMutex.Lock()
+	defer upstreamsMutex.Unlock()
+
+	pools := models.GetUpstreamPools()
+	found := false
+	for i := range pools {
+		if pools[i].ID != poolID {
+			continue
+		}
+		for j := range pools[i].Members {
+			if pools[i].Members[j].ID == memberID {
+				pools[i].Members[j].Drained = drained
+				found = true
+			}
+		}
+	}
+	if !found {
+		return errors.New("后端不存在")
+	}
+
+	result, err := ApplyNginxFile(UpstreamsFile(), []byte(RenderUpstreams(pools)))
+	if err != nil {
+		return err
+	}
+	if !result.OK {
+		return errors.New(result.Message())
+	}
+	defer invalidateUpstreamPools()
+	return models.SetUpstreamMemberDrained(memberID, drained)
+}
+
+// EnsureUpstreamsFile 启动时根据数据库重新生成 upstream 文件
+func EnsureUpstreamsFile() {
+	pools := models.GetUpstreamPools()
+	if len(pools) == 0 {
+		return
+	}
+	content := RenderUpstreams(pools)
+	if current, err := os.ReadFile(UpstreamsFile()); err == nil && string(current) == content {
+		return
+	}
+
+	upstreamsMutex.Lock()
+	defer upstreamsMutex.Unlock()
+	if _, err := SaveConfFile(UpstreamsFile(), content, "uranus", models.RevisionSourceDisk); err != nil {
+		log.Printf("[UPSTREAM] Failed to write %s: %v", UpstreamsFile(), err)
+	}
+}
+
+// IsUpstreamPoolTarget 判断 proxy_pass 地址是否指向某个服务器池，返回池名称
+func IsUpstreamPoolTarget(target string) (string, bool) {
+	name := strings.TrimSuffix(strings.TrimPrefix(target, "http://"), "/")
+	if name == "" || strings.ContainsAny(name, ":/") {
+		return "", false
+	}
+	if pool := models.GetUpstreamPoolByName(name); pool.ID != 0 {
+		return name, true
+	}
+	return "", false
+}
@@ -0,0 +1,308 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"uranus/internal/config"
+	"uranus/internal/models"
+)
+
+const (
+	// 没有配置密码时使用的初始密码，首次登录必须修改
+	defaultPassword   = "admin"
+	minPasswordLength = 8
+	maxUsernameLength = 64
+)
+
+var (
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("生成密码哈希失败: %v", err)
+	}
+	return string(hash), nil
+}
+
+// validatePassword 检查新密码，bcrypt 只使用前 72 个字节
+func validatePassword(username, password string) error {
+	switch {
+	case len(password) < minPasswordLength:
+		return fmt.Errorf("密码至少需要 %d 个字符", minPasswordLength)
+	case len(password) > 72:
+		return errors.New("密码不能超过 72 个字节")
+	case password == defaultPassword || strings.EqualFold(password, username):
+		return errors.New("不能使用默认密码或与用户名相同的密码")
+	}
+	return nil
+}
+
+func validateUsername(username string) error {
+	switch {
+	case username == "":
+		return errors.New("用户名不能为空")
+	case len(username) > maxUsernameLength:
+		return fmt.Errorf("用户名不能超过 %d 个字符", maxUsernameLength)
+	case strings.ContainsAny(username, " \t\r\n"):
+		return errors.New("用户名不能包含空白字符")
+	}
+	return nil
+}
+
+// saveConfigUser 用配置中的用户名和明文密码创建或更新用户，弱密码要求登录后修改
+func saveConfigUser(username, password string) error {
+	if username == "" {
+		username = "admin"
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	user := models.GetUserByUsername(username)
+	user.Username = username
+	if user.Role == "" {
+		user.Role = models.RoleAdmin
+	}
+	user.PasswordHash = hash
+	user.MustChangePassword = validatePassword(username, password) != nil
+	user.PasswordChangedAt = &now
+	user.ConfigPasswordHash = hash
+	return models.GetDbClient().Save(&user).Error
+}
+
+// configPasswordMigrated 配置中的明文密码已经迁移过，说明上次没能从配置文件中删除。
+// 配置中的密码被换成新的时仍然迁移，用于忘记密码后重置
+func configPasswordMigrated(username, password string) bool {
+	if username == "" {
+		username = "admin"
+	}
+	user := models.GetUserByUsername(username)
+	return user.ID != 0 && user.ConfigPasswordHash != "" &&
+		bcrypt.CompareHashAndPassword([]byte(user.ConfigPasswordHash), []byte(password)) == nil
+}
+
+// clearConfigPassword 从 config.toml 中删除已经迁移的明文密码
+func clearConfigPassword() error {
+	configLock := config.GetConfigLock()
+	configLock.Lock()
+	if err := viper.ReadInConfig(); err != nil {
+		configLock.Unlock()
+		return fmt.Errorf("读取配置文件失败: %v", err)
+	}
+	viper.Set("password", "")
+	err := viper.WriteConfig()
+	configLock.Unlock()
+	if err != nil {
+		return fmt.Errorf("写入配置失败: %v", err)
+	}
+	config.ReloadConfig()
+	return nil
+}
+
+// MigrateUsers 把 config.toml 中的明文密码迁移到用户表并从配置文件中删除。
+// 没有任何用户时使用默认密码创建管理员，首次登录必须修改密码
+func MigrateUsers() {
+	// 启用角色之前创建的用户都是管理员
+	models.GetDbClient().Model(&models.User{}).Where("role = ? OR role IS NULL", "").Update("role", models.RoleAdmin)
+
+	appConfig := config.GetAppConfig()
+	password := appConfig.Password
+	if password == "" {
+		if models.CountUsers() > 0 {
+			return
+		}
+		password = defaultPassword
+	}
+
+	if appConfig.Password != "" && configPasswordMigrated(appConfig.Username, password) {
+		log.Printf("[USER] Password in config was already migrated, ignoring it")
+	} else if err := saveConfigUser(appConfig.Username, password); err != nil {
+		log.Printf("[USER] Failed to migrate password from config: %v", err)
+		return
+	} else {
+		log.Printf("[USER] Migrated password of user %s from config to database", appConfig.Username)
+	}
+
+	if appConfig.Password != "" {
+		if err := clearConfigPassword(); err != nil {
+			log.Printf("[USER] Failed to remove password from config: %v", err)
+		}
+	}
+}
+
+// Authenticate 检查用户名和密码，成功后记录登录时间
+func Authenticate(username, password string) (models.User, error) {
+	user := models.GetUserByUsername(username)
+	if user.ID == 0 {
+		// 用户不存在时同样计算一次哈希，避免通过响应时间判断用户名是否存在
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte(defaultPassword), bcrypt.DefaultCost)
+		})
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return user, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return user, ErrInvalidCredentials
+	}
+
+	now := time.Now()
+	user.LastLoginAt = &now
+	models.GetDbClient().Model(&user).Update("last_login_at", &now)
+	return user, nil
+}
+
+// ChangePassword 用户修改自己的密码，需要验证当前密码
+func ChangePassword(userID uint, current, password string) error {
+	user := models.GetUserByID(userID)
+	if user.ID == 0 {
+		return errors.New("用户不存在")
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(current)) != nil {
+		return errors.New("当前密码错误")
+	}
+	if current == password {
+		return errors.New("新密码不能与当前密码相同")
+	}
+	return setPassword(&user, password, false)
+}
+
+// setPassword 保存新密码，mustChange 为 true 时用户下次登录必须修改
+func setPassword(user *models.User, password string, mustChange bool) error {
+	if err := validatePassword(user.Username, password); err != nil {
+		return err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	user.PasswordHash = hash
+	user.MustChangePassword = mustChange
+	user.PasswordChangedAt = &now
+	return models.GetDbClient().Model(user).
+		Select("PasswordHash", "MustChangePassword", "PasswordChangedAt").Updates(user).Error
+}
+
+// normalizeAccess 检查角色并整理分配的站点
+func normalizeAccess(access *models.User) error {
+	if !models.ValidRole(access.Role) {
+		return fmt.Errorf("未知的角色: %s", access.Role)
+	}
+	access.Sites = strings.Join(access.SiteList(), ",")
+	return nil
+}
+
+// CreateUser 创建用户，access 中包含用户名、角色和授权。
+// 管理员设置的是临时密码，用户首次登录必须修改
+func CreateUser(access models.User, password string) (models.User, error) {
+	username := strings.TrimSpace(access.Username)
+	user := models.User{
+		Username:       username,
+		Role:           access.Role,
+		TerminalAccess: access.TerminalAccess,
+		ConfigAccess:   access.ConfigAccess,
+		Sites:          access.Sites,
+	}
+	if err := validateUsername(username); err != nil {
+		return user, err
+	}
+	if err := normalizeAccess(&user); err != nil {
+		return user, err
+	}
+	if models.GetUserByUsername(username).ID != 0 {
+		return user, errors.New("用户名已存在")
+	}
+	if err := validatePassword(username, password); err != nil {
+		return user, err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return user, err
+	}
+	user.PasswordHash = hash
+	user.MustChangePassword = true
+	if err := models.GetDbClient().Create(&user).Error; err != nil {
+		return user, err
+	}
+	log.Printf("[USER] Created user %s with role %s", username, user.Role)
+	return user, nil
+}
+
+// UpdateUserAccess 修改用户的角色、终端和应用配置授权以及分配的站点，
+// 不能修改自己的角色，避免管理员把自己锁在外面
+func UpdateUserAccess(id uint, currentID uint, access models.User) error {
+	user := models.GetUserByID(id)
+	if user.ID == 0 {
+		return errors.New("用户不存在")
+	}
+	if err := normalizeAccess(&access); err != nil {
+		return err
+	}
+	if user.ID == currentID && access.Role != user.Role {
+		return errors.New("不能修改自己的角色")
+	}
+	user.Role = access.Role
+	user.TerminalAccess = access.TerminalAccess
+	user.ConfigAccess = access.ConfigAccess
+	user.Sites = access.Sites
+	if err := models.GetDbClient().Model(&user).
+		Select("Role", "TerminalAccess", "ConfigAccess", "Sites").Updates(&user).Error; err != nil {
+		return err
+	}
+	log.Printf("[USER] Updated access of user %s: role %s, terminal %t, config %t, sites %q",
+		user.Username, user.Role, user.TerminalAccess, user.ConfigAccess, user.Sites)
+	return nil
+}
+
+// ResetUserPassword 管理员重置其他用户的密码，用户下次登录必须修改
+func ResetUserPassword(id uint, password string) error {
+	user := models.GetUserByID(id)
+	if user.ID == 0 {
+		return errors.New("用户不存在")
+	}
+	if err := setPassword(&user, password, true); err != nil {
+		return err
+	}
+	// 用旧密码登录的会话全部失效
+	if err := RevokeUserSessions(user.ID, ""); err != nil {
+		log.Printf("[USER] Failed to revoke sessions of %s: %v", user.Username, err)
+	}
+	log.Printf("[USER] Reset password of user %s", user.Username)
+	return nil
+}
+
+// DeleteUser 删除用户，不能删除自己和最后一个用户
+func DeleteUser(id uint, currentID uint) error {
+	user := models.GetUserByID(id)
+	switch {
+	case user.ID == 0:
+		return errors.New("用户不存在")
+	case user.ID == currentID:
+		return errors.New("不能删除当前登录的用户")
+	case models.CountUsers() <= 1:
+		return errors.New("不能删除最后一个用户")
+	}
+	if err := user.Remove(); err != nil {
+		return err
+	}
+	if err := models.RemoveTwoFactorData(user.ID); err != nil {
+		log.Printf("[USER] Failed to remove two-factor data of %s: %v", user.Username, err)
+	}
+	if err := RevokeUserSessions(user.ID, ""); err != nil {
+		log.Printf("[USER] Failed to revoke sessions of %s: %v", user.Username, err)
+	}
+	log.Printf("[USER] Deleted user %s", user.Username)
+	return nil
+}
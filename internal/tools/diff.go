@@ -0,0 +1,212 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// diffContextLines unified diff 中每个改动块前后保留的上下文行数
+	diffContextLines = 3
+	// maxDiffSearch 中间蛇最多搜索的步数，差异太大时不再求最短编辑，整段作为删除和新增，
+	// 避免整个文件被替换时耗时过长
+	maxDiffSearch = 1000
+)
+
+type diffOp struct {
+	kind byte // ' ' 相同, '-' 删除, '+' 新增
+	text string
+}
+
+// UnifiedDiff 生成 oldText 到 newText 的 unified diff，内容相同时返回空字符串
+func UnifiedDiff(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+	ops := diffLines(splitLines(oldText), splitLines(newText))
+
+	var builder strings.Builder
+	builder.WriteString("--- " + oldName + "\n")
+	builder.WriteString("+++ " + newName + "\n")
+
+	for start := 0; start < len(ops); {
+		// 找到下一个改动
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start >= len(ops) {
+			break
+		}
+
+		// 向后扩展，两个改动之间的相同行不超过 2*context 时合并为一个块
+		end := start
+		for i := start; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				end = i
+			} else if i-end > 2*diffContextLines {
+				break
+			}
+		}
+
+		hunkStart := max(0, start-diffContextLines)
+		hunkEnd := min(len(ops), end+diffContextLines+1)
+		writeHunk(&builder, ops, hunkStart, hunkEnd)
+		start = hunkEnd
+	}
+	return builder.String()
+}
+
+// writeHunk 输出 ops[from:to] 对应的一个 @@ 块
+func writeHunk(builder *strings.Builder, ops []diffOp, from, to int) {
+	oldLine, newLine := 1, 1
+	for _, op := range ops[:from] {
+		if op.kind != '+' {
+			oldLine++
+		}
+		if op.kind != '-' {
+			newLine++
+		}
+	}
+
+	oldCount, newCount := 0, 0
+	for _, op := range ops[from:to] {
+		if op.kind != '+' {
+			oldCount++
+		}
+		if op.kind != '-' {
+			newCount++
+		}
+	}
+	if oldCount == 0 {
+		oldLine--
+	}
+	if newCount == 0 {
+		newLine--
+	}
+
+	fmt.Fprintf(builder, "@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount)
+	for _, op := range ops[from:to] {
+		builder.WriteByte(op.kind)
+		builder.WriteString(op.text)
+		builder.WriteByte('\n')
+	}
+}
+
+// diffLines 计算逐行的编辑脚本。先去掉相同的开头和结尾，剩下的部分使用 Myers 线性空间算法，
+// 内存只与行数成正比，大文件也不会分配 n*m 的矩阵
+func diffLines(a, b []string) []diffOp {
+	ops := make([]diffOp, 0, len(a)+len(b))
+	return compareLines(ops, a, b)
+}
+
+// compareLines 把 a 到 b 的编辑脚本追加到 ops
+func compareLines(ops []diffOp, a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		ops = append(ops, diffOp{' ', a[prefix]})
+		prefix++
+	}
+	a, b = a[prefix:], b[prefix:]
+
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	switch {
+	case len(a) == 0:
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+	case len(b) == 0:
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+	default:
+		// 开头和结尾都不同，编辑距离至少为 2，中间蛇两侧的子问题都更小
+		x, y, u, v, ok := middleSnake(a, b)
+		if !ok {
+			for _, line := range a {
+				ops = append(ops, diffOp{'-', line})
+			}
+			for _, line := range b {
+				ops = append(ops, diffOp{'+', line})
+			}
+			break
+		}
+		ops = compareLines(ops, a[:x], b[:y])
+		for _, line := range a[x:u] {
+			ops = append(ops, diffOp{' ', line})
+		}
+		ops = compareLines(ops, a[u:], b[v:])
+	}
+
+	for _, line := range common {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// middleSnake 同时从两端搜索最短编辑路径，返回两端相遇处的一段相同行 a[x:u] == b[y:v]，
+// 超过 maxDiffSearch 步仍未相遇时 ok 为 false
+func middleSnake(a, b []string) (x, y, u, v int, ok bool) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	limit := min((n+m+1)/2, maxDiffSearch)
+	offset := limit + 1
+	// forward[k] 从开头出发在对角线 k = x-y 上到达的最远 x，
+	// backward[k] 在两个序列都反转后同样的值
+	forward := make([]int, 2*offset+1)
+	backward := make([]int, 2*offset+1)
+
+	for d := 0; d <= limit; d++ {
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y = x - k
+			u, v = x, y
+			for u < n && v < m && a[u] == b[v] {
+				u++
+				v++
+			}
+			forward[offset+k] = u
+			// 反向对角线 delta-k 已经走了 d-1 步
+			if reverse := delta - k; odd && reverse >= -(d-1) && reverse <= d-1 && u+backward[offset+reverse] >= n {
+				return x, y, u, v, true
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y = x - k
+			u, v = x, y
+			for u < n && v < m && a[n-1-u] == b[m-1-v] {
+				u++
+				v++
+			}
+			backward[offset+k] = u
+			if reverse := delta - k; !odd && reverse >= -d && reverse <= d && u+forward[offset+reverse] >= n {
+				// 转换回正向坐标
+				return n - u, m - v, n - x, m - y, true
+			}
+		}
+	}
+	return 0, 0, 0, 0, false
+}
+
+// splitLines 按行拆分，忽略末尾换行
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
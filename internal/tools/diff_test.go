@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+		want string
+	}{
+		{"same", "a\nb\n", "a\nb\n", ""},
+		{"append", "a\n", "a\nb\n", "--- f\n+++ f\n@@ -1,1 +1,2 @@\n a\n+b\n"},
+		{"from empty", "", "a\n", "--- f\n+++ f\n@@ -0,0 +1,1 @@\n+a\n"},
+		{"to empty", "a\n", "", "--- f\n+++ f\n@@ -1,1 +0,0 @@\n-a\n"},
+		{"replace middle", "1\n2\n3\n4\n5\n6\n7\n8\n9\n", "1\n2\n3\n4\nx\n6\n7\n8\n9\n",
+			"--- f\n+++ f\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+x\n 6\n 7\n 8\n"},
+		{"two hunks", "a\n1\n2\n3\n4\n5\n6\n7\n8\nb\n", "A\n1\n2\n3\n4\n5\n6\n7\n8\nB\n",
+			"--- f\n+++ f\n@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -7,4 +7,4 @@\n 6\n 7\n 8\n-b\n+B\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UnifiedDiff("f", "f", tt.old, tt.new); got != tt.want {
+				t.Errorf("UnifiedDiff = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// applyOps 由编辑脚本还原两边的内容，并统计改动行数
+func applyOps(ops []diffOp) (a, b []string, changes int) {
+	for _, op := range ops {
+		if op.kind != '+' {
+			a = append(a, op.text)
+		}
+		if op.kind != '-' {
+			b = append(b, op.text)
+		}
+		if op.kind != ' ' {
+			changes++
+		}
+	}
+	return a, b, changes
+}
+
+func lcsLength(a, b []string) int {
+	row := make([]int, len(b)+1)
+	for i := range a {
+		prev := 0
+		for j := range b {
+			current := row[j+1]
+			if a[i] == b[j] {
+				row[j+1] = prev + 1
+			} else if row[j] > row[j+1] {
+				row[j+1] = row[j]
+			}
+			prev = current
+		}
+	}
+	return row[len(b)]
+}
+
+func randomLines(r *rand.Rand, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = string(rune('a' + r.Intn(4)))
+	}
+	return lines
+}
+
+// TestDiffLinesMinimal 编辑脚本能还原两边内容，且改动行数最少
+func TestDiffLinesMinimal(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		a, b := randomLines(r, r.Intn(30)), randomLines(r, r.Intn(30))
+		gotA, gotB, changes := applyOps(diffLines(a, b))
+		if strings.Join(gotA, "\n") != strings.Join(a, "\n") || strings.Join(gotB, "\n") != strings.Join(b, "\n") {
+			t.Fatalf("ops do not reproduce input: a=%q b=%q", a, b)
+		}
+		if want := len(a) + len(b) - 2*lcsLength(a, b); changes != want {
+			t.Fatalf("changes = %d, want %d: a=%q b=%q", changes, want, a, b)
+		}
+	}
+}
+
+func TestDiffLinesLargeFile(t *testing.T) {
+	old := make([]string, 20000)
+	for i := range old {
+		old[i] = fmt.Sprintf("line %d;", i)
+	}
+	updated := append([]string{}, old...)
+	updated[100] = "changed;"
+	updated = append(updated[:5000], updated[5010:]...)
+	updated = append(updated, "tail;")
+
+	diff := UnifiedDiff("f", "f", strings.Join(old, "\n"), strings.Join(updated, "\n"))
+	if got := strings.Count(diff, "@@ -"); got != 3 {
+		t.Errorf("hunks = %d, want 3\n%s", got, diff)
+	}
+	if _, _, changes := applyOps(diffLines(old, updated)); changes != 13 {
+		t.Errorf("changes = %d, want 13", changes)
+	}
+}
+
+// TestDiffLinesRewrite 整个文件被替换时不再求最短编辑，但结果仍然正确
+func TestDiffLinesRewrite(t *testing.T) {
+	old := make([]string, 20000)
+	updated := make([]string, 20000)
+	for i := range old {
+		old[i] = fmt.Sprintf("old %d;", i)
+		updated[i] = fmt.Sprintf("new %d;", i)
+	}
+	gotA, gotB, changes := applyOps(diffLines(old, updated))
+	if len(gotA) != len(old) || gotA[0] != old[0] || len(gotB) != len(updated) || gotB[19999] != updated[19999] {
+		t.Errorf("ops do not reproduce input")
+	}
+	if changes != 40000 {
+		t.Errorf("changes = %d, want 40000", changes)
+	}
+}
@@ -301,7 +301,30 @@ func Graceful() {
 	defer dbCancel()
 	models.InitWithContext(dbCtx)
 
-	go services.RenewSSL()
+	// 把 config.toml 中的明文密码迁移到用户表，升级前创建的用户设为管理员
+	services.MigrateUsers()
+
+	// 加密升级前以明文保存的 DNS 凭据
+	services.MigrateDNSCredentials()
+
+	// 启动时只检查站点配置与数据库记录的差异，不修改记录，导入由站点页面手动执行
+	go services.ReconcileSites(false)
+
+	// 自动续期证书，失败后按指数退避重试
+	go services.StartRenewalScheduler(ctx)
+
+	// 定期检查 nginx 实际返回的证书，发现与磁盘上的证书不一致时告警
+	go services.StartTLSInspection(ctx)
+
+	// 重新生成 upstream 文件并启动后端健康检查
+	services.EnsureUpstreamsFile()
+	go services.StartHealthChecks(ctx)
+
+	// 导入磁盘上新增或修改过的自定义站点模板
+	services.SyncCustomTemplates()
+
+	// 按计划时间开启/结束站点维护模式
+	go services.StartMaintenanceScheduler(ctx)
 
 	// 启动控制中心心跳服务
 	go services.StartAgentHeartbeat(ctx)
@@ -141,10 +141,36 @@ const processResponse = (data, redirect = "/admin/sites", successMessage) => {
         $("#successMessage").html(successMessage);
         $("#alertSuccess").show()
     } else {
-        $("#message").html(data.message);
+        $("#message").text(data.message);
         $("#alert").show();
         $("#alertSuccess").hide();
     }
+    markNginxIssues(data);
+}
+
+/**
+ * 在编辑器中标记 nginx -t 报告的错误行
+ * @param data 保存接口的返回值, 包含 file 与 issues
+ */
+const markNginxIssues = (data) => {
+    if (!editor || typeof monaco === 'undefined') {
+        return;
+    }
+    const model = editor.getModel();
+    const markers = (data.issues || [])
+        .filter(issue => issue.line > 0 && (!data.file || issue.file === data.file))
+        .map(issue => ({
+            severity: issue.level === 'warn' ? monaco.MarkerSeverity.Warning : monaco.MarkerSeverity.Error,
+            message: issue.message,
+            startLineNumber: issue.line,
+            startColumn: 1,
+            endLineNumber: issue.line,
+            endColumn: model.getLineMaxColumn(Math.min(issue.line, model.getLineCount())),
+        }));
+    monaco.editor.setModelMarkers(model, 'nginx-test', markers);
+    if (markers.length > 0) {
+        editor.revealLineInCenter(markers[0].startLineNumber);
+    }
 }
 
 $('#enableSSL').click(() => {
@@ -161,7 +187,30 @@ $('#enableSSL').click(() => {
     const configName = $("#filename").val();
     const proxy = $("#proxy").val();
 
-    $.get('/admin/ssl/renew', {domains, configName}, (data) => {
+    const dnsCredential = $("#dnsCredential").val();
+    const acmeServer = $("#acmeServer").val();
+    const keyType = $("#keyType").val();
+    const sharedCert = $("#sharedCert").val();
+
+    // 使用共享证书时不需要申请，直接生成引用共享证书的 HTTPS 配置
+    if (sharedCert) {
+        $.get('/admin/sites/template', {domains, ssl: true, proxy, configName, cert: sharedCert}, (data) => {
+            editor.getModel().setValue(data.content);
+            $("#successMessage").text("已引用共享证书 " + sharedCert + "，保存后生效");
+            $("#alertSuccess").show();
+        }).fail((xhr) => {
+            $("#message").text(xhr.responseJSON ? xhr.responseJSON.message : "生成配置失败");
+            $("#alert").show();
+        }).always(() => {
+            $('#ssl_spinner').addClass('hidden');
+            $('#ssl_icon').removeClass('hidden');
+            $('#ssl_status').text("Let's Encrypt");
+            $('#enableSSL').attr("disabled", false);
+        });
+        return;
+    }
+
+    $.post('/admin/ssl/renew', {domains, configName, dnsCredential, acmeServer, keyType}, (data) => {
         processResponse(data, false, "SSL 签名成功,自动添加 SSL 部分");
 
         // Restore button state
@@ -189,8 +238,14 @@ $('#enableSSL').click(() => {
 $('#getTemplate').click(() => {
     const domains = $("#domains").val() ? $("#domains").val().split(",") : ["localhost"];
     const proxy = $("#proxy").val() ? $("#proxy").val() : "http://localhost";
-    $.get('/admin/sites/template', {domains, proxy}, (data) => {
+    const template = $("#template").val();
+    const params = typeof templateParams === 'function' ? templateParams() : {};
+    $.get('/admin/sites/template', {domains, proxy, template, params}, (data) => {
+        $("#alert").hide();
         editor.getModel().setValue(data.content);
+    }).fail((xhr) => {
+        $("#message").text(xhr.responseJSON ? xhr.responseJSON.message : xhr.statusText);
+        $("#alert").show();
     });
 });
 
@@ -209,6 +264,15 @@ $('#saveSitesConf').click(() => {
         }
     }
 
+    // 新建站点时记录使用的模板
+    if ($("#template").length) {
+        json = {
+            ...json,
+            template: $("#template").val(),
+            params: templateParams(),
+        }
+    }
+
     $.post('/admin/sites/save', json, (data) => {
         processResponse(data);
     });